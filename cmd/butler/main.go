@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"runtime/metrics"
 
 	"github.com/go-logr/zapr"
@@ -12,15 +13,18 @@ import (
 	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
 	"github.com/octopipe/circlerr/internal/gitmanager"
 	"github.com/octopipe/circlerr/internal/k8scontrollers"
+	"github.com/octopipe/circlerr/internal/routingmanager"
 	"github.com/octopipe/circlerr/internal/templatemanager"
 	"github.com/octopipe/circlerr/internal/utils/annotation"
+	"github.com/octopipe/circlerr/internal/utils/settings"
 	"github.com/octopipe/circlerr/pkg/twice/cache"
+	"github.com/octopipe/circlerr/pkg/twice/health"
 	"github.com/octopipe/circlerr/pkg/twice/reconciler"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/viper"
 	"go.opentelemetry.io/otel/exporters/prometheus"
 	"go.opentelemetry.io/otel/sdk/metric"
 	"go.uber.org/zap"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -39,6 +43,17 @@ func init() {
 
 func main() {
 	_ = godotenv.Load()
+	viper.AutomaticEnv()
+	viper.SetDefault("CIRCLE_RESYNC_INTERVAL", "10m")
+	// SERVER_SIDE is opt-in, butler and moove must be set with the same strategy.
+	viper.SetDefault("APPLY_STRATEGY", reconciler.ClientSideApplyStrategy)
+	viper.SetDefault("CACHE_METADATA_ONLY_KINDS", "Pod,ReplicaSet.apps,Endpoints,EndpointSlice.discovery.k8s.io,Lease.coordination.k8s.io")
+	viper.SetDefault("CACHE_MAX_ANNOTATION_SIZE", 16384)
+	viper.SetDefault("DISCOVERY_REFRESH_INTERVAL", "5m")
+	viper.SetDefault("HOOK_TIMEOUT", "10m")
+	// A zero WAVE_HEALTH_TIMEOUT applies the waves without waiting for them to
+	// be healthy.
+	viper.SetDefault("WAVE_HEALTH_TIMEOUT", "0")
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     "0",
@@ -58,18 +73,44 @@ func main() {
 		log.Fatal(err)
 	}
 	provider := metric.NewMeterProvider(metric.WithReader(exporter))
-	_ = provider.Meter("github.com/octopipe/circlerr")
+	meter := provider.Meter("github.com/octopipe/circlerr")
 	gitManager := gitmanager.NewManager(mgr.GetClient())
-	templateManager := templatemanager.NewTemplateManager(mgr.GetClient())
-	clusterCache := cache.NewLocalCache()
-	k8sReconciler := reconciler.NewReconciler(zapr.NewLogger(logger), config, clusterCache)
-
-	err = k8sReconciler.Preload(context.Background(), func(un *unstructured.Unstructured) bool {
-		a := un.GetAnnotations()
-		isControlled := a[annotation.ControlledByAnnotation] == annotation.ControlledByAnnotationValue
+	templateManager := templatemanager.NewTemplateManager(mgr.GetClient(), gitManager)
+	clusterCache, err := newClusterCache(viper.GetString("CACHE_PATH"))
+	if err != nil {
+		panic(err)
+	}
+	if err := cache.RegisterMetrics(meter, clusterCache); err != nil {
+		log.Fatal(err)
+	}
+	routingProvider, err := routingmanager.NewProvider(os.Getenv("ROUTING_PROVIDER"))
+	if err != nil {
+		panic(err)
+	}
+	routingManager := routingmanager.NewRoutingManager(mgr.GetClient(), clusterCache, routingProvider)
+	resourceEvents := k8scontrollers.NewResourceEvents()
+	healthChecker := health.NewChecker()
+	k8sReconciler := reconciler.NewReconciler(
+		zapr.NewLogger(logger),
+		config,
+		clusterCache,
+		reconciler.WithOnChange(resourceEvents.OnChange),
+		reconciler.WithApplyStrategy(viper.GetString("APPLY_STRATEGY")),
+		reconciler.WithFieldManager("circlerr"),
+		reconciler.WithSyncWaveAnnotation(annotation.SyncWaveAnnotation),
+		reconciler.WithHookAnnotations(annotation.HookAnnotation, annotation.HookDeletePolicyAnnotation),
+		reconciler.WithHookTimeout(viper.GetDuration("HOOK_TIMEOUT")),
+		reconciler.WithWaveHealthGate(viper.GetDuration("WAVE_HEALTH_TIMEOUT")),
+		reconciler.WithHealthChecker(healthChecker),
+		reconciler.WithPreloadGroupKinds(settings.GetGroupKinds("CACHE_KINDS")...),
+		reconciler.WithPreloadNamespaces(settings.GetList("CACHE_NAMESPACES")...),
+		reconciler.WithMetadataOnly(settings.GetGroupKinds("CACHE_METADATA_ONLY_KINDS")...),
+		reconciler.WithMaxAnnotationSize(viper.GetInt("CACHE_MAX_ANNOTATION_SIZE")),
+		reconciler.WithDiscoveryRefreshInterval(viper.GetDuration("DISCOVERY_REFRESH_INTERVAL")),
+		reconciler.WithMeter(meter),
+	)
 
-		return isControlled
-	}, true)
+	err = k8sReconciler.Preload(context.Background(), annotation.IsControlled, true)
 	if err != nil {
 		panic(err)
 	}
@@ -78,14 +119,27 @@ func main() {
 		logger,
 		mgr.GetClient(),
 		mgr.GetScheme(),
-		gitManager,
 		templateManager,
+		routingManager,
 		k8sReconciler,
+		k8scontrollers.WithResourceEvents(resourceEvents),
+		k8scontrollers.WithResyncInterval(viper.GetDuration("CIRCLE_RESYNC_INTERVAL")),
 	)
 	if err := k8sCircleController.SetupWithManager(mgr); err != nil {
 		panic(err)
 	}
 
+	k8sModuleController := k8scontrollers.NewModuleController(
+		logger,
+		mgr.GetClient(),
+		mgr.GetScheme(),
+		gitManager,
+		templateManager,
+	)
+	if err := k8sModuleController.SetupWithManager(mgr); err != nil {
+		panic(err)
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		panic(err)
 	}
@@ -106,6 +160,22 @@ func main() {
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 		panic(err)
 	}
+
+	if persistentCache, ok := clusterCache.(cache.PersistentCache); ok {
+		if err := persistentCache.Close(); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// newClusterCache keeps the cluster cache in memory, or persists it to the
+// file at path so restarts resume watches instead of listing every resource.
+func newClusterCache(path string) (cache.Cache, error) {
+	if path == "" {
+		return cache.NewLocalCache(), nil
+	}
+
+	return cache.NewBoltCache(path)
 }
 
 func tmpMetrics() {
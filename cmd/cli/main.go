@@ -1,8 +1,15 @@
 package main
 
-import "github.com/spf13/cobra"
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+)
 
 func main() {
 	var rootCmd = &cobra.Command{Use: "app"}
-	rootCmd.Execute()
+	rootCmd.AddCommand(newPreviewCmd())
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/octopipe/circlerr/internal/domain"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+type previewOptions struct {
+	server    string
+	workspace string
+	filename  string
+}
+
+func newPreviewCmd() *cobra.Command {
+	opts := previewOptions{}
+	cmd := &cobra.Command{
+		Use:   "preview CIRCLE",
+		Short: "Show the changes a circle spec would make without applying it",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPreview(cmd.OutOrStdout(), opts, args[0])
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.server, "server", "http://localhost:8080", "address of the moove server")
+	cmd.Flags().StringVarP(&opts.workspace, "workspace", "w", "", "workspace of the circle")
+	cmd.Flags().StringVarP(&opts.filename, "filename", "f", "", "file with the candidate circle spec")
+	_ = cmd.MarkFlagRequired("workspace")
+	_ = cmd.MarkFlagRequired("filename")
+
+	return cmd
+}
+
+func runPreview(out io.Writer, opts previewOptions, circleName string) error {
+	rawCircle, err := os.ReadFile(opts.filename)
+	if err != nil {
+		return err
+	}
+
+	body, err := yaml.YAMLToJSON(rawCircle)
+	if err != nil {
+		return err
+	}
+
+	previewURL := fmt.Sprintf("%s/workspaces/%s/circles/%s/preview", opts.server, url.PathEscape(opts.workspace), url.PathEscape(circleName))
+	resp, err := http.Post(previewURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		errResponse := struct {
+			Message string `json:"message"`
+		}{}
+		if err := json.NewDecoder(resp.Body).Decode(&errResponse); err != nil || errResponse.Message == "" {
+			return fmt.Errorf("preview failed with status %s", resp.Status)
+		}
+
+		return errors.New(errResponse.Message)
+	}
+
+	preview := domain.CirclePreview{}
+	if err := json.NewDecoder(resp.Body).Decode(&preview); err != nil {
+		return err
+	}
+
+	printPreview(out, preview)
+	return nil
+}
+
+func printPreview(out io.Writer, preview domain.CirclePreview) {
+	for _, res := range preview.Resources {
+		fmt.Fprintf(out, "%s %s %s/%s\n", res.Action, res.Kind, res.Namespace, res.Name)
+		if res.Error != "" {
+			fmt.Fprintf(out, "error: %s\n", res.Error)
+		}
+		for _, line := range res.Diff {
+			fmt.Fprintln(out, line)
+		}
+	}
+}
@@ -1,22 +1,119 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-logr/zapr"
+	"github.com/go-playground/validator/v10"
+	"github.com/joho/godotenv"
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"github.com/octopipe/circlerr/internal/gitmanager"
+	"github.com/octopipe/circlerr/internal/httphandlers"
+	"github.com/octopipe/circlerr/internal/previewmanager"
+	"github.com/octopipe/circlerr/internal/routingmanager"
+	"github.com/octopipe/circlerr/internal/templatemanager"
+	"github.com/octopipe/circlerr/internal/utils/annotation"
+	"github.com/octopipe/circlerr/internal/utils/settings"
+	"github.com/octopipe/circlerr/pkg/twice/cache"
+	"github.com/octopipe/circlerr/pkg/twice/reconciler"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+var (
+	scheme = runtime.NewScheme()
+)
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(circlerriov1alpha1.AddToScheme(scheme))
+}
+
 func main() {
+	_ = godotenv.Load()
+	viper.AutomaticEnv()
+	viper.SetDefault("SERVER_PORT", "8080")
+	// SERVER_SIDE is opt-in, butler and moove must be set with the same strategy.
+	viper.SetDefault("APPLY_STRATEGY", reconciler.ClientSideApplyStrategy)
+	viper.SetDefault("PREVIEW_CACHE_KINDS", "Deployment.apps,StatefulSet.apps,DaemonSet.apps,Job.batch,CronJob.batch,Service,ConfigMap,Secret,ServiceAccount,PersistentVolumeClaim,Ingress.networking.k8s.io,HorizontalPodAutoscaler.autoscaling")
+	viper.SetDefault("CACHE_METADATA_ONLY_KINDS", "Pod,ReplicaSet.apps,Endpoints,EndpointSlice.discovery.k8s.io,Lease.coordination.k8s.io")
+	viper.SetDefault("CACHE_MAX_ANNOTATION_SIZE", 16384)
+
 	logger, _ := zap.NewProduction()
 	defer logger.Sync()
 
+	if err := run(logger); err != nil {
+		logger.Fatal("failed to run moove", zap.Error(err))
+	}
+}
+
+func run(logger *zap.Logger) error {
+	config, err := ctrl.GetConfig()
+	if err != nil {
+		return err
+	}
+
+	k8sClient, err := client.New(config, client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+
+	// The preview reconciler only plans circles, it keeps its own cache of the
+	// live objects and never applies them. It plans with the apply strategy of
+	// butler, caching only the kinds circles usually deploy, objects of other
+	// kinds are previewed as created.
+	clusterCache := cache.NewLocalCache()
+	previewReconciler := reconciler.NewReconciler(
+		zapr.NewLogger(logger),
+		config,
+		clusterCache,
+		reconciler.WithApplyStrategy(viper.GetString("APPLY_STRATEGY")),
+		reconciler.WithFieldManager("circlerr"),
+		reconciler.WithPreloadGroupKinds(settings.GetGroupKinds("PREVIEW_CACHE_KINDS")...),
+		reconciler.WithPreloadNamespaces(settings.GetList("CACHE_NAMESPACES")...),
+		reconciler.WithMetadataOnly(settings.GetGroupKinds("CACHE_METADATA_ONLY_KINDS")...),
+		reconciler.WithMaxAnnotationSize(viper.GetInt("CACHE_MAX_ANNOTATION_SIZE")),
+	)
+	if err := previewReconciler.Preload(context.Background(), annotation.IsControlled, true); err != nil {
+		return err
+	}
+
+	routingProvider, err := routingmanager.NewProvider(os.Getenv("ROUTING_PROVIDER"))
+	if err != nil {
+		return err
+	}
+
+	gitManager := gitmanager.NewManager(k8sClient)
+	previewManager := previewmanager.NewPreviewManager(
+		templatemanager.NewTemplateManager(k8sClient, gitManager),
+		routingmanager.NewRoutingManager(k8sClient, clusterCache, routingProvider),
+		previewReconciler,
+	)
+
+	validator := validator.New()
+
 	router := gin.Default()
 	router.Use()
 
+	workspaceHandler := httphandlers.NewWorkspaceHandler(logger, k8sClient, validator)
+	workspaceHandler.Register(&router.RouterGroup)
+
+	workspaceRouter := router.Group("/workspaces/:workspace_id", workspaceHandler.Scope())
+	httphandlers.NewCircleHandler(logger, k8sClient, validator).Register(workspaceRouter)
+	httphandlers.NewModuleHandler(logger, k8sClient, validator).Register(workspaceRouter)
+	httphandlers.NewResourceHandler(logger, k8sClient).Register(workspaceRouter)
+	httphandlers.NewPreviewHandler(logger, k8sClient, validator, previewManager).Register(workspaceRouter)
+
 	serverPort := fmt.Sprintf(":%s", viper.GetString("SERVER_PORT"))
 	s := &http.Server{
 		Addr:           serverPort,
@@ -26,7 +123,5 @@ func main() {
 		MaxHeaderBytes: 1 << 20,
 	}
 
-	if err := s.ListenAndServe(); err != nil {
-		panic(err)
-	}
+	return s.ListenAndServe()
 }
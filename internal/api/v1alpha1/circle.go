@@ -1,54 +1,126 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	SyncedStatus = "SYNCED"
+	FailedStatus = "FAILED"
+)
+
+const (
+	ReadyCondition    = "Ready"
+	SyncedCondition   = "Synced"
+	DegradedCondition = "Degraded"
+)
+
 type Override struct {
 	Key   string `json:"key,omitempty"`
 	Value string `json:"value,omitempty"`
 }
 
+// KustomizeImage replaces the name, tag or digest of the images of a
+// KUSTOMIZE module.
+type KustomizeImage struct {
+	Name    string `json:"name,omitempty" validate:"required"`
+	NewName string `json:"newName,omitempty"`
+	NewTag  string `json:"newTag,omitempty"`
+	Digest  string `json:"digest,omitempty"`
+}
+
+// KustomizePatchTarget selects the objects a patch is applied to.
+type KustomizePatchTarget struct {
+	Group              string `json:"group,omitempty"`
+	Version            string `json:"version,omitempty"`
+	Kind               string `json:"kind,omitempty"`
+	Name               string `json:"name,omitempty"`
+	Namespace          string `json:"namespace,omitempty"`
+	LabelSelector      string `json:"labelSelector,omitempty"`
+	AnnotationSelector string `json:"annotationSelector,omitempty"`
+}
+
+// KustomizePatch is a strategic merge or JSON 6902 patch, patches without
+// target are applied to the object they name.
+type KustomizePatch struct {
+	Patch  string                `json:"patch,omitempty" validate:"required"`
+	Target *KustomizePatchTarget `json:"target,omitempty"`
+}
+
+// CircleModuleKustomize customizes a KUSTOMIZE module with an overlay generated
+// on top of the module path.
+type CircleModuleKustomize struct {
+	NamePrefix   string            `json:"namePrefix,omitempty"`
+	CommonLabels map[string]string `json:"commonLabels,omitempty"`
+	Images       []KustomizeImage  `json:"images,omitempty" validate:"dive"`
+	Patches      []KustomizePatch  `json:"patches,omitempty" validate:"dive"`
+}
+
+// CircleModuleHelm sets the values a HELM module is rendered with in the
+// circle, they take precedence over the values of the module.
+type CircleModuleHelm struct {
+	ValuesFrom []HelmValuesSource `json:"valuesFrom,omitempty" validate:"dive"`
+	// Values is a YAML document of values.
+	Values string `json:"values,omitempty"`
+	// Set overrides values by key like helm --set, e.g. image.tag.
+	Set []Override `json:"set,omitempty"`
+}
+
 type CircleModule struct {
-	Name      string     `json:"name,omitempty" validate:"required"`
-	Revision  string     `json:"revision,omitempty"`
-	Overrides []Override `json:"overrides,omitempty"`
-	Namespace string     `json:"namespace,omitempty" validate:"required"`
+	Name      string                 `json:"name,omitempty" validate:"required"`
+	Revision  string                 `json:"revision,omitempty"`
+	Overrides []Override             `json:"overrides,omitempty"`
+	Kustomize *CircleModuleKustomize `json:"kustomize,omitempty"`
+	Helm      *CircleModuleHelm      `json:"helm,omitempty"`
+	Namespace string                 `json:"namespace,omitempty" validate:"required"`
+}
+
+// CircleEnvironmentSource references the value of an environment variable
+// stored in a ConfigMap or Secret of the namespace the circle deploys to.
+type CircleEnvironmentSource struct {
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty" validate:"required_without=SecretKeyRef,excluded_with=SecretKeyRef"`
+	SecretKeyRef    *corev1.SecretKeySelector    `json:"secretKeyRef,omitempty"`
 }
 
 type CircleEnvironments struct {
-	Key   string `json:"key,omitempty" validate:"key"`
-	Value string `json:"value,omitempty" validate:"value"`
+	Key       string                   `json:"key,omitempty" validate:"required"`
+	Value     string                   `json:"value,omitempty" validate:"excluded_with=ValueFrom"`
+	ValueFrom *CircleEnvironmentSource `json:"valueFrom,omitempty"`
 }
 
 type CircleMatch struct {
-	Headers map[string]string `json:"headers,omitempty"`
+	Headers map[string]string `json:"headers,omitempty" validate:"required,min=1"`
 }
 
 type CircleSegment struct {
-	Key       string `json:"key,omitempty" validate:"key"`
-	Value     string `json:"value,omitempty" validate:"value"`
-	Condition string `json:"condition,omitempty" validate:"condition"`
+	Key       string `json:"key,omitempty" validate:"required"`
+	Value     string `json:"value,omitempty" validate:"required"`
+	Condition string `json:"condition,omitempty" validate:"required"`
 }
 
 type CanaryDeployStrategy struct {
-	Weight int `json:"weight" validate:"weight"`
+	Weight int `json:"weight" validate:"min=0,max=100"`
 }
 
 type CircleRouting struct {
 	Strategy string                `json:"strategy,omitempty" validate:"oneof=DEFAULT MATCH CANARY,required"`
-	Canary   *CanaryDeployStrategy `json:"canary,omitempty"`
-	Match    *CircleMatch          `json:"match,omitempty"`
-	Segments []*CircleSegment      `json:"segments,omitempty"`
+	Canary   *CanaryDeployStrategy `json:"canary,omitempty" validate:"required_if=Strategy CANARY"`
+	Match    *CircleMatch          `json:"match,omitempty" validate:"required_if=Strategy MATCH"`
+	Segments []*CircleSegment      `json:"segments,omitempty" validate:"dive"`
 }
 
 type CircleSpec struct {
-	Author      string `json:"author,omitempty" default:"anonymous"`
-	Description string `json:"description,omitempty"`
-	Namespace   string `json:"namespace,omitempty" validate:"required"`
-	// Routing      CircleRouting        `json:"routing,omitempty"`
-	Modules      []CircleModule       `json:"modules,omitempty"`
-	Environments []CircleEnvironments `json:"environments,omitempty"`
+	Author       string               `json:"author,omitempty" default:"anonymous"`
+	Description  string               `json:"description,omitempty"`
+	Namespace    string               `json:"namespace,omitempty" validate:"required"`
+	Routing      CircleRouting        `json:"routing,omitempty"`
+	Modules      []CircleModule       `json:"modules,omitempty" validate:"dive"`
+	Environments []CircleEnvironments `json:"environments,omitempty" validate:"dive"`
+	// DeletionPolicy decides what happens to the resources of the circle when
+	// it is deleted, DELETE is used when empty.
+	// +kubebuilder:validation:Enum=DELETE;ORPHAN;KEEP_PVCS
+	DeletionPolicy string `json:"deletionPolicy,omitempty" validate:"omitempty,oneof=DELETE ORPHAN KEEP_PVCS"`
 }
 
 type CircleStatusHistory struct {
@@ -65,9 +137,11 @@ type CircleResourceModule struct {
 }
 
 type CircleResourceStatus struct {
-	SyncedAt   string `json:"syncTime,omitempty"`
-	SyncStatus string `json:"syncStatus,omitempty"`
-	Error      string `json:"error,omitempty"`
+	SyncedAt      string `json:"syncTime,omitempty"`
+	SyncStatus    string `json:"syncStatus,omitempty"`
+	Error         string `json:"error,omitempty"`
+	HealthStatus  string `json:"healthStatus,omitempty"`
+	HealthMessage string `json:"healthMessage,omitempty"`
 }
 
 type CircleStatusResource struct {
@@ -80,11 +154,15 @@ type CircleStatusResource struct {
 }
 
 type CircleStatus struct {
-	History    []CircleStatusHistory  `json:"history,omitempty"`
-	SyncStatus string                 `json:"syncStatus,omitempty"`
-	SyncedAt   string                 `json:"syncTime,omitempty"`
-	Resources  []CircleStatusResource `json:"resources,omitempty"`
-	Error      string                 `json:"error,omitempty"`
+	History      []CircleStatusHistory  `json:"history,omitempty"`
+	SyncStatus   string                 `json:"syncStatus,omitempty"`
+	SyncedAt     string                 `json:"syncTime,omitempty"`
+	HealthStatus string                 `json:"healthStatus,omitempty"`
+	Resources    []CircleStatusResource `json:"resources,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -1,6 +1,7 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -19,20 +20,68 @@ type SecretRef struct {
 	Namespace string `json:"namespace,omitempty"`
 }
 
+// HelmValuesSource references values stored as YAML in a ConfigMap or Secret
+// key of the namespace of the object declaring it.
+type HelmValuesSource struct {
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty" validate:"required_without=SecretKeyRef,excluded_with=SecretKeyRef"`
+	SecretKeyRef    *corev1.SecretKeySelector    `json:"secretKeyRef,omitempty"`
+}
+
+// ModuleHelm sets the values HELM modules are rendered with on top of the
+// values of the chart.
+type ModuleHelm struct {
+	// ValueFiles are paths relative to the chart, they must be inside the
+	// repository.
+	ValueFiles []string           `json:"valueFiles,omitempty"`
+	ValuesFrom []HelmValuesSource `json:"valuesFrom,omitempty" validate:"dive"`
+	// Values is a YAML document of values.
+	Values string `json:"values,omitempty"`
+	// RunTests runs the test hooks of the chart after every sync, they are
+	// not rendered otherwise.
+	RunTests bool `json:"runTests,omitempty"`
+}
+
+// ChartSource locates the chart of a HELM module published to a chart
+// repository or an OCI registry, the module path is not rendered then.
+type ChartSource struct {
+	// RepoURL is the URL of a chart repository, or an oci:// reference to the
+	// registry repository holding the chart.
+	RepoURL string `json:"repoURL,omitempty" validate:"required"`
+	Chart   string `json:"chart,omitempty" validate:"required"`
+	// Version is a version or a semver constraint, the latest version is used
+	// when empty.
+	Version string `json:"version,omitempty"`
+	// SecretRef references a secret with the username and password of the
+	// repository.
+	SecretRef *SecretRef `json:"secretRef,omitempty"`
+}
+
 type ModuleSpec struct {
 	Author       string      `json:"author,omitempty"`
 	Description  string      `json:"description,omitempty"`
 	SecretRef    *SecretRef  `json:"secretRef,omitempty"`
 	Path         string      `json:"path,omitempty"`
-	Url          string      `json:"url,omitempty"`
-	TemplateType string      `json:"templateType,omitempty"`
+	Url          string      `json:"url,omitempty" validate:"required_without=Chart"`
+	TemplateType string      `json:"templateType,omitempty" validate:"required,oneof=SIMPLE HELM KUSTOMIZE"`
 	Auth         *ModuleAuth `json:"auth,omitempty"`
+	Helm         *ModuleHelm `json:"helm,omitempty"`
+	// Chart is the source of the chart of HELM modules that are not in the
+	// repository, Url is optional then.
+	Chart *ChartSource `json:"chart,omitempty"`
 }
 
 // ModuleStatus defines the observed state of Module
 type ModuleStatus struct {
-	Status string `json:"status,omitempty"`
-	Error  string `json:"error,omitempty"`
+	Status            string   `json:"status,omitempty"`
+	Error             string   `json:"error,omitempty"`
+	DefaultRef        string   `json:"defaultRef,omitempty"`
+	Branches          []string `json:"branches,omitempty"`
+	Tags              []string `json:"tags,omitempty"`
+	LastFetchedCommit string   `json:"lastFetchedCommit,omitempty"`
+	LastFetchedAt     string   `json:"lastFetchedAt,omitempty"`
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -2,7 +2,47 @@ package domain
 
 import "github.com/octopipe/circlerr/internal/api/v1alpha1"
 
+const (
+	DefaultRoutingStrategy = "DEFAULT"
+	MatchRoutingStrategy   = "MATCH"
+	CanaryRoutingStrategy  = "CANARY"
+)
+
+const (
+	DeleteDeletionPolicy   = "DELETE"
+	OrphanDeletionPolicy   = "ORPHAN"
+	KeepPVCsDeletionPolicy = "KEEP_PVCS"
+)
+
+const (
+	IstioRoutingProvider      = "ISTIO"
+	GatewayAPIRoutingProvider = "GATEWAY_API"
+	NginxRoutingProvider      = "NGINX"
+)
+
 type Circle struct {
-	Name string `json:"name"`
+	Name string `json:"name" validate:"required"`
 	v1alpha1.CircleSpec
 }
+
+type CircleModel struct {
+	Circle
+	CreatedAt string                `json:"createdAt"`
+	Status    v1alpha1.CircleStatus `json:"status"`
+}
+
+// CirclePreviewResource is a change a circle would make to one of its objects.
+type CirclePreviewResource struct {
+	Group     string   `json:"group"`
+	Version   string   `json:"version"`
+	Kind      string   `json:"kind"`
+	Name      string   `json:"name"`
+	Namespace string   `json:"namespace"`
+	Action    string   `json:"action"`
+	Diff      []string `json:"diff"`
+	Error     string   `json:"error,omitempty"`
+}
+
+type CirclePreview struct {
+	Resources []CirclePreviewResource `json:"resources"`
+}
@@ -3,11 +3,18 @@ package domain
 import "github.com/octopipe/circlerr/internal/api/v1alpha1"
 
 const (
-	SimpleModuleTemplateType = "SIMPLE"
-	HelmModuleTemplateType   = "HELM"
+	SimpleModuleTemplateType    = "SIMPLE"
+	HelmModuleTemplateType      = "HELM"
+	KustomizeModuleTemplateType = "KUSTOMIZE"
 )
 
 type Module struct {
-	Name string `json:"name"`
+	Name string `json:"name" validate:"required"`
 	v1alpha1.ModuleSpec
 }
+
+type ModuleModel struct {
+	Module
+	CreatedAt string                `json:"createdAt"`
+	Status    v1alpha1.ModuleStatus `json:"status"`
+}
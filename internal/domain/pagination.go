@@ -0,0 +1,12 @@
+package domain
+
+type Pagination struct {
+	Limit    int64  `form:"limit"`
+	Continue string `form:"continue"`
+}
+
+type PaginationResponse[T any] struct {
+	Limit    int64  `json:"limit"`
+	Continue string `json:"continue"`
+	Items    []T    `json:"items"`
+}
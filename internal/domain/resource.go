@@ -0,0 +1,24 @@
+package domain
+
+type Resource struct {
+	Group     string      `json:"group"`
+	Version   string      `json:"version"`
+	Kind      string      `json:"kind"`
+	Name      string      `json:"name"`
+	Namespace string      `json:"namespace"`
+	Object    interface{} `json:"object,omitempty"`
+}
+
+type ResourceTree struct {
+	Resource
+	Children []ResourceTree `json:"children"`
+}
+
+type Event struct {
+	Type      string `json:"type"`
+	Reason    string `json:"reason"`
+	Message   string `json:"message"`
+	Count     int32  `json:"count"`
+	FirstTime string `json:"firstTime"`
+	LastTime  string `json:"lastTime"`
+}
@@ -9,5 +9,11 @@ const (
 type Workspace struct {
 	Name        string `json:"name" validate:"required"`
 	Description string `json:"description"`
-	Type        string `json:"type" default:"DEFAULT"`
+	Type        string `json:"type" default:"DEFAULT" validate:"omitempty,oneof=DEFAULT MATCH CANARY"`
+}
+
+type WorkspaceModel struct {
+	Workspace
+	ID        string `json:"id"`
+	CreatedAt string `json:"createdAt"`
 }
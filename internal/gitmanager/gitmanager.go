@@ -5,9 +5,18 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
@@ -23,17 +32,86 @@ const (
 	accessTokenAuthType = "ACCESS_TOKEN"
 )
 
+const defaultMaxRevisions = 10
+
+// Revision is a module repository checked out at a specific commit. Its
+// worktree is kept until Release is called.
+type Revision struct {
+	Commit  string
+	Path    string
+	release func()
+}
+
+// Release lets the worktree of the revision be pruned by later syncs.
+func (r Revision) Release() {
+	if r.release != nil {
+		r.release()
+	}
+}
+
+// Refs are the branches and tags available in a module repository.
+type Refs struct {
+	Default  string
+	Branches []string
+	Tags     []string
+}
+
 type Manager interface {
-	Sync(module circlerriov1alpha1.Module) error
+	Sync(module circlerriov1alpha1.Module, revision string) (Revision, error)
+	SyncDefault(module circlerriov1alpha1.Module) (Revision, Refs, error)
 }
 
 type manager struct {
 	client.Client
+	// locks holds a mutex per repository path, fetches of different
+	// repositories run concurrently.
+	locks *sync.Map
+	// inUse counts the unreleased revisions of each worktree path.
+	inUse        *worktreeRefs
+	maxRevisions int
+}
+
+type worktreeRefs struct {
+	mu    sync.Mutex
+	count map[string]int
 }
 
+func (w *worktreeRefs) acquire(path string) func() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.count[path]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			if w.count[path]--; w.count[path] <= 0 {
+				delete(w.count, path)
+			}
+		})
+	}
+}
+
+func (w *worktreeRefs) isUsed(path string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.count[path] > 0
+}
+
+// NewManager returns a manager keeping the worktrees of the last
+// GIT_MAX_REVISIONS commits synced of each repository.
 func NewManager(client client.Client) Manager {
+	maxRevisions, err := strconv.Atoi(os.Getenv("GIT_MAX_REVISIONS"))
+	if err != nil || maxRevisions <= 0 {
+		maxRevisions = defaultMaxRevisions
+	}
+
 	return manager{
-		Client: client,
+		Client:       client,
+		locks:        &sync.Map{},
+		inUse:        &worktreeRefs{count: map[string]int{}},
+		maxRevisions: maxRevisions,
 	}
 }
 
@@ -135,46 +213,349 @@ func (r *manager) getAuthMethodBySecret(secret apiv1.Secret) (transport.AuthMeth
 	return nil, errors.New("invalid auth type")
 }
 
-func (r manager) Sync(module circlerriov1alpha1.Module) error {
-	gitCloneConfig := &git.CloneOptions{
+func (r manager) getAuthMethodByModule(module circlerriov1alpha1.Module) (transport.AuthMethod, error) {
+	if module.Spec.SecretRef == nil {
+		return nil, nil
+	}
+
+	secretRef := *module.Spec.SecretRef
+	if secretRef.Namespace == "" {
+		secretRef.Namespace = module.GetNamespace()
+	}
+
+	secret, err := r.getSecretByModule(secretRef)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.getAuthMethodBySecret(secret)
+}
+
+// Sync fetches the module repository and checks out the requested branch, tag
+// or commit SHA into a worktree shared by every circle pinned to that commit.
+// An empty revision or HEAD resolves to the default branch of the repository.
+// The worktrees of the commits synced least recently are removed unless a
+// returned revision still uses them, callers must release the revision once
+// they are done reading its worktree.
+func (r manager) Sync(module circlerriov1alpha1.Module, revision string) (Revision, error) {
+	unlock := r.lock(module.Spec.Url)
+	defer unlock()
+
+	repo, err := r.fetch(module)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	return r.checkoutRevision(module, repo, revision)
+}
+
+// SyncDefault fetches the module repository once to list its refs and check
+// out its default branch like Sync does.
+func (r manager) SyncDefault(module circlerriov1alpha1.Module) (Revision, Refs, error) {
+	unlock := r.lock(module.Spec.Url)
+	defer unlock()
+
+	repo, err := r.fetch(module)
+	if err != nil {
+		return Revision{}, Refs{}, err
+	}
+
+	refs, err := listRefs(repo)
+	if err != nil {
+		return Revision{}, Refs{}, err
+	}
+
+	revision, err := r.checkoutRevision(module, repo, refs.Default)
+	if err != nil {
+		return Revision{}, Refs{}, err
+	}
+
+	return revision, refs, nil
+}
+
+func (r manager) checkoutRevision(module circlerriov1alpha1.Module, repo *git.Repository, revision string) (Revision, error) {
+	hash, err := resolveRevision(repo, revision)
+	if err != nil {
+		return Revision{}, fmt.Errorf("failed to resolve revision %q of %s: %w", revision, module.Spec.Url, err)
+	}
+
+	worktreePath, err := checkout(repo, getRepositoryPath(module.Spec.Url), hash)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	now := time.Now()
+	if err := os.Chtimes(worktreePath, now, now); err != nil {
+		return Revision{}, err
+	}
+
+	release := r.inUse.acquire(worktreePath)
+	if err := pruneRevisions(filepath.Dir(worktreePath), r.maxRevisions, r.inUse.isUsed); err != nil {
+		release()
+		return Revision{}, err
+	}
+
+	return Revision{Commit: hash.String(), Path: worktreePath, release: release}, nil
+}
+
+// listRefs lists the default branch of the repository and the branches and
+// tags it currently has.
+func listRefs(repo *git.Repository) (Refs, error) {
+	head, err := repo.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return Refs{}, err
+	}
+
+	references, err := repo.References()
+	if err != nil {
+		return Refs{}, err
+	}
+
+	branches := map[string]bool{}
+	tags := []string{}
+	remotePrefix := fmt.Sprintf("%s/", git.DefaultRemoteName)
+	err = references.ForEach(func(ref *plumbing.Reference) error {
+		switch {
+		case ref.Name().IsBranch():
+			branches[ref.Name().Short()] = true
+		case ref.Name().IsRemote() && ref.Type() == plumbing.HashReference:
+			branches[strings.TrimPrefix(ref.Name().Short(), remotePrefix)] = true
+		case ref.Name().IsTag():
+			tags = append(tags, ref.Name().Short())
+		}
+
+		return nil
+	})
+	if err != nil {
+		return Refs{}, err
+	}
+
+	refs := Refs{Default: head.Target().Short(), Branches: []string{}, Tags: tags}
+	for branch := range branches {
+		refs.Branches = append(refs.Branches, branch)
+	}
+
+	sort.Strings(refs.Branches)
+	sort.Strings(refs.Tags)
+	return refs, nil
+}
+
+// lock locks the repository of url, only one fetch or checkout runs at a time
+// on the same repository.
+func (r manager) lock(url string) func() {
+	mu, _ := r.locks.LoadOrStore(getRepositoryPath(url), &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+func (r manager) fetch(module circlerriov1alpha1.Module) (*git.Repository, error) {
+	authMethod, err := r.getAuthMethodByModule(module)
+	if err != nil {
+		return nil, err
+	}
+
+	storagePath := filepath.Join(getRepositoryPath(module.Spec.Url), "repository")
+	repo, err := git.PlainClone(storagePath, true, &git.CloneOptions{
 		URL:  module.Spec.Url,
-		Auth: nil,
+		Auth: authMethod,
+		Tags: git.AllTags,
+	})
+	if err == nil {
+		return repo, nil
+	}
+
+	if !errors.Is(err, git.ErrRepositoryAlreadyExists) {
+		return nil, err
 	}
 
-	if module.Spec.SecretRef != nil {
-		secret, err := r.getSecretByModule(*module.Spec.SecretRef)
+	repo, err = git.PlainOpen(storagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = repo.Fetch(&git.FetchOptions{
+		RemoteName: git.DefaultRemoteName,
+		RefSpecs:   []config.RefSpec{config.RefSpec(fmt.Sprintf(config.DefaultFetchRefSpec, git.DefaultRemoteName))},
+		Auth:       authMethod,
+		Tags:       git.AllTags,
+		Force:      true,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+func resolveRevision(repo *git.Repository, revision string) (plumbing.Hash, error) {
+	if revision == "" || revision == plumbing.HEAD.String() {
+		head, err := repo.Reference(plumbing.HEAD, false)
 		if err != nil {
-			return err
+			return plumbing.ZeroHash, err
+		}
+
+		revision = head.Target().Short()
+	}
+
+	// Remote branches are tried first because local branches of the clone are
+	// never moved by later fetches.
+	remoteRevision := plumbing.Revision(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, revision))
+	if hash, err := repo.ResolveRevision(remoteRevision); err == nil {
+		return *hash, nil
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return *hash, nil
+}
+
+// checkout writes the tree of the commit into its own directory. Worktrees are
+// immutable once written, so they are reused across syncs of the same commit.
+func checkout(repo *git.Repository, repositoryPath string, hash plumbing.Hash) (string, error) {
+	revisionsPath := filepath.Join(repositoryPath, "revisions")
+	worktreePath := filepath.Join(revisionsPath, hash.String())
+	if _, err := os.Stat(worktreePath); err == nil {
+		return worktreePath, nil
+	}
+
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return "", err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(revisionsPath, 0755); err != nil {
+		return "", err
+	}
+
+	tmpPath, err := os.MkdirTemp(revisionsPath, fmt.Sprintf("%s-", hash.String()))
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpPath)
+
+	symlinks := []string{}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if f.Mode == filemode.Symlink {
+			symlinks = append(symlinks, f.Name)
+		}
+
+		return writeFile(tmpPath, f)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := checkSymlinks(tmpPath, symlinks); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(tmpPath, worktreePath); err != nil {
+		return "", err
+	}
+
+	return worktreePath, nil
+}
+
+// pruneRevisions removes the worktrees beyond the ones synced most recently,
+// Sync touches the worktree it returns. Worktrees still used are kept.
+func pruneRevisions(revisionsPath string, keep int, isUsed func(path string) bool) error {
+	entries, err := os.ReadDir(revisionsPath)
+	if err != nil {
+		return err
+	}
+
+	worktrees := []os.FileInfo{}
+	for _, entry := range entries {
+		// Checkouts in progress are written to temporary directories.
+		if !entry.IsDir() || !plumbing.IsHash(entry.Name()) {
+			continue
 		}
-		authMethod, err := r.getAuthMethodBySecret(secret)
+
+		info, err := entry.Info()
 		if err != nil {
+			continue
+		}
+
+		worktrees = append(worktrees, info)
+	}
+
+	if len(worktrees) <= keep {
+		return nil
+	}
+
+	sort.Slice(worktrees, func(i, j int) bool {
+		return worktrees[i].ModTime().After(worktrees[j].ModTime())
+	})
+
+	for _, info := range worktrees[keep:] {
+		path := filepath.Join(revisionsPath, info.Name())
+		if isUsed(path) {
+			continue
+		}
+
+		if err := os.RemoveAll(path); err != nil {
 			return err
 		}
-		gitCloneConfig.Auth = authMethod
 	}
 
-	repositoryPath := fmt.Sprintf("%s/%s", os.Getenv("GIT_TMP_DIR"), module.Spec.Url)
-	repo, err := git.PlainClone(repositoryPath, false, gitCloneConfig)
-	if err != nil && !strings.Contains(err.Error(), "already exists") {
+	return nil
+}
+
+// checkSymlinks rejects worktrees with symlinks resolving outside of them,
+// renders read the files of worktrees and must never reach the files of the
+// controller, like its service account token.
+func checkSymlinks(worktreePath string, names []string) error {
+	root, err := filepath.EvalSymlinks(worktreePath)
+	if err != nil {
 		return err
 	}
 
-	if err != nil && strings.Contains(err.Error(), "already exists") {
-		repo, err = git.PlainOpen(repositoryPath)
+	for _, name := range names {
+		target, err := filepath.EvalSymlinks(filepath.Join(worktreePath, name))
 		if err != nil {
-			return err
+			return fmt.Errorf("invalid symlink %s: %w", name, err)
+		}
+
+		rel, err := filepath.Rel(root, target)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("symlink %s points outside of the repository", name)
 		}
 	}
 
-	w, err := repo.Worktree()
+	return nil
+}
+
+func writeFile(worktreePath string, f *object.File) error {
+	path := filepath.Join(worktreePath, f.Name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	contents, err := f.Contents()
 	if err != nil {
 		return err
 	}
 
-	err = w.Pull(&git.PullOptions{RemoteName: "origin"})
-	if err != nil && !strings.Contains(err.Error(), "already up-to-date") {
+	if f.Mode == filemode.Symlink {
+		return os.Symlink(contents, path)
+	}
+
+	mode, err := f.Mode.ToOSFileMode()
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return os.WriteFile(path, []byte(contents), mode.Perm())
+}
+
+func getRepositoryPath(url string) string {
+	return filepath.Join(os.Getenv("GIT_TMP_DIR"), url)
 }
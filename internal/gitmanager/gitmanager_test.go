@@ -0,0 +1,255 @@
+package gitmanager
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type GitManagerTestSuite struct {
+	suite.Suite
+	manager        Manager
+	module         circlerriov1alpha1.Module
+	repo           *git.Repository
+	repositoryPath string
+}
+
+func (s *GitManagerTestSuite) SetupTest() {
+	s.T().Setenv("GIT_TMP_DIR", s.T().TempDir())
+
+	s.repositoryPath = s.T().TempDir()
+	repo, err := git.PlainInit(s.repositoryPath, false)
+	assert.NoError(s.T(), err)
+	s.repo = repo
+
+	s.manager = NewManager(nil)
+	s.module = circlerriov1alpha1.Module{
+		Spec: circlerriov1alpha1.ModuleSpec{Url: s.repositoryPath, Path: "guestbook"},
+	}
+}
+
+func (s *GitManagerTestSuite) commit(content string) plumbing.Hash {
+	path := filepath.Join(s.repositoryPath, "guestbook", "deployment.yaml")
+	assert.NoError(s.T(), os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(s.T(), os.WriteFile(path, []byte(content), 0644))
+
+	w, err := s.repo.Worktree()
+	assert.NoError(s.T(), err)
+	_, err = w.Add("guestbook/deployment.yaml")
+	assert.NoError(s.T(), err)
+
+	hash, err := w.Commit(content, &git.CommitOptions{
+		Author: &object.Signature{Name: "circlerr", Email: "circlerr@circlerr.io", When: time.Now()},
+	})
+	assert.NoError(s.T(), err)
+	return hash
+}
+
+func (s *GitManagerTestSuite) readWorktree(revision Revision) string {
+	data, err := os.ReadFile(filepath.Join(revision.Path, "guestbook", "deployment.yaml"))
+	assert.NoError(s.T(), err)
+	return string(data)
+}
+
+func (s *GitManagerTestSuite) TestSyncRevisions() {
+	firstCommit := s.commit("revision-1")
+	_, err := s.repo.CreateTag("v1", firstCommit, nil)
+	assert.NoError(s.T(), err)
+
+	w, err := s.repo.Worktree()
+	assert.NoError(s.T(), err)
+	err = w.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("revision-2"), Create: true})
+	assert.NoError(s.T(), err)
+	secondCommit := s.commit("revision-2")
+
+	err = w.Checkout(&git.CheckoutOptions{Branch: plumbing.Master})
+	assert.NoError(s.T(), err)
+
+	head, err := s.manager.Sync(s.module, "")
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), firstCommit.String(), head.Commit)
+	assert.Equal(s.T(), "revision-1", s.readWorktree(head))
+
+	branch, err := s.manager.Sync(s.module, "revision-2")
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), secondCommit.String(), branch.Commit)
+	assert.Equal(s.T(), "revision-2", s.readWorktree(branch))
+	assert.NotEqual(s.T(), head.Path, branch.Path)
+
+	tag, err := s.manager.Sync(s.module, "v1")
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), head.Path, tag.Path)
+
+	sha, err := s.manager.Sync(s.module, secondCommit.String()[:7])
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), branch.Path, sha.Path)
+}
+
+func (s *GitManagerTestSuite) TestSyncFetchesNewCommits() {
+	s.commit("revision-1")
+	_, err := s.manager.Sync(s.module, "HEAD")
+	assert.NoError(s.T(), err)
+
+	newCommit := s.commit("revision-3")
+	revision, err := s.manager.Sync(s.module, "HEAD")
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), newCommit.String(), revision.Commit)
+	assert.Equal(s.T(), "revision-3", s.readWorktree(revision))
+}
+
+func (s *GitManagerTestSuite) TestSyncPrunesRevisions() {
+	s.T().Setenv("GIT_MAX_REVISIONS", "2")
+	s.manager = NewManager(nil)
+
+	revisions := []Revision{}
+	for _, content := range []string{"revision-1", "revision-2", "revision-3"} {
+		hash := s.commit(content)
+		revision, err := s.manager.Sync(s.module, hash.String())
+		assert.NoError(s.T(), err)
+		revision.Release()
+		revisions = append(revisions, revision)
+	}
+
+	_, err := os.Stat(revisions[0].Path)
+	assert.True(s.T(), os.IsNotExist(err))
+	assert.Equal(s.T(), "revision-2", s.readWorktree(revisions[1]))
+	assert.Equal(s.T(), "revision-3", s.readWorktree(revisions[2]))
+
+	revision, err := s.manager.Sync(s.module, revisions[0].Commit)
+	assert.NoError(s.T(), err)
+	revision.Release()
+	assert.Equal(s.T(), "revision-1", s.readWorktree(revision))
+
+	_, err = os.Stat(revisions[1].Path)
+	assert.True(s.T(), os.IsNotExist(err))
+}
+
+func (s *GitManagerTestSuite) TestSyncKeepsUnreleasedRevisions() {
+	s.T().Setenv("GIT_MAX_REVISIONS", "1")
+	s.manager = NewManager(nil)
+
+	first, err := s.manager.Sync(s.module, s.commit("revision-1").String())
+	assert.NoError(s.T(), err)
+
+	second, err := s.manager.Sync(s.module, s.commit("revision-2").String())
+	assert.NoError(s.T(), err)
+	second.Release()
+	assert.Equal(s.T(), "revision-1", s.readWorktree(first))
+
+	first.Release()
+	first.Release()
+	third, err := s.manager.Sync(s.module, s.commit("revision-3").String())
+	assert.NoError(s.T(), err)
+	defer third.Release()
+
+	for _, revision := range []Revision{first, second} {
+		_, err = os.Stat(revision.Path)
+		assert.True(s.T(), os.IsNotExist(err))
+	}
+	assert.Equal(s.T(), "revision-3", s.readWorktree(third))
+}
+
+func (s *GitManagerTestSuite) TestSyncLocksPerRepository() {
+	s.commit("revision-1")
+	unlock := s.manager.(manager).lock("https://github.com/octopipe/other.git")
+	defer unlock()
+
+	synced := make(chan error)
+	go func() {
+		revision, err := s.manager.Sync(s.module, "HEAD")
+		revision.Release()
+		synced <- err
+	}()
+
+	select {
+	case err := <-synced:
+		assert.NoError(s.T(), err)
+	case <-time.After(10 * time.Second):
+		s.T().Fatal("sync blocked by the lock of another repository")
+	}
+}
+
+func (s *GitManagerTestSuite) commitSymlink(name string, target string) plumbing.Hash {
+	assert.NoError(s.T(), os.Symlink(target, filepath.Join(s.repositoryPath, "guestbook", name)))
+
+	w, err := s.repo.Worktree()
+	assert.NoError(s.T(), err)
+	_, err = w.Add(filepath.Join("guestbook", name))
+	assert.NoError(s.T(), err)
+
+	hash, err := w.Commit(name, &git.CommitOptions{
+		Author: &object.Signature{Name: "circlerr", Email: "circlerr@circlerr.io", When: time.Now()},
+	})
+	assert.NoError(s.T(), err)
+	return hash
+}
+
+func (s *GitManagerTestSuite) TestSyncSymlinks() {
+	s.commit("revision-1")
+	inside := s.commitSymlink("values.yaml", "deployment.yaml")
+
+	revision, err := s.manager.Sync(s.module, inside.String())
+	assert.NoError(s.T(), err)
+	data, err := os.ReadFile(filepath.Join(revision.Path, "guestbook", "values.yaml"))
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "revision-1", string(data))
+
+	for _, target := range []string{"/etc/passwd", strings.Repeat("../", 32) + "etc/passwd"} {
+		assert.NoError(s.T(), os.Remove(filepath.Join(s.repositoryPath, "guestbook", "values.yaml")))
+		outside := s.commitSymlink("values.yaml", target)
+
+		_, err = s.manager.Sync(s.module, outside.String())
+		assert.EqualError(s.T(), err, "symlink guestbook/values.yaml points outside of the repository")
+	}
+}
+
+func (s *GitManagerTestSuite) TestSyncUnknownRevision() {
+	s.commit("revision-1")
+	_, err := s.manager.Sync(s.module, "unknown")
+	assert.Error(s.T(), err)
+}
+
+func (s *GitManagerTestSuite) TestSyncDefault() {
+	firstCommit := s.commit("revision-1")
+	_, err := s.repo.CreateTag("v1", firstCommit, nil)
+	assert.NoError(s.T(), err)
+
+	w, err := s.repo.Worktree()
+	assert.NoError(s.T(), err)
+	err = w.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("revision-2"), Create: true})
+	assert.NoError(s.T(), err)
+	s.commit("revision-2")
+
+	err = w.Checkout(&git.CheckoutOptions{Branch: plumbing.Master})
+	assert.NoError(s.T(), err)
+
+	revision, refs, err := s.manager.SyncDefault(s.module)
+	assert.NoError(s.T(), err)
+	revision.Release()
+	assert.Equal(s.T(), Refs{Default: "master", Branches: []string{"master", "revision-2"}, Tags: []string{"v1"}}, refs)
+	assert.Equal(s.T(), firstCommit.String(), revision.Commit)
+	assert.Equal(s.T(), "revision-1", s.readWorktree(revision))
+
+	revision, _, err = s.manager.SyncDefault(s.module)
+	assert.NoError(s.T(), err)
+	revision.Release()
+}
+
+func (s *GitManagerTestSuite) TestSyncDefaultUnreachableRepository() {
+	s.module.Spec.Url = filepath.Join(s.T().TempDir(), "unknown")
+	_, _, err := s.manager.SyncDefault(s.module)
+	assert.Error(s.T(), err)
+}
+
+func TestGitManagerTestSuite(t *testing.T) {
+	suite.Run(t, new(GitManagerTestSuite))
+}
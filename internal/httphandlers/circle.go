@@ -0,0 +1,208 @@
+package httphandlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"github.com/octopipe/circlerr/internal/domain"
+	"github.com/octopipe/circlerr/internal/utils/annotation"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type circleHandler struct {
+	client    client.Client
+	logger    *zap.Logger
+	validator *validator.Validate
+}
+
+func NewCircleHandler(logger *zap.Logger, client client.Client, validator *validator.Validate) circleHandler {
+	return circleHandler{
+		client:    client,
+		logger:    logger,
+		validator: validator,
+	}
+}
+
+func (h circleHandler) Register(router *gin.RouterGroup) {
+	router.GET("/circles", h.List)
+	router.POST("/circles", h.Create)
+	router.GET("/circles/:circle_name", h.Get)
+	router.PUT("/circles/:circle_name", h.Update)
+	router.DELETE("/circles/:circle_name", h.Delete)
+	router.POST("/circles/:circle_name/sync", h.Sync)
+}
+
+func (h circleHandler) List(c *gin.Context) {
+	pagination := domain.Pagination{}
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		newBadRequestError(c, err)
+		return
+	}
+
+	circleList := circlerriov1alpha1.CircleList{}
+	err := h.client.List(c.Request.Context(), &circleList,
+		client.InNamespace(c.Param("workspace_id")),
+		client.Limit(pagination.Limit),
+		client.Continue(pagination.Continue),
+	)
+	if err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	items := []domain.CircleModel{}
+	for _, circle := range circleList.Items {
+		items = append(items, toCircleModel(circle))
+	}
+
+	c.JSON(http.StatusOK, domain.PaginationResponse[domain.CircleModel]{
+		Limit:    pagination.Limit,
+		Continue: circleList.Continue,
+		Items:    items,
+	})
+}
+
+func (h circleHandler) Get(c *gin.Context) {
+	circle := circlerriov1alpha1.Circle{}
+	key := types.NamespacedName{Namespace: c.Param("workspace_id"), Name: c.Param("circle_name")}
+	if err := h.client.Get(c.Request.Context(), key, &circle); err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toCircleModel(circle))
+}
+
+func (h circleHandler) Create(c *gin.Context) {
+	newCircle := domain.Circle{}
+	if err := c.ShouldBindJSON(&newCircle); err != nil {
+		newBadRequestError(c, err)
+		return
+	}
+
+	setCircleDefaults(&newCircle, c.Param("workspace_id"), getWorkspaceType(c))
+	if err := h.validator.Struct(newCircle); err != nil {
+		newValidationError(c, err)
+		return
+	}
+
+	circle := circlerriov1alpha1.Circle{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      newCircle.Name,
+			Namespace: c.Param("workspace_id"),
+		},
+		Spec: newCircle.CircleSpec,
+	}
+	if err := h.client.Create(c.Request.Context(), &circle); err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, toCircleModel(circle))
+}
+
+func (h circleHandler) Update(c *gin.Context) {
+	newCircle := domain.Circle{}
+	if err := c.ShouldBindJSON(&newCircle); err != nil {
+		newBadRequestError(c, err)
+		return
+	}
+
+	newCircle.Name = c.Param("circle_name")
+	setCircleDefaults(&newCircle, c.Param("workspace_id"), getWorkspaceType(c))
+	if err := h.validator.Struct(newCircle); err != nil {
+		newValidationError(c, err)
+		return
+	}
+
+	circle := circlerriov1alpha1.Circle{}
+	key := types.NamespacedName{Namespace: c.Param("workspace_id"), Name: newCircle.Name}
+	if err := h.client.Get(c.Request.Context(), key, &circle); err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	circle.Spec = newCircle.CircleSpec
+	if err := h.client.Update(c.Request.Context(), &circle); err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toCircleModel(circle))
+}
+
+func (h circleHandler) Delete(c *gin.Context) {
+	circle := circlerriov1alpha1.Circle{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      c.Param("circle_name"),
+			Namespace: c.Param("workspace_id"),
+		},
+	}
+	if err := h.client.Delete(c.Request.Context(), &circle); err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Sync forces a new reconciliation of the circle by touching an annotation
+// watched by the circle controller.
+func (h circleHandler) Sync(c *gin.Context) {
+	circle := circlerriov1alpha1.Circle{}
+	key := types.NamespacedName{Namespace: c.Param("workspace_id"), Name: c.Param("circle_name")}
+	if err := h.client.Get(c.Request.Context(), key, &circle); err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	annotations := circle.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[annotation.SyncRequestedAtAnnotation] = time.Now().UTC().Format(time.RFC3339Nano)
+	circle.SetAnnotations(annotations)
+
+	if err := h.client.Update(c.Request.Context(), &circle); err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, toCircleModel(circle))
+}
+
+// setCircleDefaults scopes the circle to its workspace, deploying into the
+// workspace namespace, looking up modules from it and routing traffic with
+// the workspace type unless stated otherwise.
+func setCircleDefaults(circle *domain.Circle, namespace string, routingStrategy string) {
+	if circle.Namespace == "" {
+		circle.Namespace = namespace
+	}
+
+	if circle.Routing.Strategy == "" {
+		circle.Routing.Strategy = routingStrategy
+	}
+
+	for i := range circle.Modules {
+		if circle.Modules[i].Namespace == "" {
+			circle.Modules[i].Namespace = namespace
+		}
+	}
+}
+
+func toCircleModel(circle circlerriov1alpha1.Circle) domain.CircleModel {
+	return domain.CircleModel{
+		Circle: domain.Circle{
+			Name:       circle.GetName(),
+			CircleSpec: circle.Spec,
+		},
+		CreatedAt: circle.GetCreationTimestamp().UTC().Format(time.RFC3339),
+		Status:    circle.Status,
+	}
+}
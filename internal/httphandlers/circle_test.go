@@ -0,0 +1,154 @@
+package httphandlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"github.com/octopipe/circlerr/internal/domain"
+	"github.com/octopipe/circlerr/internal/utils/annotation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type CircleHandlerTestSuite struct {
+	suite.Suite
+	client client.Client
+	router *gin.Engine
+}
+
+func (s *CircleHandlerTestSuite) SetupTest() {
+	gin.SetMode(gin.TestMode)
+	scheme := runtime.NewScheme()
+	_ = circlerriov1alpha1.AddToScheme(scheme)
+
+	s.client = fake.NewClientBuilder().WithScheme(scheme).Build()
+	s.router = gin.New()
+	NewCircleHandler(zap.NewNop(), s.client, validator.New()).Register(s.router.Group("/workspaces/:workspace_id"))
+}
+
+func (s *CircleHandlerTestSuite) request(method string, path string, body interface{}) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func (s *CircleHandlerTestSuite) TestCreateAndGet() {
+	newCircle := domain.Circle{
+		Name: "circle-1",
+		CircleSpec: circlerriov1alpha1.CircleSpec{
+			Namespace: "default",
+			Modules:   []circlerriov1alpha1.CircleModule{{Name: "module-1"}},
+		},
+	}
+
+	w := s.request(http.MethodPost, "/workspaces/workspace-1/circles", newCircle)
+	assert.Equal(s.T(), http.StatusCreated, w.Code)
+
+	circle := circlerriov1alpha1.Circle{}
+	err := s.client.Get(context.TODO(), types.NamespacedName{Namespace: "workspace-1", Name: "circle-1"}, &circle)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "workspace-1", circle.Spec.Modules[0].Namespace)
+
+	w = s.request(http.MethodGet, "/workspaces/workspace-1/circles/circle-1", nil)
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+
+	model := domain.CircleModel{}
+	assert.NoError(s.T(), json.Unmarshal(w.Body.Bytes(), &model))
+	assert.Equal(s.T(), "circle-1", model.Name)
+	assert.Equal(s.T(), "default", model.Namespace)
+}
+
+func (s *CircleHandlerTestSuite) TestCreateInvalidCircle() {
+	w := s.request(http.MethodPost, "/workspaces/workspace-1/circles", domain.Circle{
+		Name: "circle-1",
+		CircleSpec: circlerriov1alpha1.CircleSpec{
+			Environments: []circlerriov1alpha1.CircleEnvironments{{Value: "http://localhost"}},
+		},
+	})
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+
+	res := errorResponse{}
+	assert.NoError(s.T(), json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(s.T(), 1, len(res.Details))
+	assert.Equal(s.T(), "Circle.CircleSpec.Environments[0].Key", res.Details[0].Field)
+}
+
+func (s *CircleHandlerTestSuite) TestCreateCircleWithAmbiguousEnvironment() {
+	w := s.request(http.MethodPost, "/workspaces/workspace-1/circles", domain.Circle{
+		Name: "circle-1",
+		CircleSpec: circlerriov1alpha1.CircleSpec{
+			Environments: []circlerriov1alpha1.CircleEnvironments{{
+				Key:   "API_URL",
+				Value: "http://localhost",
+				ValueFrom: &circlerriov1alpha1.CircleEnvironmentSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "api"},
+						Key:                  "url",
+					},
+				},
+			}},
+		},
+	})
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+
+	res := errorResponse{}
+	assert.NoError(s.T(), json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(s.T(), 1, len(res.Details))
+	assert.Equal(s.T(), "Circle.CircleSpec.Environments[0].Value", res.Details[0].Field)
+}
+
+func (s *CircleHandlerTestSuite) TestGetNotFound() {
+	w := s.request(http.MethodGet, "/workspaces/workspace-1/circles/unknown", nil)
+	assert.Equal(s.T(), http.StatusNotFound, w.Code)
+}
+
+func (s *CircleHandlerTestSuite) TestInternalError() {
+	core, logs := observer.New(zap.ErrorLevel)
+	s.router = gin.New()
+	unregisteredClient := fake.NewClientBuilder().WithScheme(runtime.NewScheme()).Build()
+	NewCircleHandler(zap.New(core), unregisteredClient, validator.New()).Register(s.router.Group("/workspaces/:workspace_id"))
+
+	w := s.request(http.MethodGet, "/workspaces/workspace-1/circles/circle-1", nil)
+	assert.Equal(s.T(), http.StatusInternalServerError, w.Code)
+	assert.JSONEq(s.T(), `{"message":"Internal Server Error"}`, w.Body.String())
+
+	assert.Equal(s.T(), 1, logs.Len())
+	assert.Contains(s.T(), logs.All()[0].ContextMap()["error"], "no kind is registered")
+}
+
+func (s *CircleHandlerTestSuite) TestSync() {
+	w := s.request(http.MethodPost, "/workspaces/workspace-1/circles", domain.Circle{
+		Name:       "circle-1",
+		CircleSpec: circlerriov1alpha1.CircleSpec{Namespace: "default"},
+	})
+	assert.Equal(s.T(), http.StatusCreated, w.Code)
+
+	w = s.request(http.MethodPost, "/workspaces/workspace-1/circles/circle-1/sync", struct{}{})
+	assert.Equal(s.T(), http.StatusAccepted, w.Code)
+
+	circle := circlerriov1alpha1.Circle{}
+	err := s.client.Get(context.TODO(), types.NamespacedName{Namespace: "workspace-1", Name: "circle-1"}, &circle)
+	assert.NoError(s.T(), err)
+	assert.NotEmpty(s.T(), circle.GetAnnotations()[annotation.SyncRequestedAtAnnotation])
+}
+
+func TestCircleHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(CircleHandlerTestSuite))
+}
@@ -0,0 +1,71 @@
+package httphandlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+type errorDetail struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type errorResponse struct {
+	Message string        `json:"message"`
+	Details []errorDetail `json:"details,omitempty"`
+}
+
+func newBadRequestError(c *gin.Context, err error) {
+	c.JSON(http.StatusBadRequest, errorResponse{Message: err.Error()})
+}
+
+func newValidationError(c *gin.Context, err error) {
+	validationErrors := validator.ValidationErrors{}
+	if !errors.As(err, &validationErrors) {
+		newBadRequestError(c, err)
+		return
+	}
+
+	details := []errorDetail{}
+	for _, fieldErr := range validationErrors {
+		message := fmt.Sprintf("failed on %s validation", fieldErr.Tag())
+		if fieldErr.Param() != "" {
+			message = fmt.Sprintf("failed on %s=%s validation", fieldErr.Tag(), fieldErr.Param())
+		}
+
+		details = append(details, errorDetail{
+			Field:   fieldErr.Namespace(),
+			Message: message,
+		})
+	}
+
+	c.JSON(http.StatusBadRequest, errorResponse{
+		Message: "invalid request body",
+		Details: details,
+	})
+}
+
+// newResponseError maps Kubernetes API errors onto their HTTP status, any
+// other error is logged and answered with a generic message since it may
+// expose internals of the cluster.
+func newResponseError(c *gin.Context, logger *zap.Logger, err error) {
+	switch {
+	case k8sErrors.IsNotFound(err):
+		c.JSON(http.StatusNotFound, errorResponse{Message: err.Error()})
+	case k8sErrors.IsAlreadyExists(err), k8sErrors.IsConflict(err):
+		c.JSON(http.StatusConflict, errorResponse{Message: err.Error()})
+	case k8sErrors.IsInvalid(err), k8sErrors.IsBadRequest(err):
+		c.JSON(http.StatusBadRequest, errorResponse{Message: err.Error()})
+	case k8sErrors.IsForbidden(err):
+		c.JSON(http.StatusForbidden, errorResponse{Message: err.Error()})
+	default:
+		logger.Error("request failed", zap.String("path", c.FullPath()), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, errorResponse{Message: http.StatusText(http.StatusInternalServerError)})
+	}
+}
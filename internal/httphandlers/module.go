@@ -0,0 +1,165 @@
+package httphandlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"github.com/octopipe/circlerr/internal/domain"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type moduleHandler struct {
+	client    client.Client
+	logger    *zap.Logger
+	validator *validator.Validate
+}
+
+func NewModuleHandler(logger *zap.Logger, client client.Client, validator *validator.Validate) moduleHandler {
+	return moduleHandler{
+		client:    client,
+		logger:    logger,
+		validator: validator,
+	}
+}
+
+func (h moduleHandler) Register(router *gin.RouterGroup) {
+	router.GET("/modules", h.List)
+	router.POST("/modules", h.Create)
+	router.GET("/modules/:module_name", h.Get)
+	router.POST("/modules/:module_name", h.Create)
+	router.PUT("/modules/:module_name", h.Update)
+	router.DELETE("/modules/:module_name", h.Delete)
+}
+
+func (h moduleHandler) List(c *gin.Context) {
+	pagination := domain.Pagination{}
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		newBadRequestError(c, err)
+		return
+	}
+
+	moduleList := circlerriov1alpha1.ModuleList{}
+	err := h.client.List(c.Request.Context(), &moduleList,
+		client.InNamespace(c.Param("workspace_id")),
+		client.Limit(pagination.Limit),
+		client.Continue(pagination.Continue),
+	)
+	if err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	items := []domain.ModuleModel{}
+	for _, module := range moduleList.Items {
+		items = append(items, toModuleModel(module))
+	}
+
+	c.JSON(http.StatusOK, domain.PaginationResponse[domain.ModuleModel]{
+		Limit:    pagination.Limit,
+		Continue: moduleList.Continue,
+		Items:    items,
+	})
+}
+
+func (h moduleHandler) Get(c *gin.Context) {
+	module := circlerriov1alpha1.Module{}
+	key := types.NamespacedName{Namespace: c.Param("workspace_id"), Name: c.Param("module_name")}
+	if err := h.client.Get(c.Request.Context(), key, &module); err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toModuleModel(module))
+}
+
+func (h moduleHandler) Create(c *gin.Context) {
+	newModule := domain.Module{}
+	if err := c.ShouldBindJSON(&newModule); err != nil {
+		newBadRequestError(c, err)
+		return
+	}
+
+	if name := c.Param("module_name"); name != "" {
+		newModule.Name = name
+	}
+
+	if err := h.validator.Struct(newModule); err != nil {
+		newValidationError(c, err)
+		return
+	}
+
+	module := circlerriov1alpha1.Module{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      newModule.Name,
+			Namespace: c.Param("workspace_id"),
+		},
+		Spec: newModule.ModuleSpec,
+	}
+	if err := h.client.Create(c.Request.Context(), &module); err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, toModuleModel(module))
+}
+
+func (h moduleHandler) Update(c *gin.Context) {
+	newModule := domain.Module{}
+	if err := c.ShouldBindJSON(&newModule); err != nil {
+		newBadRequestError(c, err)
+		return
+	}
+
+	newModule.Name = c.Param("module_name")
+	if err := h.validator.Struct(newModule); err != nil {
+		newValidationError(c, err)
+		return
+	}
+
+	module := circlerriov1alpha1.Module{}
+	key := types.NamespacedName{Namespace: c.Param("workspace_id"), Name: newModule.Name}
+	if err := h.client.Get(c.Request.Context(), key, &module); err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	module.Spec = newModule.ModuleSpec
+	if err := h.client.Update(c.Request.Context(), &module); err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toModuleModel(module))
+}
+
+func (h moduleHandler) Delete(c *gin.Context) {
+	module := circlerriov1alpha1.Module{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      c.Param("module_name"),
+			Namespace: c.Param("workspace_id"),
+		},
+	}
+	if err := h.client.Delete(c.Request.Context(), &module); err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func toModuleModel(module circlerriov1alpha1.Module) domain.ModuleModel {
+	return domain.ModuleModel{
+		Module: domain.Module{
+			Name:       module.GetName(),
+			ModuleSpec: module.Spec,
+		},
+		CreatedAt: module.GetCreationTimestamp().UTC().Format(time.RFC3339),
+		Status:    module.Status,
+	}
+}
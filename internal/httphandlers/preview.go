@@ -0,0 +1,91 @@
+package httphandlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"github.com/octopipe/circlerr/internal/domain"
+	"github.com/octopipe/circlerr/internal/previewmanager"
+	"go.uber.org/zap"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type previewHandler struct {
+	client         client.Client
+	logger         *zap.Logger
+	validator      *validator.Validate
+	previewManager previewmanager.PreviewManager
+}
+
+func NewPreviewHandler(logger *zap.Logger, client client.Client, validator *validator.Validate, previewManager previewmanager.PreviewManager) previewHandler {
+	return previewHandler{
+		client:         client,
+		logger:         logger,
+		validator:      validator,
+		previewManager: previewManager,
+	}
+}
+
+func (h previewHandler) Register(router *gin.RouterGroup) {
+	router.POST("/circles/:circle_name/preview", h.Preview)
+}
+
+// Preview plans a candidate spec for the circle without applying it, the
+// circle doesn't need to exist yet.
+func (h previewHandler) Preview(c *gin.Context) {
+	newCircle := domain.Circle{}
+	if err := c.ShouldBindJSON(&newCircle); err != nil {
+		newBadRequestError(c, err)
+		return
+	}
+
+	newCircle.Name = c.Param("circle_name")
+	setCircleDefaults(&newCircle, c.Param("workspace_id"), getWorkspaceType(c))
+	if err := h.validator.Struct(newCircle); err != nil {
+		newValidationError(c, err)
+		return
+	}
+
+	circle := circlerriov1alpha1.Circle{}
+	key := types.NamespacedName{Namespace: c.Param("workspace_id"), Name: newCircle.Name}
+	if err := h.client.Get(c.Request.Context(), key, &circle); err != nil {
+		if !k8sErrors.IsNotFound(err) {
+			newResponseError(c, h.logger, err)
+			return
+		}
+
+		circle.SetName(key.Name)
+		circle.SetNamespace(key.Namespace)
+	}
+
+	circle.Spec = newCircle.CircleSpec
+	planResults, err := h.previewManager.Preview(c.Request.Context(), circle)
+	if err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	preview := domain.CirclePreview{Resources: []domain.CirclePreviewResource{}}
+	for _, res := range planResults {
+		previewResource := domain.CirclePreviewResource{
+			Group:     res.Group,
+			Version:   res.Version,
+			Kind:      res.Kind,
+			Name:      res.Name,
+			Namespace: res.Namespace,
+			Action:    res.Action,
+			Diff:      res.DiffString,
+		}
+		if res.Err != nil {
+			previewResource.Error = res.Err.Error()
+		}
+
+		preview.Resources = append(preview.Resources, previewResource)
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
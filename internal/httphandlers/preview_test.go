@@ -0,0 +1,129 @@
+package httphandlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"github.com/octopipe/circlerr/internal/domain"
+	"github.com/octopipe/circlerr/pkg/twice/reconciler"
+	"github.com/octopipe/circlerr/pkg/twice/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type fakePreviewManager struct {
+	circles []circlerriov1alpha1.Circle
+}
+
+func (m *fakePreviewManager) Preview(ctx context.Context, circle circlerriov1alpha1.Circle) ([]reconciler.PlanResult, error) {
+	m.circles = append(m.circles, circle)
+	return []reconciler.PlanResult{{
+		Resource: resource.Resource{
+			Name:      circle.GetName() + "-guestbook-ui",
+			Group:     "apps",
+			Version:   "v1",
+			Kind:      "Deployment",
+			Namespace: circle.Spec.Namespace,
+		},
+		Action:     reconciler.PlanUpdateAction,
+		DiffString: []string{"-  replicas: 1", "+  replicas: 3"},
+	}}, nil
+}
+
+type PreviewHandlerTestSuite struct {
+	suite.Suite
+	client         client.Client
+	previewManager *fakePreviewManager
+	router         *gin.Engine
+}
+
+func (s *PreviewHandlerTestSuite) SetupTest() {
+	gin.SetMode(gin.TestMode)
+	scheme := runtime.NewScheme()
+	_ = circlerriov1alpha1.AddToScheme(scheme)
+
+	s.client = fake.NewClientBuilder().WithScheme(scheme).Build()
+	s.previewManager = &fakePreviewManager{}
+	s.router = gin.New()
+	NewPreviewHandler(zap.NewNop(), s.client, validator.New(), s.previewManager).Register(s.router.Group("/workspaces/:workspace_id"))
+}
+
+func (s *PreviewHandlerTestSuite) request(body interface{}) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/workspaces/workspace-1/circles/circle-1/preview", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func (s *PreviewHandlerTestSuite) TestPreview() {
+	w := s.request(domain.Circle{
+		CircleSpec: circlerriov1alpha1.CircleSpec{
+			Namespace: "default",
+			Modules:   []circlerriov1alpha1.CircleModule{{Name: "guestbook-ui"}},
+		},
+	})
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+
+	preview := domain.CirclePreview{}
+	assert.NoError(s.T(), json.Unmarshal(w.Body.Bytes(), &preview))
+	assert.Equal(s.T(), []domain.CirclePreviewResource{{
+		Group:     "apps",
+		Version:   "v1",
+		Kind:      "Deployment",
+		Name:      "circle-1-guestbook-ui",
+		Namespace: "default",
+		Action:    reconciler.PlanUpdateAction,
+		Diff:      []string{"-  replicas: 1", "+  replicas: 3"},
+	}}, preview.Resources)
+
+	circle := s.previewManager.circles[0]
+	assert.Equal(s.T(), "circle-1", circle.GetName())
+	assert.Equal(s.T(), "workspace-1", circle.GetNamespace())
+	assert.Equal(s.T(), "workspace-1", circle.Spec.Modules[0].Namespace)
+}
+
+func (s *PreviewHandlerTestSuite) TestPreviewExistingCircle() {
+	existing := circlerriov1alpha1.Circle{
+		ObjectMeta: metav1.ObjectMeta{Name: "circle-1", Namespace: "workspace-1"},
+		Spec:       circlerriov1alpha1.CircleSpec{Namespace: "default"},
+	}
+	assert.NoError(s.T(), s.client.Create(context.TODO(), &existing))
+
+	w := s.request(domain.Circle{CircleSpec: circlerriov1alpha1.CircleSpec{Namespace: "staging"}})
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+	assert.Equal(s.T(), existing.GetUID(), s.previewManager.circles[0].GetUID())
+	assert.Equal(s.T(), "staging", s.previewManager.circles[0].Spec.Namespace)
+
+	circle := circlerriov1alpha1.Circle{}
+	assert.NoError(s.T(), s.client.Get(context.TODO(), types.NamespacedName{Namespace: "workspace-1", Name: "circle-1"}, &circle))
+	assert.Equal(s.T(), "default", circle.Spec.Namespace)
+}
+
+func (s *PreviewHandlerTestSuite) TestPreviewInvalidCircle() {
+	w := s.request(domain.Circle{
+		CircleSpec: circlerriov1alpha1.CircleSpec{
+			Environments: []circlerriov1alpha1.CircleEnvironments{{Value: "http://localhost"}},
+		},
+	})
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+	assert.Empty(s.T(), s.previewManager.circles)
+}
+
+func TestPreviewHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(PreviewHandlerTestSuite))
+}
@@ -0,0 +1,222 @@
+package httphandlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"github.com/octopipe/circlerr/internal/domain"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// childKinds maps a workload kind to the kinds it creates and owns through
+// owner references, used to expand the resource tree of a circle.
+var childKinds = map[schema.GroupKind][]schema.GroupVersionKind{
+	{Group: "apps", Kind: "Deployment"}:  {{Group: "apps", Version: "v1", Kind: "ReplicaSet"}},
+	{Group: "apps", Kind: "ReplicaSet"}:  {{Version: "v1", Kind: "Pod"}},
+	{Group: "apps", Kind: "StatefulSet"}: {{Version: "v1", Kind: "Pod"}},
+	{Group: "apps", Kind: "DaemonSet"}:   {{Version: "v1", Kind: "Pod"}},
+	{Group: "batch", Kind: "CronJob"}:    {{Group: "batch", Version: "v1", Kind: "Job"}},
+	{Group: "batch", Kind: "Job"}:        {{Version: "v1", Kind: "Pod"}},
+}
+
+type resourceHandler struct {
+	client client.Client
+	logger *zap.Logger
+}
+
+func NewResourceHandler(logger *zap.Logger, client client.Client) resourceHandler {
+	return resourceHandler{
+		client: client,
+		logger: logger,
+	}
+}
+
+func (h resourceHandler) Register(router *gin.RouterGroup) {
+	router.GET("/circles/:circle_name/resources/tree", h.Tree)
+	router.GET("/circles/:circle_name/resources/:resource_name", h.Get)
+	router.GET("/circles/:circle_name/resources/:resource_name/events", h.Events)
+}
+
+func (h resourceHandler) getCircle(ctx context.Context, c *gin.Context) (circlerriov1alpha1.Circle, error) {
+	circle := circlerriov1alpha1.Circle{}
+	key := types.NamespacedName{Namespace: c.Param("workspace_id"), Name: c.Param("circle_name")}
+	err := h.client.Get(ctx, key, &circle)
+	return circle, err
+}
+
+func (h resourceHandler) Get(c *gin.Context) {
+	ctx := c.Request.Context()
+	circle, err := h.getCircle(ctx, c)
+	if err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	kind := c.Query("kind")
+	if kind == "" {
+		newBadRequestError(c, errors.New("kind query param is required"))
+		return
+	}
+
+	mapping, err := h.client.RESTMapper().RESTMapping(schema.GroupKind{Group: c.Query("group"), Kind: kind})
+	if err != nil {
+		newBadRequestError(c, err)
+		return
+	}
+
+	un := &unstructured.Unstructured{}
+	un.SetGroupVersionKind(mapping.GroupVersionKind)
+	key := types.NamespacedName{Namespace: circle.Spec.Namespace, Name: c.Param("resource_name")}
+	if err := h.client.Get(ctx, key, un); err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toResource(un, true))
+}
+
+func (h resourceHandler) Events(c *gin.Context) {
+	ctx := c.Request.Context()
+	circle, err := h.getCircle(ctx, c)
+	if err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	fields := client.MatchingFields{"involvedObject.name": c.Param("resource_name")}
+	if kind := c.Query("kind"); kind != "" {
+		fields["involvedObject.kind"] = kind
+	}
+
+	eventList := corev1.EventList{}
+	if err := h.client.List(ctx, &eventList, client.InNamespace(circle.Spec.Namespace), fields); err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	sort.Slice(eventList.Items, func(i, j int) bool {
+		return eventList.Items[i].LastTimestamp.After(eventList.Items[j].LastTimestamp.Time)
+	})
+
+	events := []domain.Event{}
+	for _, e := range eventList.Items {
+		events = append(events, domain.Event{
+			Type:      e.Type,
+			Reason:    e.Reason,
+			Message:   e.Message,
+			Count:     e.Count,
+			FirstTime: e.FirstTimestamp.UTC().Format(time.RFC3339),
+			LastTime:  e.LastTimestamp.UTC().Format(time.RFC3339),
+		})
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+func (h resourceHandler) Tree(c *gin.Context) {
+	ctx := c.Request.Context()
+	circle, err := h.getCircle(ctx, c)
+	if err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	tree := []domain.ResourceTree{}
+	for _, res := range circle.Status.Resources {
+		mapping, err := h.client.RESTMapper().RESTMapping(schema.GroupKind{Group: res.Group, Kind: res.Kind})
+		if err != nil {
+			newResponseError(c, h.logger, err)
+			return
+		}
+
+		un := &unstructured.Unstructured{}
+		un.SetGroupVersionKind(mapping.GroupVersionKind)
+		key := types.NamespacedName{Namespace: res.Namespace, Name: res.Name}
+		if err := h.client.Get(ctx, key, un); err != nil {
+			if client.IgnoreNotFound(err) == nil {
+				continue
+			}
+
+			newResponseError(c, h.logger, err)
+			return
+		}
+
+		node, err := h.getTree(ctx, un)
+		if err != nil {
+			newResponseError(c, h.logger, err)
+			return
+		}
+
+		tree = append(tree, node)
+	}
+
+	c.JSON(http.StatusOK, tree)
+}
+
+func (h resourceHandler) getTree(ctx context.Context, parent *unstructured.Unstructured) (domain.ResourceTree, error) {
+	node := domain.ResourceTree{
+		Resource: toResource(parent, false),
+		Children: []domain.ResourceTree{},
+	}
+
+	for _, childKind := range childKinds[parent.GroupVersionKind().GroupKind()] {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(childKind.GroupVersion().WithKind(childKind.Kind + "List"))
+		if err := h.client.List(ctx, list, client.InNamespace(parent.GetNamespace())); err != nil {
+			return domain.ResourceTree{}, err
+		}
+
+		for i := range list.Items {
+			child := &list.Items[i]
+			if !isOwnedBy(child, parent) {
+				continue
+			}
+
+			childNode, err := h.getTree(ctx, child)
+			if err != nil {
+				return domain.ResourceTree{}, err
+			}
+
+			node.Children = append(node.Children, childNode)
+		}
+	}
+
+	return node, nil
+}
+
+func isOwnedBy(child *unstructured.Unstructured, parent *unstructured.Unstructured) bool {
+	for _, owner := range child.GetOwnerReferences() {
+		if owner.UID == parent.GetUID() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func toResource(un *unstructured.Unstructured, withObject bool) domain.Resource {
+	gvk := un.GroupVersionKind()
+	res := domain.Resource{
+		Group:     gvk.Group,
+		Version:   gvk.Version,
+		Kind:      gvk.Kind,
+		Name:      un.GetName(),
+		Namespace: un.GetNamespace(),
+	}
+
+	if withObject {
+		res.Object = un.Object
+	}
+
+	return res
+}
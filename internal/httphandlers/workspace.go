@@ -0,0 +1,248 @@
+package httphandlers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/octopipe/circlerr/internal/domain"
+	"github.com/octopipe/circlerr/internal/utils/annotation"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	maxWorkspacePrefixLength = 52
+	workspaceContextKey      = "workspace"
+)
+
+var invalidNamespaceChars = regexp.MustCompile("[^a-z0-9]+")
+
+// workspaceHandler persists workspaces as labeled namespaces. The namespace
+// name is the workspace id and every circle and module of the workspace is
+// created inside it.
+type workspaceHandler struct {
+	client    client.Client
+	logger    *zap.Logger
+	validator *validator.Validate
+}
+
+func NewWorkspaceHandler(logger *zap.Logger, client client.Client, validator *validator.Validate) workspaceHandler {
+	return workspaceHandler{
+		client:    client,
+		logger:    logger,
+		validator: validator,
+	}
+}
+
+func (h workspaceHandler) Register(router *gin.RouterGroup) {
+	router.GET("/workspaces", h.List)
+	router.POST("/workspaces", h.Create)
+	router.GET("/workspaces/:workspace_id", h.Get)
+	router.PUT("/workspaces/:workspace_id", h.Update)
+	router.DELETE("/workspaces/:workspace_id", h.Delete)
+}
+
+// Scope aborts requests for workspaces that do not exist, it must be used by
+// every route group nested under /workspaces/:workspace_id.
+func (h workspaceHandler) Scope() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		namespace, err := h.getNamespace(c)
+		if err != nil {
+			newResponseError(c, h.logger, err)
+			c.Abort()
+			return
+		}
+
+		c.Set(workspaceContextKey, toWorkspaceModel(namespace))
+		c.Next()
+	}
+}
+
+// getWorkspaceType returns the routing type of the workspace loaded by Scope.
+func getWorkspaceType(c *gin.Context) string {
+	workspace, ok := c.Get(workspaceContextKey)
+	if !ok || workspace.(domain.WorkspaceModel).Type == "" {
+		return domain.DefaultWorkspaceType
+	}
+
+	return workspace.(domain.WorkspaceModel).Type
+}
+
+func (h workspaceHandler) List(c *gin.Context) {
+	pagination := domain.Pagination{}
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		newBadRequestError(c, err)
+		return
+	}
+
+	namespaceList := corev1.NamespaceList{}
+	err := h.client.List(c.Request.Context(), &namespaceList,
+		client.MatchingLabels{annotation.WorkspaceLabel: annotation.WorkspaceLabelValue},
+		client.Limit(pagination.Limit),
+		client.Continue(pagination.Continue),
+	)
+	if err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	items := []domain.WorkspaceModel{}
+	for _, namespace := range namespaceList.Items {
+		items = append(items, toWorkspaceModel(namespace))
+	}
+
+	c.JSON(http.StatusOK, domain.PaginationResponse[domain.WorkspaceModel]{
+		Limit:    pagination.Limit,
+		Continue: namespaceList.Continue,
+		Items:    items,
+	})
+}
+
+func (h workspaceHandler) Get(c *gin.Context) {
+	namespace, err := h.getNamespace(c)
+	if err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toWorkspaceModel(namespace))
+}
+
+func (h workspaceHandler) Create(c *gin.Context) {
+	workspace, ok := h.bindWorkspace(c)
+	if !ok {
+		return
+	}
+
+	namespace := corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: getWorkspacePrefix(workspace.Name),
+			Labels: map[string]string{
+				annotation.WorkspaceLabel: annotation.WorkspaceLabelValue,
+			},
+		},
+	}
+	setWorkspaceAnnotations(&namespace, workspace)
+	if err := h.client.Create(c.Request.Context(), &namespace); err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, toWorkspaceModel(namespace))
+}
+
+func (h workspaceHandler) Update(c *gin.Context) {
+	workspace, ok := h.bindWorkspace(c)
+	if !ok {
+		return
+	}
+
+	namespace, err := h.getNamespace(c)
+	if err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	setWorkspaceAnnotations(&namespace, workspace)
+	if err := h.client.Update(c.Request.Context(), &namespace); err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toWorkspaceModel(namespace))
+}
+
+func (h workspaceHandler) Delete(c *gin.Context) {
+	namespace, err := h.getNamespace(c)
+	if err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	if err := h.client.Delete(c.Request.Context(), &namespace); err != nil {
+		newResponseError(c, h.logger, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h workspaceHandler) bindWorkspace(c *gin.Context) (domain.Workspace, bool) {
+	workspace := domain.Workspace{}
+	if err := c.ShouldBindJSON(&workspace); err != nil {
+		newBadRequestError(c, err)
+		return domain.Workspace{}, false
+	}
+
+	if workspace.Type == "" {
+		workspace.Type = domain.DefaultWorkspaceType
+	}
+
+	if err := h.validator.Struct(workspace); err != nil {
+		newValidationError(c, err)
+		return domain.Workspace{}, false
+	}
+
+	return workspace, true
+}
+
+func (h workspaceHandler) getNamespace(c *gin.Context) (corev1.Namespace, error) {
+	namespace := corev1.Namespace{}
+	id := c.Param("workspace_id")
+	if err := h.client.Get(c.Request.Context(), types.NamespacedName{Name: id}, &namespace); err != nil {
+		return corev1.Namespace{}, err
+	}
+
+	if namespace.GetLabels()[annotation.WorkspaceLabel] != annotation.WorkspaceLabelValue {
+		return corev1.Namespace{}, k8sErrors.NewNotFound(corev1.Resource("workspaces"), id)
+	}
+
+	return namespace, nil
+}
+
+func getWorkspacePrefix(name string) string {
+	prefix := strings.Trim(invalidNamespaceChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if len(prefix) > maxWorkspacePrefixLength {
+		prefix = strings.TrimRight(prefix[:maxWorkspacePrefixLength], "-")
+	}
+
+	if prefix == "" {
+		prefix = "workspace"
+	}
+
+	return fmt.Sprintf("%s-", prefix)
+}
+
+func setWorkspaceAnnotations(namespace *corev1.Namespace, workspace domain.Workspace) {
+	annotations := namespace.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	annotations[annotation.WorkspaceNameAnnotation] = workspace.Name
+	annotations[annotation.WorkspaceDescriptionAnnotation] = workspace.Description
+	annotations[annotation.WorkspaceTypeAnnotation] = workspace.Type
+	namespace.SetAnnotations(annotations)
+}
+
+func toWorkspaceModel(namespace corev1.Namespace) domain.WorkspaceModel {
+	annotations := namespace.GetAnnotations()
+	return domain.WorkspaceModel{
+		Workspace: domain.Workspace{
+			Name:        annotations[annotation.WorkspaceNameAnnotation],
+			Description: annotations[annotation.WorkspaceDescriptionAnnotation],
+			Type:        annotations[annotation.WorkspaceTypeAnnotation],
+		},
+		ID:        namespace.GetName(),
+		CreatedAt: namespace.GetCreationTimestamp().UTC().Format(time.RFC3339),
+	}
+}
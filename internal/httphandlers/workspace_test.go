@@ -0,0 +1,102 @@
+package httphandlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/octopipe/circlerr/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type WorkspaceHandlerTestSuite struct {
+	suite.Suite
+	router *gin.Engine
+}
+
+func (s *WorkspaceHandlerTestSuite) SetupTest() {
+	gin.SetMode(gin.TestMode)
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	unmanagedNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}}
+	client := fake.NewClientBuilder().WithScheme(scheme).WithObjects(unmanagedNamespace).Build()
+	handler := NewWorkspaceHandler(zap.NewNop(), client, validator.New())
+
+	s.router = gin.New()
+	handler.Register(&s.router.RouterGroup)
+	s.router.Group("/workspaces/:workspace_id", handler.Scope()).GET("/circles", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+}
+
+func (s *WorkspaceHandlerTestSuite) request(method string, path string, body interface{}) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func (s *WorkspaceHandlerTestSuite) create(workspace domain.Workspace) domain.WorkspaceModel {
+	w := s.request(http.MethodPost, "/workspaces", workspace)
+	assert.Equal(s.T(), http.StatusCreated, w.Code)
+
+	model := domain.WorkspaceModel{}
+	assert.NoError(s.T(), json.Unmarshal(w.Body.Bytes(), &model))
+	return model
+}
+
+func (s *WorkspaceHandlerTestSuite) TestCreate() {
+	model := s.create(domain.Workspace{Name: "Workspace test 1", Description: "Lorem ipsum"})
+	assert.True(s.T(), strings.HasPrefix(model.ID, "workspace-test-1-"))
+	assert.Equal(s.T(), "Workspace test 1", model.Name)
+	assert.Equal(s.T(), domain.DefaultWorkspaceType, model.Type)
+
+	w := s.request(http.MethodGet, "/workspaces/"+model.ID, nil)
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+}
+
+func (s *WorkspaceHandlerTestSuite) TestCreateInvalidType() {
+	w := s.request(http.MethodPost, "/workspaces", domain.Workspace{Name: "workspace", Type: "CIRCLE"})
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+}
+
+func (s *WorkspaceHandlerTestSuite) TestListPagination() {
+	s.create(domain.Workspace{Name: "workspace-1"})
+	s.create(domain.Workspace{Name: "workspace-2", Type: domain.CanaryWorkspaceType})
+
+	w := s.request(http.MethodGet, "/workspaces?limit=10", nil)
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+
+	res := domain.PaginationResponse[domain.WorkspaceModel]{}
+	assert.NoError(s.T(), json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(s.T(), int64(10), res.Limit)
+	assert.Equal(s.T(), 2, len(res.Items))
+}
+
+func (s *WorkspaceHandlerTestSuite) TestScope() {
+	model := s.create(domain.Workspace{Name: "workspace-1"})
+
+	w := s.request(http.MethodGet, "/workspaces/"+model.ID+"/circles", nil)
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+
+	w = s.request(http.MethodGet, "/workspaces/kube-system/circles", nil)
+	assert.Equal(s.T(), http.StatusNotFound, w.Code)
+}
+
+func TestWorkspaceHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(WorkspaceHandlerTestSuite))
+}
@@ -2,159 +2,476 @@ package k8scontrollers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
-	"github.com/octopipe/circlerr/internal/gitmanager"
+	"github.com/octopipe/circlerr/internal/domain"
+	"github.com/octopipe/circlerr/internal/previewmanager"
+	"github.com/octopipe/circlerr/internal/routingmanager"
 	"github.com/octopipe/circlerr/internal/templatemanager"
 	"github.com/octopipe/circlerr/internal/utils/annotation"
+	"github.com/octopipe/circlerr/pkg/twice/health"
 	"github.com/octopipe/circlerr/pkg/twice/reconciler"
 	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	applyAction      = "APPLY"
+	deleteAction     = "DELETE"
+	maxCircleHistory = 10
 )
 
 type CircleController interface {
 	Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error)
 }
 
+type circleControllerOpt func(r *circleController)
+
 type circleController struct {
 	client.Client
 	logger          *zap.Logger
 	scheme          *runtime.Scheme
 	reconciler      reconciler.Reconciler
-	gitManager      gitmanager.Manager
 	templateManager templatemanager.TemplateManager
+	routingManager  routingmanager.RoutingManager
+	resourceEvents  ResourceEvents
+	resyncInterval  time.Duration
+}
+
+// WithResyncInterval requeues circles after every successful reconcile so
+// drifts missed by the watches are corrected, zero disables the resync.
+func WithResyncInterval(resyncInterval time.Duration) circleControllerOpt {
+	return func(r *circleController) {
+		r.resyncInterval = resyncInterval
+	}
+}
+
+// WithResourceEvents enqueues circles when the resources they deployed change.
+func WithResourceEvents(resourceEvents ResourceEvents) circleControllerOpt {
+	return func(r *circleController) {
+		r.resourceEvents = resourceEvents
+	}
 }
 
 func NewCircleController(
 	logger *zap.Logger,
 	client client.Client,
 	scheme *runtime.Scheme,
-	gitManager gitmanager.Manager,
 	templateManager templatemanager.TemplateManager,
+	routingManager routingmanager.RoutingManager,
 	reconciler reconciler.Reconciler,
+	opts ...circleControllerOpt,
 ) circleController {
-	return circleController{
+	r := circleController{
 		logger:          logger,
 		Client:          client,
 		scheme:          scheme,
 		reconciler:      reconciler,
 		templateManager: templateManager,
-		gitManager:      gitManager,
+		routingManager:  routingManager,
+	}
+
+	for _, opt := range opts {
+		opt(&r)
 	}
+
+	return r
 }
 
 func (r *circleController) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	circle := circlerriov1alpha1.Circle{}
 	err := r.Get(ctx, req.NamespacedName, &circle)
 	if err != nil {
-		return ctrl.Result{}, err
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if circle.GetDeletionTimestamp() != nil {
+		return r.reconcileDeletion(ctx, circle)
 	}
 
-	applyResults := []reconciler.ApplyResult{}
-	if len(circle.Finalizers) > 0 {
-		r.logger.Info(fmt.Sprintf("circle %s with finalizers", req), zap.Any("finalizers", circle.Finalizers))
-		applyResults, err = r.forDeletion(ctx, circle)
-		if err != nil {
+	if !controllerutil.ContainsFinalizer(&circle, annotation.CircleFinalizer) {
+		controllerutil.AddFinalizer(&circle, annotation.CircleFinalizer)
+		if err := r.Update(ctx, &circle); err != nil {
 			return ctrl.Result{}, err
 		}
-	} else {
-		r.logger.Info(fmt.Sprintf("apply circle %s", req))
-		applyResults, err = r.forApply(ctx, circle)
-		if err != nil {
-			return ctrl.Result{}, err
+	}
+
+	r.logger.Info(fmt.Sprintf("apply circle %s", req))
+	applyResults, err := r.forApply(ctx, circle)
+	return r.updateStatus(ctx, circle, applyAction, applyResults, err)
+}
+
+// reconcileDeletion prunes the resources of a deleted circle according to its
+// deletion policy and releases the circle once every resource was pruned.
+func (r *circleController) reconcileDeletion(ctx context.Context, circle circlerriov1alpha1.Circle) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(&circle, annotation.CircleFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	r.logger.Info(fmt.Sprintf("delete circle %s/%s", circle.GetNamespace(), circle.GetName()), zap.String("deletionPolicy", circle.Spec.DeletionPolicy))
+	applyResults, err := r.forDeletion(ctx, circle)
+	if err == nil {
+		for _, res := range applyResults {
+			if res.Err != nil {
+				err = fmt.Errorf("failed to delete %s %s: %w", res.Kind, res.Name, res.Err)
+				break
+			}
 		}
 	}
 
-	resourceStatus := []circlerriov1alpha1.CircleStatusResource{}
+	if err != nil {
+		return r.updateStatus(ctx, circle, deleteAction, applyResults, err)
+	}
+
+	controllerutil.RemoveFinalizer(&circle, annotation.CircleFinalizer)
+	return ctrl.Result{}, r.Update(ctx, &circle)
+}
+
+func (r *circleController) updateStatus(ctx context.Context, circle circlerriov1alpha1.Circle, action string, applyResults []reconciler.ApplyResult, reconcileErr error) (ctrl.Result, error) {
+	circle.Status = newCircleStatus(circle, action, applyResults, reconcileErr, time.Now())
+	if err := r.Status().Update(ctx, &circle); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if reconcileErr != nil {
+		return ctrl.Result{}, reconcileErr
+	}
+
+	if circle.Status.SyncStatus == circlerriov1alpha1.FailedStatus {
+		return ctrl.Result{}, errors.New(circle.Status.Error)
+	}
+
+	return ctrl.Result{RequeueAfter: r.resyncInterval}, nil
+}
+
+// newCircleStatus builds the status of a reconcile from its apply results.
+// Resources deleted successfully are dropped, every other result is kept with
+// its error and the module it was rendered from.
+func newCircleStatus(circle circlerriov1alpha1.Circle, action string, applyResults []reconciler.ApplyResult, reconcileErr error, now time.Time) circlerriov1alpha1.CircleStatus {
+	syncedAt := now.UTC().Format(time.RFC3339)
+	status := *circle.Status.DeepCopy()
+	status.SyncedAt = syncedAt
+	status.Resources = []circlerriov1alpha1.CircleStatusResource{}
+
+	errs := []string{}
+	if reconcileErr != nil {
+		errs = append(errs, reconcileErr.Error())
+	}
+
+	healthStatuses := []health.Status{}
+
 	for _, res := range applyResults {
-		resourceStatus = append(resourceStatus, circlerriov1alpha1.CircleStatusResource{
-			Group:     res.Resource.Group,
-			Kind:      res.Resource.Kind,
-			Name:      res.Resource.Name,
-			Namespace: res.Resource.Namespace,
-			Status: circlerriov1alpha1.CircleResourceStatus{
-				SyncStatus: res.Status,
-				SyncedAt:   time.Now().String(),
+		resourceStatus := circlerriov1alpha1.CircleResourceStatus{
+			SyncStatus:    circlerriov1alpha1.SyncedStatus,
+			SyncedAt:      syncedAt,
+			HealthStatus:  res.Status,
+			HealthMessage: res.StatusMessage,
+		}
+
+		if res.Err != nil {
+			resourceStatus.SyncStatus = circlerriov1alpha1.FailedStatus
+			resourceStatus.Error = res.Err.Error()
+			errs = append(errs, fmt.Sprintf("%s %s: %s", res.Kind, res.Name, res.Err))
+		} else if res.Action == reconciler.PlanDeleteAction {
+			continue
+		} else if res.Status != "" {
+			healthStatuses = append(healthStatuses, health.Status{
+				Status:  res.Status,
+				Message: fmt.Sprintf("%s %s: %s", res.Kind, res.Name, res.StatusMessage),
+			})
+		}
+
+		annotations := map[string]string{}
+		if res.Object != nil {
+			annotations = res.Object.GetAnnotations()
+		}
+
+		status.Resources = append(status.Resources, circlerriov1alpha1.CircleStatusResource{
+			Group:     res.Group,
+			Kind:      res.Kind,
+			Name:      res.Name,
+			Namespace: res.Namespace,
+			Status:    resourceStatus,
+			Module: circlerriov1alpha1.CircleResourceModule{
+				Name:      annotations[annotation.ModuleNameAnnotation],
+				Namespace: annotations[annotation.ModuleNamespaceAnnotation],
+				Revision:  annotations[annotation.ModuleRevisionAnnotation],
 			},
 		})
 	}
 
-	circle.Status = circlerriov1alpha1.CircleStatus{
-		Resources: resourceStatus,
+	status.SyncStatus = circlerriov1alpha1.SyncedStatus
+	status.Error = strings.Join(errs, "; ")
+	message := fmt.Sprintf("%d resources synced", len(status.Resources))
+	if len(errs) > 0 {
+		status.SyncStatus = circlerriov1alpha1.FailedStatus
+		message = status.Error
 	}
-	// err = r.Status().Update(ctx, &circle)
-	// if err != nil {
-	// 	return ctrl.Result{}, err
-	// }
 
-	return ctrl.Result{}, nil
-}
+	status.History = append(status.History, circlerriov1alpha1.CircleStatusHistory{
+		Status:    status.SyncStatus,
+		Message:   message,
+		EventTime: syncedAt,
+		Action:    action,
+	})
+	if len(status.History) > maxCircleHistory {
+		status.History = status.History[len(status.History)-maxCircleHistory:]
+	}
 
-func (r circleController) forApply(ctx context.Context, circle circlerriov1alpha1.Circle) ([]reconciler.ApplyResult, error) {
-	for _, m := range circle.Spec.Modules {
-		module := circlerriov1alpha1.Module{}
-		key := types.NamespacedName{Namespace: m.Namespace, Name: m.Name}
-		err := r.Get(ctx, key, &module)
-		if err != nil {
-			return nil, err
-		}
+	// Circles failing to render record why, like the template error of a chart.
+	failedReason := "SyncFailed"
+	if reason := templatemanager.ErrorReason(reconcileErr); reason != "" {
+		failedReason = reason
+	}
+
+	synced := len(errs) == 0
+	setCondition(&status.Conditions, circle.GetGeneration(), circlerriov1alpha1.SyncedCondition, synced, "Synced", failedReason, message)
 
-		err = r.gitManager.Sync(module)
-		if err != nil {
-			return nil, err
+	// The health of resources is only known once they were applied, so a
+	// circle failing before applying keeps the health of its last sync.
+	if len(applyResults) > 0 {
+		aggregated := health.Aggregate(healthStatuses)
+		status.HealthStatus = aggregated.Status
+		if synced && aggregated.Status != health.HealthyStatus {
+			message = aggregated.Message
 		}
+	}
 
+	degradedReason, notReadyReason := failedReason, "NotReady"
+	if synced {
+		degradedReason, notReadyReason = "Degraded", "Unhealthy"
 	}
 
+	isDegraded := !synced || status.HealthStatus == health.DegradedStatus
+	isReady := synced && (status.HealthStatus == "" || status.HealthStatus == health.HealthyStatus)
+	setCondition(&status.Conditions, circle.GetGeneration(), circlerriov1alpha1.DegradedCondition, isDegraded, degradedReason, "Synced", message)
+	setCondition(&status.Conditions, circle.GetGeneration(), circlerriov1alpha1.ReadyCondition, isReady, "Ready", notReadyReason, message)
+
+	return status
+}
+
+func setCondition(conditions *[]metav1.Condition, generation int64, conditionType string, value bool, trueReason string, falseReason string, message string) {
+	condition := metav1.Condition{
+		Type:               conditionType,
+		Status:             metav1.ConditionFalse,
+		Reason:             falseReason,
+		Message:            message,
+		ObservedGeneration: generation,
+	}
+
+	if value {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = trueReason
+	}
+
+	meta.SetStatusCondition(conditions, condition)
+}
+
+func (r circleController) forApply(ctx context.Context, circle circlerriov1alpha1.Circle) ([]reconciler.ApplyResult, error) {
 	manifests, err := r.templateManager.RenderManifests(ctx, circle)
 	if err != nil {
 		return nil, err
 	}
 
-	preHook := func(un *unstructured.Unstructured) *unstructured.Unstructured {
-		un.SetName(fmt.Sprintf("%s-%s", circle.GetName(), un.GetName()))
-		un = annotation.AddDefaultAnnotationsToObject(un, circle)
-		return un
+	planResults, err := r.reconciler.Plan(
+		ctx,
+		manifests,
+		circle.Spec.Namespace,
+		previewmanager.IsCircleObject(circle),
+		reconciler.WithPreHook(previewmanager.CirclePreHook(circle, r.routingManager)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	applyResults, err := r.reconciler.Apply(ctx, planResults, circle.Spec.Namespace)
+	if err != nil {
+		return nil, err
 	}
 
-	planResults, err := r.reconciler.Plan(ctx, manifests, circle.Spec.Namespace, func(un *unstructured.Unstructured) bool {
-		circleName := un.GetAnnotations()[annotation.CircleNameAnnotation]
-		circleNamespace := un.GetAnnotations()[annotation.CircleNamespaceAnnotation]
+	routingResults, err := r.forRouting(ctx, circle.Spec.Namespace)
+	return append(applyResults, routingResults...), err
+}
 
-		return circleName == circle.Name && circleNamespace == circle.Namespace
-	}, reconciler.WithPreHook(preHook))
+// forRouting reconciles the routing objects shared by every circle deployed
+// into the namespace.
+func (r circleController) forRouting(ctx context.Context, namespace string) ([]reconciler.ApplyResult, error) {
+	manifests, err := r.routingManager.RenderManifests(ctx, namespace)
 	if err != nil {
 		return nil, err
 	}
 
-	applyResults, err := r.reconciler.Apply(ctx, planResults, circle.Spec.Namespace)
-	return applyResults, err
+	planResults, err := r.reconciler.Plan(ctx, manifests, namespace, func(un *unstructured.Unstructured) bool {
+		return routingmanager.IsManaged(un, namespace)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r.reconciler.Apply(ctx, planResults, namespace)
 }
 
+// forDeletion runs the on-delete hooks of the circle, prunes the resources not
+// kept by its deletion policy and recomputes the routing of the namespace
+// without the circle. Circles whose manifests fail to render are pruned
+// without running their hooks.
 func (r circleController) forDeletion(ctx context.Context, circle circlerriov1alpha1.Circle) ([]reconciler.ApplyResult, error) {
-	planResults, err := r.reconciler.Plan(ctx, []string{}, circle.Spec.Namespace, func(un *unstructured.Unstructured) bool {
-		circleName := un.GetAnnotations()[annotation.CircleNameAnnotation]
-		circleNamespace := un.GetAnnotations()[annotation.CircleNamespaceAnnotation]
+	manifests, err := r.templateManager.RenderManifests(ctx, circle)
+	if err != nil {
+		r.logger.Error("failed to render on-delete hooks", zap.String("circle", circle.GetName()), zap.Error(err))
+		manifests = []string{}
+	}
 
-		return circleName == circle.Name && circleNamespace == circle.Namespace
-	})
+	planResults, err := r.reconciler.Plan(
+		ctx,
+		manifests,
+		circle.Spec.Namespace,
+		previewmanager.IsCircleObject(circle),
+		reconciler.WithPreHook(previewmanager.CirclePreHook(circle, r.routingManager)),
+		reconciler.WithOnDeleteHooks(),
+	)
 	if err != nil {
 		return nil, err
 	}
 
-	applyResults, err := r.reconciler.Apply(ctx, planResults, circle.Spec.Namespace)
-	return applyResults, err
+	applyResults, err := r.reconciler.Apply(ctx, getDeletionPlan(circle.Spec.DeletionPolicy, planResults), circle.Spec.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	routingResults, err := r.forRouting(ctx, circle.Spec.Namespace)
+	return append(applyResults, routingResults...), err
+}
+
+// getDeletionPlan drops the deletions of resources kept by the deletion policy,
+// on-delete hooks are kept unless every resource is orphaned.
+func getDeletionPlan(deletionPolicy string, planResults []reconciler.PlanResult) []reconciler.PlanResult {
+	if deletionPolicy == domain.OrphanDeletionPolicy {
+		return []reconciler.PlanResult{}
+	}
+
+	results := []reconciler.PlanResult{}
+	for _, res := range planResults {
+		if deletionPolicy == domain.KeepPVCsDeletionPolicy && res.Group == "" && res.Kind == "PersistentVolumeClaim" {
+			continue
+		}
+
+		results = append(results, res)
+	}
+
+	return results
+}
+
+// findCirclesForModule enqueues every circle deploying the module.
+func (r *circleController) findCirclesForModule(obj client.Object) []reconcile.Request {
+	circleList := circlerriov1alpha1.CircleList{}
+	err := r.List(context.Background(), &circleList, client.MatchingFields{
+		circleModulesIndex: getIndexKey(obj.GetNamespace(), obj.GetName()),
+	})
+	if err != nil {
+		r.logger.Error("failed to list circles of module", zap.String("module", obj.GetName()), zap.Error(err))
+		return []reconcile.Request{}
+	}
+
+	requests := []reconcile.Request{}
+	for _, circle := range circleList.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+			Name:      circle.GetName(),
+			Namespace: circle.GetNamespace(),
+		}})
+	}
+
+	return requests
+}
+
+// findCirclesForSecret enqueues every circle deploying a module whose
+// repository credentials are stored in the secret.
+func (r *circleController) findCirclesForSecret(obj client.Object) []reconcile.Request {
+	moduleList := circlerriov1alpha1.ModuleList{}
+	err := r.List(context.Background(), &moduleList, client.MatchingFields{
+		moduleSecretRefIndex: getIndexKey(obj.GetNamespace(), obj.GetName()),
+	})
+	if err != nil {
+		r.logger.Error("failed to list modules of secret", zap.String("secret", obj.GetName()), zap.Error(err))
+		return []reconcile.Request{}
+	}
+
+	requests := []reconcile.Request{}
+	for i := range moduleList.Items {
+		requests = append(requests, r.findCirclesForModule(&moduleList.Items[i])...)
+	}
+
+	return requests
+}
+
+// moduleChangedPredicate ignores module updates that change neither the spec
+// nor the commit last fetched from the module repository.
+func moduleChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldModule, ok := e.ObjectOld.(*circlerriov1alpha1.Module)
+			if !ok {
+				return true
+			}
+
+			newModule, ok := e.ObjectNew.(*circlerriov1alpha1.Module)
+			if !ok {
+				return true
+			}
+
+			return oldModule.GetGeneration() != newModule.GetGeneration() ||
+				oldModule.Status.LastFetchedCommit != newModule.Status.LastFetchedCommit
+		},
+	}
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *circleController) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&circlerriov1alpha1.Circle{}).
-		Complete(r)
+	ctx := context.Background()
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &circlerriov1alpha1.Circle{}, circleModulesIndex, indexCircleModules); err != nil {
+		return err
+	}
+
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &circlerriov1alpha1.Module{}, moduleSecretRefIndex, indexModuleSecretRef); err != nil {
+		return err
+	}
+
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&circlerriov1alpha1.Circle{}, builder.WithPredicates(
+			predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{}),
+		)).
+		Watches(
+			&source.Kind{Type: &circlerriov1alpha1.Module{}},
+			handler.EnqueueRequestsFromMapFunc(r.findCirclesForModule),
+			builder.WithPredicates(moduleChangedPredicate()),
+		).
+		Watches(
+			&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.findCirclesForSecret),
+			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}),
+		)
+
+	if r.resourceEvents != nil {
+		b = b.Watches(&source.Channel{Source: r.resourceEvents}, &handler.EnqueueRequestForObject{})
+	}
+
+	return b.Complete(r)
 }
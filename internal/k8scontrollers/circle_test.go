@@ -0,0 +1,190 @@
+package k8scontrollers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"github.com/octopipe/circlerr/internal/domain"
+	"github.com/octopipe/circlerr/internal/templatemanager"
+	"github.com/octopipe/circlerr/internal/utils/annotation"
+	"github.com/octopipe/circlerr/pkg/twice/health"
+	"github.com/octopipe/circlerr/pkg/twice/reconciler"
+	"github.com/octopipe/circlerr/pkg/twice/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+type CircleControllerTestSuite struct {
+	suite.Suite
+	circle circlerriov1alpha1.Circle
+	now    time.Time
+}
+
+func (s *CircleControllerTestSuite) SetupTest() {
+	s.circle = circlerriov1alpha1.Circle{}
+	s.circle.SetName("circle-1")
+	s.circle.SetGeneration(2)
+	s.now = time.Date(2023, 3, 1, 10, 0, 0, 0, time.UTC)
+}
+
+func (s *CircleControllerTestSuite) newApplyResult(kind string, name string, action string, err error) reconciler.ApplyResult {
+	un := &unstructured.Unstructured{}
+	un.SetAnnotations(map[string]string{
+		annotation.ModuleNameAnnotation:      "guestbook-ui",
+		annotation.ModuleNamespaceAnnotation: "default",
+		annotation.ModuleRevisionAnnotation:  "3c1e0c2",
+	})
+
+	return reconciler.ApplyResult{
+		PlanResult: reconciler.PlanResult{
+			Resource: resource.Resource{Group: "apps", Kind: kind, Name: name, Namespace: "default", Object: un},
+			Action:   action,
+		},
+		Err: err,
+	}
+}
+
+func (s *CircleControllerTestSuite) TestNewCircleStatusSynced() {
+	status := newCircleStatus(s.circle, applyAction, []reconciler.ApplyResult{
+		s.newApplyResult("Deployment", "circle-1-guestbook-ui", reconciler.PlanCreateAction, nil),
+		s.newApplyResult("Deployment", "circle-1-old", reconciler.PlanDeleteAction, nil),
+	}, nil, s.now)
+
+	assert.Equal(s.T(), circlerriov1alpha1.SyncedStatus, status.SyncStatus)
+	assert.Equal(s.T(), "", status.Error)
+	assert.Equal(s.T(), []circlerriov1alpha1.CircleStatusResource{{
+		Group:     "apps",
+		Kind:      "Deployment",
+		Name:      "circle-1-guestbook-ui",
+		Namespace: "default",
+		Status: circlerriov1alpha1.CircleResourceStatus{
+			SyncStatus: circlerriov1alpha1.SyncedStatus,
+			SyncedAt:   "2023-03-01T10:00:00Z",
+		},
+		Module: circlerriov1alpha1.CircleResourceModule{Name: "guestbook-ui", Namespace: "default", Revision: "3c1e0c2"},
+	}}, status.Resources)
+
+	ready := meta.FindStatusCondition(status.Conditions, circlerriov1alpha1.ReadyCondition)
+	assert.Equal(s.T(), metav1.ConditionTrue, ready.Status)
+	assert.Equal(s.T(), int64(2), ready.ObservedGeneration)
+	assert.True(s.T(), meta.IsStatusConditionFalse(status.Conditions, circlerriov1alpha1.DegradedCondition))
+}
+
+func (s *CircleControllerTestSuite) TestNewCircleStatusFailed() {
+	status := newCircleStatus(s.circle, applyAction, []reconciler.ApplyResult{
+		s.newApplyResult("Deployment", "circle-1-guestbook-ui", reconciler.PlanUpdateAction, errors.New("forbidden")),
+		s.newApplyResult("Deployment", "circle-1-old", reconciler.PlanDeleteAction, errors.New("timeout")),
+	}, nil, s.now)
+
+	assert.Equal(s.T(), circlerriov1alpha1.FailedStatus, status.SyncStatus)
+	assert.Equal(s.T(), "Deployment circle-1-guestbook-ui: forbidden; Deployment circle-1-old: timeout", status.Error)
+	assert.Equal(s.T(), 2, len(status.Resources))
+	assert.Equal(s.T(), "forbidden", status.Resources[0].Status.Error)
+	assert.True(s.T(), meta.IsStatusConditionTrue(status.Conditions, circlerriov1alpha1.DegradedCondition))
+	assert.True(s.T(), meta.IsStatusConditionFalse(status.Conditions, circlerriov1alpha1.ReadyCondition))
+	assert.True(s.T(), meta.IsStatusConditionFalse(status.Conditions, circlerriov1alpha1.SyncedCondition))
+}
+
+func (s *CircleControllerTestSuite) TestNewCircleStatusRenderFailed() {
+	renderErr := &templatemanager.TemplateError{File: "guestbook/templates/deployment.yaml", Line: 7, Err: errors.New("nil pointer")}
+	status := newCircleStatus(s.circle, applyAction, nil, renderErr, s.now)
+
+	assert.Equal(s.T(), circlerriov1alpha1.FailedStatus, status.SyncStatus)
+	assert.Equal(s.T(), "template error in guestbook/templates/deployment.yaml line 7: nil pointer", status.Error)
+	synced := meta.FindStatusCondition(status.Conditions, circlerriov1alpha1.SyncedCondition)
+	assert.Equal(s.T(), metav1.ConditionFalse, synced.Status)
+	assert.Equal(s.T(), templatemanager.TemplateErrorReason, synced.Reason)
+	assert.Equal(s.T(), templatemanager.TemplateErrorReason, meta.FindStatusCondition(status.Conditions, circlerriov1alpha1.DegradedCondition).Reason)
+}
+
+func (s *CircleControllerTestSuite) TestNewCircleStatusHealth() {
+	progressing := s.newApplyResult("Deployment", "circle-1-guestbook-ui", reconciler.PlanCreateAction, nil)
+	progressing.Status = health.ProgressingStatus
+	progressing.StatusMessage = "0 of 1 updated replicas are available"
+	healthy := s.newApplyResult("Service", "circle-1-guestbook-ui", reconciler.PlanImmutableAction, nil)
+	healthy.Status = health.HealthyStatus
+
+	status := newCircleStatus(s.circle, applyAction, []reconciler.ApplyResult{progressing, healthy}, nil, s.now)
+	assert.Equal(s.T(), circlerriov1alpha1.SyncedStatus, status.SyncStatus)
+	assert.Equal(s.T(), health.ProgressingStatus, status.HealthStatus)
+	assert.Equal(s.T(), health.ProgressingStatus, status.Resources[0].Status.HealthStatus)
+	assert.Equal(s.T(), "0 of 1 updated replicas are available", status.Resources[0].Status.HealthMessage)
+
+	ready := meta.FindStatusCondition(status.Conditions, circlerriov1alpha1.ReadyCondition)
+	assert.Equal(s.T(), metav1.ConditionFalse, ready.Status)
+	assert.Equal(s.T(), "Unhealthy", ready.Reason)
+	assert.Equal(s.T(), "Deployment circle-1-guestbook-ui: 0 of 1 updated replicas are available", ready.Message)
+	assert.True(s.T(), meta.IsStatusConditionTrue(status.Conditions, circlerriov1alpha1.SyncedCondition))
+	assert.True(s.T(), meta.IsStatusConditionFalse(status.Conditions, circlerriov1alpha1.DegradedCondition))
+
+	progressing.Status = health.DegradedStatus
+	status = newCircleStatus(s.circle, applyAction, []reconciler.ApplyResult{progressing, healthy}, nil, s.now)
+	assert.Equal(s.T(), health.DegradedStatus, status.HealthStatus)
+	assert.True(s.T(), meta.IsStatusConditionTrue(status.Conditions, circlerriov1alpha1.DegradedCondition))
+
+	s.circle.Status = status
+	status = newCircleStatus(s.circle, applyAction, nil, errors.New("render failed"), s.now)
+	assert.Equal(s.T(), health.DegradedStatus, status.HealthStatus)
+}
+
+func (s *CircleControllerTestSuite) TestNewCircleStatusHistoryIsBounded() {
+	for i := 0; i < maxCircleHistory+5; i++ {
+		s.circle.Status = newCircleStatus(s.circle, applyAction, nil, fmt.Errorf("render %d", i), s.now)
+	}
+
+	assert.Equal(s.T(), maxCircleHistory, len(s.circle.Status.History))
+	assert.Equal(s.T(), "render 14", s.circle.Status.History[maxCircleHistory-1].Message)
+	assert.Equal(s.T(), 3, len(s.circle.Status.Conditions))
+}
+
+func (s *CircleControllerTestSuite) TestGetDeletionPlan() {
+	planResults := []reconciler.PlanResult{
+		{Resource: resource.Resource{Group: "apps", Kind: "Deployment", Name: "circle-1-guestbook-ui"}, Action: reconciler.PlanDeleteAction},
+		{Resource: resource.Resource{Kind: "PersistentVolumeClaim", Name: "circle-1-data"}, Action: reconciler.PlanDeleteAction},
+	}
+
+	assert.Equal(s.T(), planResults, getDeletionPlan("", planResults))
+	assert.Equal(s.T(), planResults, getDeletionPlan(domain.DeleteDeletionPolicy, planResults))
+	assert.Equal(s.T(), planResults[:1], getDeletionPlan(domain.KeepPVCsDeletionPolicy, planResults))
+	assert.Empty(s.T(), getDeletionPlan(domain.OrphanDeletionPolicy, planResults))
+}
+
+func (s *CircleControllerTestSuite) TestResourceEvents() {
+	un := &unstructured.Unstructured{}
+	un.SetGeneration(1)
+	un.SetAnnotations(map[string]string{
+		annotation.ControlledByAnnotation:    annotation.ControlledByAnnotationValue,
+		annotation.CircleNameAnnotation:      "circle-1",
+		annotation.CircleNamespaceAnnotation: "workspace-1",
+	})
+	updated := un.DeepCopy()
+
+	events := NewResourceEvents()
+	events.OnChange(watch.Modified, resource.Resource{Object: un}, resource.Resource{Object: updated})
+	assert.Equal(s.T(), 0, len(events))
+
+	events.OnChange(watch.Modified, resource.Resource{Object: un}, resource.Resource{Object: updated, Health: health.Status{Status: health.ProgressingStatus}})
+	assert.Equal(s.T(), 1, len(events))
+	<-events
+
+	updated.SetGeneration(2)
+	events.OnChange(watch.Modified, resource.Resource{Object: un}, resource.Resource{Object: updated})
+	events.OnChange(watch.Deleted, resource.Resource{Object: un}, resource.Resource{})
+	events.OnChange(watch.Added, resource.Resource{}, resource.Resource{Object: &unstructured.Unstructured{}})
+	assert.Equal(s.T(), 2, len(events))
+
+	e := <-events
+	assert.Equal(s.T(), "circle-1", e.Object.GetName())
+	assert.Equal(s.T(), "workspace-1", e.Object.GetNamespace())
+}
+
+func TestCircleControllerTestSuite(t *testing.T) {
+	suite.Run(t, new(CircleControllerTestSuite))
+}
@@ -0,0 +1,58 @@
+package k8scontrollers
+
+import (
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"github.com/octopipe/circlerr/internal/utils/annotation"
+	"github.com/octopipe/circlerr/pkg/twice/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+const resourceEventsBufferSize = 1024
+
+// ResourceEvents receives the changes of resources seen by the reconciler
+// watches and turns them into events of the circles that deployed them.
+type ResourceEvents chan event.GenericEvent
+
+func NewResourceEvents() ResourceEvents {
+	return make(ResourceEvents, resourceEventsBufferSize)
+}
+
+// OnChange enqueues the circle of a resource that was deleted or had its spec
+// or health changed. Other status updates are ignored, and events are dropped
+// while the buffer is full since the resync interval corrects them later.
+func (e ResourceEvents) OnChange(eventType watch.EventType, old resource.Resource, new resource.Resource) {
+	obj := new.Object
+	if obj == nil {
+		obj = old.Object
+	}
+
+	if obj == nil || !isResourceChanged(eventType, old, new) {
+		return
+	}
+
+	annotations := obj.GetAnnotations()
+	circleName := annotations[annotation.CircleNameAnnotation]
+	if annotations[annotation.ControlledByAnnotation] != annotation.ControlledByAnnotationValue || circleName == "" {
+		return
+	}
+
+	circle := &circlerriov1alpha1.Circle{ObjectMeta: metav1.ObjectMeta{
+		Name:      circleName,
+		Namespace: annotations[annotation.CircleNamespaceAnnotation],
+	}}
+
+	select {
+	case e <- event.GenericEvent{Object: circle}:
+	default:
+	}
+}
+
+func isResourceChanged(eventType watch.EventType, old resource.Resource, new resource.Resource) bool {
+	if eventType == watch.Deleted || old.Object == nil || new.Object == nil {
+		return true
+	}
+
+	return old.Object.GetGeneration() != new.Object.GetGeneration() || old.Health.Status != new.Health.Status
+}
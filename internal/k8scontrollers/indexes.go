@@ -0,0 +1,63 @@
+package k8scontrollers
+
+import (
+	"fmt"
+
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	circleModulesIndex   = "spec.modules"
+	moduleSecretRefIndex = "spec.secretRef"
+)
+
+// indexCircleModules indexes circles by the modules they deploy.
+func indexCircleModules(obj client.Object) []string {
+	circle, ok := obj.(*circlerriov1alpha1.Circle)
+	if !ok {
+		return nil
+	}
+
+	keys := []string{}
+	for _, circleModule := range circle.Spec.Modules {
+		keys = append(keys, getIndexKey(circleModule.Namespace, circleModule.Name))
+	}
+
+	return keys
+}
+
+// indexModuleSecretRef indexes modules by the secrets holding their repository
+// and chart source credentials, a secret without namespace is looked up in the
+// module namespace.
+func indexModuleSecretRef(obj client.Object) []string {
+	module, ok := obj.(*circlerriov1alpha1.Module)
+	if !ok {
+		return nil
+	}
+
+	secretRefs := []*circlerriov1alpha1.SecretRef{module.Spec.SecretRef}
+	if module.Spec.Chart != nil {
+		secretRefs = append(secretRefs, module.Spec.Chart.SecretRef)
+	}
+
+	keys := []string{}
+	for _, secretRef := range secretRefs {
+		if secretRef == nil {
+			continue
+		}
+
+		namespace := secretRef.Namespace
+		if namespace == "" {
+			namespace = module.GetNamespace()
+		}
+
+		keys = append(keys, getIndexKey(namespace, secretRef.Name))
+	}
+
+	return keys
+}
+
+func getIndexKey(namespace string, name string) string {
+	return fmt.Sprintf("%s/%s", namespace, name)
+}
@@ -0,0 +1,137 @@
+package k8scontrollers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"github.com/octopipe/circlerr/internal/gitmanager"
+	"github.com/octopipe/circlerr/internal/templatemanager"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// moduleSyncInterval is how often module repositories are fetched to detect
+// new commits and unreachable repositories.
+const moduleSyncInterval = 3 * time.Minute
+
+type ModuleController interface {
+	Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error)
+}
+
+type moduleController struct {
+	client.Client
+	logger          *zap.Logger
+	scheme          *runtime.Scheme
+	gitManager      gitmanager.Manager
+	templateManager templatemanager.TemplateManager
+}
+
+func NewModuleController(
+	logger *zap.Logger,
+	client client.Client,
+	scheme *runtime.Scheme,
+	gitManager gitmanager.Manager,
+	templateManager templatemanager.TemplateManager,
+) moduleController {
+	return moduleController{
+		logger:          logger,
+		Client:          client,
+		scheme:          scheme,
+		gitManager:      gitManager,
+		templateManager: templateManager,
+	}
+}
+
+func (r *moduleController) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	module := circlerriov1alpha1.Module{}
+	err := r.Get(ctx, req.NamespacedName, &module)
+	if err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if module.GetDeletionTimestamp() != nil {
+		return ctrl.Result{}, nil
+	}
+
+	r.logger.Info(fmt.Sprintf("sync module %s", req))
+	status := *module.Status.DeepCopy()
+	err = r.sync(ctx, module, &status)
+	module.Status = newModuleStatus(module, status, err, time.Now())
+	if err != nil {
+		r.logger.Info(fmt.Sprintf("module %s is not ready", req), zap.Error(err))
+	}
+
+	if err := r.Status().Update(ctx, &module); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Modules failing to render are retried with backoff, capped by the sync
+	// interval, so fixes to the values or chart are picked up sooner.
+	if templatemanager.ErrorReason(err) != "" {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: moduleSyncInterval}, nil
+}
+
+// sync fetches the module repository, records its refs and renders its
+// default branch to check the module can be deployed by circles.
+func (r *moduleController) sync(ctx context.Context, module circlerriov1alpha1.Module, status *circlerriov1alpha1.ModuleStatus) error {
+	if module.Spec.Url == "" {
+		return r.templateManager.ValidateModule(ctx, "", module)
+	}
+
+	revision, refs, err := r.gitManager.SyncDefault(module)
+	if err != nil {
+		return err
+	}
+
+	defer revision.Release()
+
+	status.DefaultRef = refs.Default
+	status.Branches = refs.Branches
+	status.Tags = refs.Tags
+	status.LastFetchedCommit = revision.Commit
+	return r.templateManager.ValidateModule(ctx, revision.Path, module)
+}
+
+func newModuleStatus(module circlerriov1alpha1.Module, status circlerriov1alpha1.ModuleStatus, syncErr error, now time.Time) circlerriov1alpha1.ModuleStatus {
+	status.LastFetchedAt = now.UTC().Format(time.RFC3339)
+	status.Status = circlerriov1alpha1.SyncedStatus
+	status.Error = ""
+	message := fmt.Sprintf("commit %s of %s rendered", status.LastFetchedCommit, status.DefaultRef)
+	if module.Spec.Url == "" && module.Spec.Chart != nil {
+		message = fmt.Sprintf("chart %s rendered", module.Spec.Chart.Chart)
+	}
+	if syncErr != nil {
+		status.Status = circlerriov1alpha1.FailedStatus
+		status.Error = syncErr.Error()
+		message = status.Error
+	}
+
+	failedReason := "SyncFailed"
+	if reason := templatemanager.ErrorReason(syncErr); reason != "" {
+		failedReason = reason
+	}
+
+	setCondition(&status.Conditions, module.GetGeneration(), circlerriov1alpha1.ReadyCondition, syncErr == nil, "Ready", failedReason, message)
+	return status
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *moduleController) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&circlerriov1alpha1.Module{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(controller.Options{
+			RateLimiter: workqueue.NewItemExponentialFailureRateLimiter(time.Second, moduleSyncInterval),
+		}).
+		Complete(r)
+}
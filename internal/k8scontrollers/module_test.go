@@ -0,0 +1,209 @@
+package k8scontrollers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"github.com/octopipe/circlerr/internal/domain"
+	"github.com/octopipe/circlerr/internal/gitmanager"
+	"github.com/octopipe/circlerr/internal/templatemanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+const guestbookDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: guestbook-ui
+spec:
+  template:
+    spec:
+      containers:
+      - name: guestbook-ui
+        image: guestbook-ui
+`
+
+type ModuleControllerTestSuite struct {
+	suite.Suite
+	client     client.Client
+	controller moduleController
+	commit     string
+	module     circlerriov1alpha1.Module
+}
+
+func (s *ModuleControllerTestSuite) SetupTest() {
+	s.T().Setenv("GIT_TMP_DIR", s.T().TempDir())
+
+	repositoryPath := s.T().TempDir()
+	repo, err := git.PlainInit(repositoryPath, false)
+	assert.NoError(s.T(), err)
+
+	path := filepath.Join(repositoryPath, "guestbook", "deployment.yaml")
+	assert.NoError(s.T(), os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(s.T(), os.WriteFile(path, []byte(guestbookDeployment), 0644))
+
+	w, err := repo.Worktree()
+	assert.NoError(s.T(), err)
+	_, err = w.Add("guestbook/deployment.yaml")
+	assert.NoError(s.T(), err)
+	hash, err := w.Commit("guestbook", &git.CommitOptions{
+		Author: &object.Signature{Name: "circlerr", Email: "circlerr@circlerr.io", When: time.Now()},
+	})
+	assert.NoError(s.T(), err)
+	s.commit = hash.String()
+
+	s.module = circlerriov1alpha1.Module{
+		ObjectMeta: metav1.ObjectMeta{Name: "guestbook", Namespace: "default"},
+		Spec: circlerriov1alpha1.ModuleSpec{
+			Url:          repositoryPath,
+			Path:         "guestbook",
+			TemplateType: domain.SimpleModuleTemplateType,
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = circlerriov1alpha1.AddToScheme(scheme)
+	s.client = fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithIndex(&circlerriov1alpha1.Circle{}, circleModulesIndex, indexCircleModules).
+		WithIndex(&circlerriov1alpha1.Module{}, moduleSecretRefIndex, indexModuleSecretRef).
+		Build()
+
+	gitManager := gitmanager.NewManager(s.client)
+	s.controller = NewModuleController(zap.NewNop(), s.client, scheme, gitManager, templatemanager.NewTemplateManager(s.client, gitManager))
+}
+
+func (s *ModuleControllerTestSuite) reconcile() circlerriov1alpha1.Module {
+	assert.NoError(s.T(), s.client.Create(context.TODO(), &s.module))
+
+	key := types.NamespacedName{Namespace: s.module.Namespace, Name: s.module.Name}
+	result, err := s.controller.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), moduleSyncInterval, result.RequeueAfter)
+
+	module := circlerriov1alpha1.Module{}
+	assert.NoError(s.T(), s.client.Get(context.TODO(), key, &module))
+	return module
+}
+
+func (s *ModuleControllerTestSuite) TestReconcile() {
+	module := s.reconcile()
+
+	assert.Equal(s.T(), circlerriov1alpha1.SyncedStatus, module.Status.Status)
+	assert.Equal(s.T(), "", module.Status.Error)
+	assert.Equal(s.T(), "master", module.Status.DefaultRef)
+	assert.Equal(s.T(), []string{"master"}, module.Status.Branches)
+	assert.Equal(s.T(), s.commit, module.Status.LastFetchedCommit)
+	assert.NotEmpty(s.T(), module.Status.LastFetchedAt)
+	assert.True(s.T(), meta.IsStatusConditionTrue(module.Status.Conditions, circlerriov1alpha1.ReadyCondition))
+}
+
+func (s *ModuleControllerTestSuite) TestReconcileMissingPath() {
+	s.module.Spec.Path = "unknown"
+	module := s.reconcile()
+
+	assert.Equal(s.T(), circlerriov1alpha1.FailedStatus, module.Status.Status)
+	assert.Contains(s.T(), module.Status.Error, "unknown")
+	assert.Equal(s.T(), s.commit, module.Status.LastFetchedCommit)
+	assert.True(s.T(), meta.IsStatusConditionFalse(module.Status.Conditions, circlerriov1alpha1.ReadyCondition))
+}
+
+func (s *ModuleControllerTestSuite) TestReconcileRenderFailed() {
+	s.module.Spec.TemplateType = domain.HelmModuleTemplateType
+	assert.NoError(s.T(), s.client.Create(context.TODO(), &s.module))
+
+	key := types.NamespacedName{Namespace: s.module.Namespace, Name: s.module.Name}
+	_, err := s.controller.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key})
+	assert.Equal(s.T(), templatemanager.InvalidChartReason, templatemanager.ErrorReason(err))
+
+	module := circlerriov1alpha1.Module{}
+	assert.NoError(s.T(), s.client.Get(context.TODO(), key, &module))
+	assert.Equal(s.T(), circlerriov1alpha1.FailedStatus, module.Status.Status)
+	ready := meta.FindStatusCondition(module.Status.Conditions, circlerriov1alpha1.ReadyCondition)
+	assert.Equal(s.T(), metav1.ConditionFalse, ready.Status)
+	assert.Equal(s.T(), templatemanager.InvalidChartReason, ready.Reason)
+}
+
+func (s *ModuleControllerTestSuite) TestReconcileUnreachableRepository() {
+	s.module.Spec.Url = filepath.Join(s.T().TempDir(), "unknown")
+	module := s.reconcile()
+
+	assert.Equal(s.T(), circlerriov1alpha1.FailedStatus, module.Status.Status)
+	assert.NotEmpty(s.T(), module.Status.Error)
+	assert.Equal(s.T(), "", module.Status.LastFetchedCommit)
+}
+
+func (s *ModuleControllerTestSuite) TestFindCirclesForModule() {
+	for _, circle := range []circlerriov1alpha1.Circle{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "circle-1", Namespace: "workspace-1"},
+			Spec:       circlerriov1alpha1.CircleSpec{Modules: []circlerriov1alpha1.CircleModule{{Name: "guestbook", Namespace: "default"}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "circle-2", Namespace: "workspace-1"},
+			Spec:       circlerriov1alpha1.CircleSpec{Modules: []circlerriov1alpha1.CircleModule{{Name: "guestbook", Namespace: "workspace-1"}}},
+		},
+	} {
+		circle := circle
+		assert.NoError(s.T(), s.client.Create(context.TODO(), &circle))
+	}
+
+	circleController := circleController{Client: s.client, logger: zap.NewNop()}
+	requests := circleController.findCirclesForModule(&s.module)
+	assert.Equal(s.T(), 1, len(requests))
+	assert.Equal(s.T(), types.NamespacedName{Name: "circle-1", Namespace: "workspace-1"}, requests[0].NamespacedName)
+}
+
+func (s *ModuleControllerTestSuite) TestFindCirclesForSecret() {
+	s.module.Spec.SecretRef = &circlerriov1alpha1.SecretRef{Name: "guestbook-credentials"}
+	assert.NoError(s.T(), s.client.Create(context.TODO(), &s.module))
+
+	circle := circlerriov1alpha1.Circle{
+		ObjectMeta: metav1.ObjectMeta{Name: "circle-1", Namespace: "workspace-1"},
+		Spec:       circlerriov1alpha1.CircleSpec{Modules: []circlerriov1alpha1.CircleModule{{Name: "guestbook", Namespace: "default"}}},
+	}
+	assert.NoError(s.T(), s.client.Create(context.TODO(), &circle))
+
+	circleController := circleController{Client: s.client, logger: zap.NewNop()}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "guestbook-credentials", Namespace: "default"}}
+	requests := circleController.findCirclesForSecret(secret)
+	assert.Equal(s.T(), 1, len(requests))
+	assert.Equal(s.T(), types.NamespacedName{Name: "circle-1", Namespace: "workspace-1"}, requests[0].NamespacedName)
+
+	secret.SetNamespace("workspace-1")
+	assert.Empty(s.T(), circleController.findCirclesForSecret(secret))
+}
+
+func (s *ModuleControllerTestSuite) TestModuleChangedPredicate() {
+	oldModule := s.module.DeepCopy()
+	oldModule.Status.LastFetchedCommit = s.commit
+	newModule := oldModule.DeepCopy()
+	newModule.Status.LastFetchedAt = time.Now().String()
+
+	p := moduleChangedPredicate()
+	assert.False(s.T(), p.Update(event.UpdateEvent{ObjectOld: oldModule, ObjectNew: newModule}))
+
+	newModule.Status.LastFetchedCommit = "3c1e0c2"
+	assert.True(s.T(), p.Update(event.UpdateEvent{ObjectOld: oldModule, ObjectNew: newModule}))
+}
+
+func TestModuleControllerTestSuite(t *testing.T) {
+	suite.Run(t, new(ModuleControllerTestSuite))
+}
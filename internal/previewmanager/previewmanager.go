@@ -0,0 +1,70 @@
+package previewmanager
+
+import (
+	"context"
+	"fmt"
+
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"github.com/octopipe/circlerr/internal/routingmanager"
+	"github.com/octopipe/circlerr/internal/templatemanager"
+	"github.com/octopipe/circlerr/internal/utils/annotation"
+	"github.com/octopipe/circlerr/pkg/twice/reconciler"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type PreviewManager interface {
+	Preview(ctx context.Context, circle circlerriov1alpha1.Circle) ([]reconciler.PlanResult, error)
+}
+
+type previewManager struct {
+	templateManager templatemanager.TemplateManager
+	routingManager  routingmanager.RoutingManager
+	planner         reconciler.Planner
+}
+
+func NewPreviewManager(templateManager templatemanager.TemplateManager, routingManager routingmanager.RoutingManager, planner reconciler.Planner) PreviewManager {
+	return previewManager{
+		templateManager: templateManager,
+		routingManager:  routingManager,
+		planner:         planner,
+	}
+}
+
+// Preview renders the modules of the circle and plans them against the live
+// objects, nothing is applied. Routing shared by the circles of the namespace
+// is not part of the preview.
+func (m previewManager) Preview(ctx context.Context, circle circlerriov1alpha1.Circle) ([]reconciler.PlanResult, error) {
+	manifests, err := m.templateManager.RenderManifests(ctx, circle)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.planner.Plan(
+		ctx,
+		manifests,
+		circle.Spec.Namespace,
+		IsCircleObject(circle),
+		reconciler.WithPreHook(CirclePreHook(circle, m.routingManager)),
+	)
+}
+
+// CirclePreHook prepares the objects rendered for the circle, prefixing their
+// names with the circle and annotating them so they can be found later.
+func CirclePreHook(circle circlerriov1alpha1.Circle, routingManager routingmanager.RoutingManager) func(un *unstructured.Unstructured) *unstructured.Unstructured {
+	return func(un *unstructured.Unstructured) *unstructured.Unstructured {
+		un.SetName(fmt.Sprintf("%s-%s", circle.GetName(), un.GetName()))
+		un = annotation.AddDefaultAnnotationsToObject(un, circle)
+		un = routingManager.PrepareObject(un, circle)
+		return un
+	}
+}
+
+// IsCircleObject reports whether an object was deployed by the circle.
+func IsCircleObject(circle circlerriov1alpha1.Circle) func(un *unstructured.Unstructured) bool {
+	return func(un *unstructured.Unstructured) bool {
+		circleName := un.GetAnnotations()[annotation.CircleNameAnnotation]
+		circleNamespace := un.GetAnnotations()[annotation.CircleNamespaceAnnotation]
+
+		return circleName == circle.Name && circleNamespace == circle.Namespace
+	}
+}
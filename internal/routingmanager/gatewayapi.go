@@ -0,0 +1,111 @@
+package routingmanager
+
+import (
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var httpRouteGVK = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1beta1", Kind: "HTTPRoute"}
+
+type gatewayAPIProvider struct {
+	gatewayName      string
+	gatewayNamespace string
+}
+
+// NewGatewayAPIProvider returns a provider attaching routes to the given
+// gateway. Without a gateway the routes are attached to the frontend Service of
+// the module service, as expected by meshes implementing Gateway API.
+func NewGatewayAPIProvider(gatewayName string, gatewayNamespace string) Provider {
+	return gatewayAPIProvider{
+		gatewayName:      gatewayName,
+		gatewayNamespace: gatewayNamespace,
+	}
+}
+
+// PrepareObject labels the pods of circle workloads and restricts the circle
+// services to them, backendRefs point to services and have no subsets.
+func (p gatewayAPIProvider) PrepareObject(un *unstructured.Unstructured, circle circlerriov1alpha1.Circle) *unstructured.Unstructured {
+	return selectCirclePods(labelPodTemplate(un, circle), circle)
+}
+
+// GetManifests renders an HTTPRoute for every service route, with a rule per
+// MATCH circle and a weighted rule for the remaining traffic. The frontend
+// Service is rendered too when routes attach to it.
+func (p gatewayAPIProvider) GetManifests(routes []ServiceRoute) ([]*unstructured.Unstructured, error) {
+	objects := []*unstructured.Unstructured{}
+
+	for _, route := range routes {
+		rules := []interface{}{}
+		for _, backend := range GetMatchBackends(route) {
+			headers := []interface{}{}
+			for _, key := range sortedKeys(backend.Routing.Match.Headers) {
+				headers = append(headers, map[string]interface{}{
+					"type":  "Exact",
+					"name":  key,
+					"value": backend.Routing.Match.Headers[key],
+				})
+			}
+
+			rules = append(rules, map[string]interface{}{
+				"matches":     []interface{}{map[string]interface{}{"headers": headers}},
+				"backendRefs": []interface{}{getBackendRef(backend.Host, backend.Port)},
+			})
+		}
+
+		weightedBackends, err := GetWeightedBackends(route)
+		if err != nil {
+			return nil, err
+		}
+
+		backendRefs := []interface{}{}
+		for _, backend := range weightedBackends {
+			backendRef := getBackendRef(backend.Host, backend.Port)
+			backendRef["weight"] = backend.Weight
+			backendRefs = append(backendRefs, backendRef)
+		}
+
+		if len(backendRefs) > 0 {
+			rules = append(rules, map[string]interface{}{"backendRefs": backendRefs})
+		}
+
+		httpRoute := newObject(httpRouteGVK, route.Name, route.Namespace)
+		httpRoute.Object["spec"] = map[string]interface{}{
+			"parentRefs": []interface{}{p.getParentRef(route)},
+			"rules":      rules,
+		}
+		if p.gatewayName == "" {
+			objects = append(objects, GetFrontendService(route))
+		}
+
+		objects = append(objects, httpRoute)
+	}
+
+	return objects, nil
+}
+
+func (p gatewayAPIProvider) getParentRef(route ServiceRoute) map[string]interface{} {
+	if p.gatewayName == "" {
+		return map[string]interface{}{
+			"group": "",
+			"kind":  "Service",
+			"name":  route.Name,
+		}
+	}
+
+	parentRef := map[string]interface{}{"name": p.gatewayName}
+	if p.gatewayNamespace != "" {
+		parentRef["namespace"] = p.gatewayNamespace
+	}
+
+	return parentRef
+}
+
+func getBackendRef(host string, port int64) map[string]interface{} {
+	backendRef := map[string]interface{}{"name": host}
+	if port != 0 {
+		backendRef["port"] = port
+	}
+
+	return backendRef
+}
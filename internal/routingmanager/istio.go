@@ -0,0 +1,101 @@
+package routingmanager
+
+import (
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"github.com/octopipe/circlerr/internal/utils/annotation"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	virtualServiceGVK  = schema.GroupVersionKind{Group: "networking.istio.io", Version: "v1beta1", Kind: "VirtualService"}
+	destinationRuleGVK = schema.GroupVersionKind{Group: "networking.istio.io", Version: "v1beta1", Kind: "DestinationRule"}
+)
+
+type istioProvider struct{}
+
+func NewIstioProvider() Provider {
+	return istioProvider{}
+}
+
+// PrepareObject labels the pods of circle workloads, the services keep the
+// selector of the module service and subsets pick the pods of each circle.
+func (p istioProvider) PrepareObject(un *unstructured.Unstructured, circle circlerriov1alpha1.Circle) *unstructured.Unstructured {
+	return labelPodTemplate(un, circle)
+}
+
+// GetManifests renders the frontend Service and a VirtualService for every
+// service route and a DestinationRule for every circle copy. Each
+// DestinationRule declares a subset selecting only the pods of its circle,
+// because circle copies of a service keep the selector of the module service.
+func (p istioProvider) GetManifests(routes []ServiceRoute) ([]*unstructured.Unstructured, error) {
+	objects := []*unstructured.Unstructured{}
+
+	for _, route := range routes {
+		httpRoutes := []interface{}{}
+		for _, backend := range GetMatchBackends(route) {
+			headers := map[string]interface{}{}
+			for key, value := range backend.Routing.Match.Headers {
+				headers[key] = map[string]interface{}{"exact": value}
+			}
+
+			httpRoutes = append(httpRoutes, map[string]interface{}{
+				"name":  backend.Circle,
+				"match": []interface{}{map[string]interface{}{"headers": headers}},
+				"route": []interface{}{map[string]interface{}{
+					"destination": getIstioDestination(backend.Host, backend.Circle),
+				}},
+			})
+		}
+
+		weightedBackends, err := GetWeightedBackends(route)
+		if err != nil {
+			return nil, err
+		}
+
+		destinations := []interface{}{}
+		for _, backend := range weightedBackends {
+			destinations = append(destinations, map[string]interface{}{
+				"destination": getIstioDestination(backend.Host, backend.Circle),
+				"weight":      backend.Weight,
+			})
+		}
+
+		if len(destinations) > 0 {
+			httpRoutes = append(httpRoutes, map[string]interface{}{
+				"name":  "default",
+				"route": destinations,
+			})
+		}
+
+		virtualService := newObject(virtualServiceGVK, route.Name, route.Namespace)
+		virtualService.Object["spec"] = map[string]interface{}{
+			"hosts": []interface{}{route.Name},
+			"http":  httpRoutes,
+		}
+		objects = append(objects, GetFrontendService(route), virtualService)
+
+		for _, backend := range route.Backends {
+			destinationRule := newObject(destinationRuleGVK, backend.Host, route.Namespace)
+			destinationRule.Object["spec"] = map[string]interface{}{
+				"host": backend.Host,
+				"subsets": []interface{}{map[string]interface{}{
+					"name":   backend.Circle,
+					"labels": map[string]interface{}{annotation.CircleLabel: backend.Circle},
+				}},
+			}
+			objects = append(objects, destinationRule)
+		}
+	}
+
+	return objects, nil
+}
+
+func getIstioDestination(host string, circle string) map[string]interface{} {
+	destination := map[string]interface{}{"host": host}
+	if circle != "" {
+		destination["subset"] = circle
+	}
+
+	return destination
+}
@@ -0,0 +1,117 @@
+package routingmanager
+
+import (
+	"fmt"
+	"strconv"
+
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"github.com/octopipe/circlerr/internal/domain"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	nginxCanaryAnnotation            = "nginx.ingress.kubernetes.io/canary"
+	nginxCanaryByHeaderAnnotation    = "nginx.ingress.kubernetes.io/canary-by-header"
+	nginxCanaryHeaderValueAnnotation = "nginx.ingress.kubernetes.io/canary-by-header-value"
+	nginxCanaryWeightAnnotation      = "nginx.ingress.kubernetes.io/canary-weight"
+)
+
+var ingressGK = schema.GroupKind{Group: "networking.k8s.io", Kind: "Ingress"}
+
+type nginxProvider struct{}
+
+// NewNginxProvider returns a provider routing through the canary annotations
+// of ingress-nginx. The ingress copy of a DEFAULT circle is the main ingress
+// and the copies of MATCH and CANARY circles become its canaries. ingress-nginx
+// only honors one canary per host and path, and only the first header of a
+// MATCH circle, sorted by name, is used.
+func NewNginxProvider() Provider {
+	return nginxProvider{}
+}
+
+// PrepareObject points the ingress copies of a circle to the services of the
+// circle and annotates them with its routing. Services are restricted to the
+// pods of the circle, as ingress-nginx has no notion of subsets.
+func (p nginxProvider) PrepareObject(un *unstructured.Unstructured, circle circlerriov1alpha1.Circle) *unstructured.Unstructured {
+	un = selectCirclePods(labelPodTemplate(un, circle), circle)
+	if un.GroupVersionKind().GroupKind() != ingressGK {
+		return un
+	}
+
+	prefixIngressBackends(un, circle)
+
+	annotations := un.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	routing := circle.Spec.Routing
+	switch {
+	case routing.Strategy == domain.MatchRoutingStrategy && routing.Match != nil && len(routing.Match.Headers) > 0:
+		key := sortedKeys(routing.Match.Headers)[0]
+		annotations[nginxCanaryAnnotation] = "true"
+		annotations[nginxCanaryByHeaderAnnotation] = key
+		annotations[nginxCanaryHeaderValueAnnotation] = routing.Match.Headers[key]
+	case routing.Strategy == domain.CanaryRoutingStrategy && routing.Canary != nil:
+		annotations[nginxCanaryAnnotation] = "true"
+		annotations[nginxCanaryWeightAnnotation] = strconv.Itoa(routing.Canary.Weight)
+	}
+
+	un.SetAnnotations(annotations)
+	return un
+}
+
+// GetManifests renders nothing, the routing lives in the ingress copies of each
+// circle.
+func (p nginxProvider) GetManifests(routes []ServiceRoute) ([]*unstructured.Unstructured, error) {
+	return []*unstructured.Unstructured{}, nil
+}
+
+func prefixIngressBackends(un *unstructured.Unstructured, circle circlerriov1alpha1.Circle) {
+	prefixBackend := func(backend map[string]interface{}) {
+		name, found, err := unstructured.NestedString(backend, "service", "name")
+		if err != nil || !found {
+			return
+		}
+
+		_ = unstructured.SetNestedField(backend, fmt.Sprintf("%s-%s", circle.GetName(), name), "service", "name")
+	}
+
+	if backend, found, err := unstructured.NestedMap(un.Object, "spec", "defaultBackend"); err == nil && found {
+		prefixBackend(backend)
+		_ = unstructured.SetNestedMap(un.Object, backend, "spec", "defaultBackend")
+	}
+
+	rules, found, err := unstructured.NestedSlice(un.Object, "spec", "rules")
+	if err != nil || !found {
+		return
+	}
+
+	for _, rule := range rules {
+		rule, ok := rule.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		paths, found, err := unstructured.NestedSlice(rule, "http", "paths")
+		if err != nil || !found {
+			continue
+		}
+
+		for _, path := range paths {
+			path, ok := path.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			if backend, ok := path["backend"].(map[string]interface{}); ok {
+				prefixBackend(backend)
+			}
+		}
+
+		_ = unstructured.SetNestedSlice(rule, paths, "http", "paths")
+	}
+
+	_ = unstructured.SetNestedSlice(un.Object, rules, "spec", "rules")
+}
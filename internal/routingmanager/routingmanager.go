@@ -0,0 +1,397 @@
+package routingmanager
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"github.com/octopipe/circlerr/internal/domain"
+	"github.com/octopipe/circlerr/internal/utils/annotation"
+	"github.com/octopipe/circlerr/internal/utils/manifest"
+	"github.com/octopipe/circlerr/pkg/twice/cache"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	serviceGK  = schema.GroupKind{Kind: "Service"}
+	serviceGVK = schema.GroupVersionKind{Version: "v1", Kind: "Service"}
+)
+
+// ServiceRoute is a module service and the circle copies its traffic is split
+// between. Selector and Ports are the ones of the module service, taken from
+// its circle copies.
+type ServiceRoute struct {
+	Name      string
+	Namespace string
+	Selector  map[string]string
+	Ports     []interface{}
+	Backends  []Backend
+}
+
+// Backend is the copy of a service deployed by a circle.
+type Backend struct {
+	Host    string
+	Circle  string
+	Port    int64
+	Routing circlerriov1alpha1.CircleRouting
+}
+
+// WeightedBackend is a share of the traffic not matched by any MATCH circle.
+type WeightedBackend struct {
+	Host   string
+	Circle string
+	Port   int64
+	Weight int64
+}
+
+// Provider turns the routing of circles into provider specific objects.
+type Provider interface {
+	// PrepareObject adapts an object deployed by a circle before it is applied.
+	PrepareObject(un *unstructured.Unstructured, circle circlerriov1alpha1.Circle) *unstructured.Unstructured
+	// GetManifests renders the objects shared by every circle of a namespace.
+	GetManifests(routes []ServiceRoute) ([]*unstructured.Unstructured, error)
+}
+
+// NewProvider returns the routing provider configured for the controller,
+// Istio is used when no provider is set.
+func NewProvider(name string) (Provider, error) {
+	switch name {
+	case "", domain.IstioRoutingProvider:
+		return NewIstioProvider(), nil
+	case domain.GatewayAPIRoutingProvider:
+		return NewGatewayAPIProvider(os.Getenv("ROUTING_GATEWAY_NAME"), os.Getenv("ROUTING_GATEWAY_NAMESPACE")), nil
+	case domain.NginxRoutingProvider:
+		return NewNginxProvider(), nil
+	default:
+		return nil, fmt.Errorf("invalid routing provider %s", name)
+	}
+}
+
+type RoutingManager struct {
+	client.Client
+	cache    cache.Cache
+	provider Provider
+}
+
+func NewRoutingManager(client client.Client, cache cache.Cache, provider Provider) RoutingManager {
+	cache.AddIndex(annotation.CircleIndex, annotation.IndexCircle)
+	return RoutingManager{
+		Client:   client,
+		cache:    cache,
+		provider: provider,
+	}
+}
+
+// RenderManifests renders the routing objects of every module service deployed
+// into the namespace. Nothing is rendered unless a circle targeting the
+// namespace declares a routing strategy.
+func (m RoutingManager) RenderManifests(ctx context.Context, namespace string) ([]string, error) {
+	routes, err := m.getServiceRoutes(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := m.provider.GetManifests(routes)
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := []string{}
+	for _, un := range objects {
+		annotations := un.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[annotation.ControlledByAnnotation] = annotation.ControlledByAnnotationValue
+		annotations[annotation.RoutingNamespaceAnnotation] = namespace
+		un.SetAnnotations(annotations)
+
+		rawJSON, err := un.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+
+		manifests = append(manifests, string(rawJSON))
+	}
+
+	return manifests, nil
+}
+
+// IsManaged reports whether an object holds routing rendered for the namespace.
+func IsManaged(un *unstructured.Unstructured, namespace string) bool {
+	return un.GetAnnotations()[annotation.RoutingNamespaceAnnotation] == namespace
+}
+
+// PrepareObject adapts an object deployed by the circle to the routing provider.
+func (m RoutingManager) PrepareObject(un *unstructured.Unstructured, circle circlerriov1alpha1.Circle) *unstructured.Unstructured {
+	return m.provider.PrepareObject(un, circle)
+}
+
+func (m RoutingManager) getServiceRoutes(ctx context.Context, namespace string) ([]ServiceRoute, error) {
+	circleList := circlerriov1alpha1.CircleList{}
+	if err := m.List(ctx, &circleList); err != nil {
+		return nil, err
+	}
+
+	hasRouting := false
+	circles := map[string]circlerriov1alpha1.Circle{}
+	for _, circle := range circleList.Items {
+		if circle.Spec.Namespace != namespace || circle.GetDeletionTimestamp() != nil {
+			continue
+		}
+
+		circles[annotation.GetCircleIndexKey(circle.GetNamespace(), circle.GetName())] = circle
+		hasRouting = hasRouting || circle.Spec.Routing.Strategy != ""
+	}
+
+	if !hasRouting {
+		return []ServiceRoute{}, nil
+	}
+
+	routes := map[string]*ServiceRoute{}
+	for circleKey, circle := range circles {
+		for _, service := range m.cache.ByIndex(annotation.CircleIndex, circleKey) {
+			if service.Namespace != namespace || service.Group != serviceGK.Group || service.Kind != serviceGK.Kind {
+				continue
+			}
+
+			name := strings.TrimPrefix(service.Name, fmt.Sprintf("%s-", circle.GetName()))
+			if _, ok := routes[name]; !ok {
+				routes[name] = newServiceRoute(name, namespace, service.Object)
+			}
+
+			routes[name].Backends = append(routes[name].Backends, Backend{
+				Host:    service.Name,
+				Circle:  circle.GetName(),
+				Port:    getServicePort(service.Object),
+				Routing: circle.Spec.Routing,
+			})
+		}
+	}
+
+	result := []ServiceRoute{}
+	for _, route := range routes {
+		sort.Slice(route.Backends, func(i, j int) bool {
+			return route.Backends[i].Circle < route.Backends[j].Circle
+		})
+		result = append(result, *route)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+func newServiceRoute(name string, namespace string, service *unstructured.Unstructured) *ServiceRoute {
+	route := &ServiceRoute{Name: name, Namespace: namespace, Selector: map[string]string{}}
+	if service == nil {
+		return route
+	}
+
+	selector, _, _ := unstructured.NestedStringMap(service.Object, "spec", "selector")
+	for key, value := range selector {
+		if key != annotation.CircleLabel {
+			route.Selector[key] = value
+		}
+	}
+
+	ports, _, _ := unstructured.NestedSlice(service.Object, "spec", "ports")
+	for _, port := range ports {
+		port, ok := port.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		delete(port, "nodePort")
+		route.Ports = append(route.Ports, port)
+	}
+
+	return route
+}
+
+// GetFrontendService renders the service named after the module service, the
+// host clients call and routing objects attach to. It selects the pods of every
+// circle, the routing objects pick the circle of each request.
+func GetFrontendService(route ServiceRoute) *unstructured.Unstructured {
+	service := newObject(serviceGVK, route.Name, route.Namespace)
+	spec := map[string]interface{}{"ports": route.Ports}
+	if len(route.Selector) > 0 {
+		selector := map[string]interface{}{}
+		for key, value := range route.Selector {
+			selector[key] = value
+		}
+
+		spec["selector"] = selector
+	}
+
+	service.Object["spec"] = spec
+	return service
+}
+
+// GetMatchBackends returns the backends receiving header matched traffic.
+func GetMatchBackends(route ServiceRoute) []Backend {
+	backends := []Backend{}
+	for _, backend := range route.Backends {
+		if backend.Routing.Strategy == domain.MatchRoutingStrategy && backend.Routing.Match != nil {
+			backends = append(backends, backend)
+		}
+	}
+
+	return backends
+}
+
+// GetWeightedBackends splits the traffic not matched by headers. CANARY circles
+// receive their configured weight and DEFAULT circles share the rest evenly.
+// Without a DEFAULT circle the rest is shared by the MATCH circles, or else
+// added to the CANARY circles, as no other copy of the service exists.
+func GetWeightedBackends(route ServiceRoute) ([]WeightedBackend, error) {
+	backends := []WeightedBackend{}
+	defaultBackends := []Backend{}
+	matchBackends := []Backend{}
+	canaryBackends := []Backend{}
+	remaining := int64(100)
+
+	for _, backend := range route.Backends {
+		switch backend.Routing.Strategy {
+		case domain.CanaryRoutingStrategy:
+			canaryBackends = append(canaryBackends, backend)
+			if backend.Routing.Canary == nil || backend.Routing.Canary.Weight <= 0 {
+				continue
+			}
+
+			weight := int64(backend.Routing.Canary.Weight)
+			remaining -= weight
+			backends = append(backends, WeightedBackend{Host: backend.Host, Circle: backend.Circle, Port: backend.Port, Weight: weight})
+		case domain.MatchRoutingStrategy:
+			matchBackends = append(matchBackends, backend)
+		default:
+			defaultBackends = append(defaultBackends, backend)
+		}
+	}
+
+	if remaining < 0 {
+		return nil, fmt.Errorf("canary weights of service %s/%s exceed 100", route.Namespace, route.Name)
+	}
+
+	if remaining == 0 {
+		return backends, nil
+	}
+
+	fallbackBackends := defaultBackends
+	if len(fallbackBackends) == 0 {
+		fallbackBackends = matchBackends
+	}
+
+	if len(fallbackBackends) == 0 {
+		fallbackBackends = canaryBackends
+	}
+
+	for i, backend := range fallbackBackends {
+		weight := remaining / int64(len(fallbackBackends))
+		if int64(i) < remaining%int64(len(fallbackBackends)) {
+			weight++
+		}
+
+		backends = addWeight(backends, backend, weight)
+	}
+
+	return backends, nil
+}
+
+// addWeight adds weight to the share of the backend, appending it when it has
+// none yet.
+func addWeight(backends []WeightedBackend, backend Backend, weight int64) []WeightedBackend {
+	if weight == 0 {
+		return backends
+	}
+
+	for i := range backends {
+		if backends[i].Host == backend.Host {
+			backends[i].Weight += weight
+			return backends
+		}
+	}
+
+	return append(backends, WeightedBackend{Host: backend.Host, Circle: backend.Circle, Port: backend.Port, Weight: weight})
+}
+
+// labelPodTemplate labels the pods of circle workloads so routing objects can
+// tell apart the pods of each circle. Objects with malformed pod template
+// labels are left untouched and rejected later by the API server.
+func labelPodTemplate(un *unstructured.Unstructured, circle circlerriov1alpha1.Circle) *unstructured.Unstructured {
+	path, ok := manifest.GetPodTemplatePath(un)
+	if !ok {
+		return un
+	}
+
+	labelsPath := append(append([]string{}, path...), "metadata", "labels")
+	labels, _, err := unstructured.NestedStringMap(un.Object, labelsPath...)
+	if err != nil {
+		return un
+	}
+
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	labels[annotation.CircleLabel] = circle.GetName()
+	_ = unstructured.SetNestedStringMap(un.Object, labels, labelsPath...)
+	return un
+}
+
+// selectCirclePods restricts the selector of a circle service to the pods of
+// the circle, for providers routing straight to services without subsets.
+func selectCirclePods(un *unstructured.Unstructured, circle circlerriov1alpha1.Circle) *unstructured.Unstructured {
+	if un.GroupVersionKind().GroupKind() != serviceGK {
+		return un
+	}
+
+	selector, found, err := unstructured.NestedStringMap(un.Object, "spec", "selector")
+	if err != nil || !found {
+		return un
+	}
+
+	selector[annotation.CircleLabel] = circle.GetName()
+	_ = unstructured.SetNestedStringMap(un.Object, selector, "spec", "selector")
+	return un
+}
+
+func getServicePort(un *unstructured.Unstructured) int64 {
+	ports, _, _ := unstructured.NestedSlice(un.Object, "spec", "ports")
+	if len(ports) == 0 {
+		return 0
+	}
+
+	port, ok := ports[0].(map[string]interface{})
+	if !ok {
+		return 0
+	}
+
+	value, _, _ := unstructured.NestedInt64(port, "port")
+	return value
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func newObject(gvk schema.GroupVersionKind, name string, namespace string) *unstructured.Unstructured {
+	un := &unstructured.Unstructured{}
+	un.SetGroupVersionKind(gvk)
+	un.SetName(name)
+	un.SetNamespace(namespace)
+	return un
+}
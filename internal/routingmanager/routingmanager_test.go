@@ -0,0 +1,359 @@
+package routingmanager
+
+import (
+	"testing"
+
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"github.com/octopipe/circlerr/internal/utils/annotation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+type RoutingManagerTestSuite struct {
+	suite.Suite
+	route ServiceRoute
+}
+
+func (s *RoutingManagerTestSuite) SetupTest() {
+	s.route = ServiceRoute{
+		Name:      "guestbook-ui",
+		Namespace: "default",
+		Selector:  map[string]string{"app": "guestbook-ui"},
+		Ports:     []interface{}{map[string]interface{}{"port": int64(80), "targetPort": int64(8080)}},
+		Backends: []Backend{
+			{
+				Host:    "circle-1-guestbook-ui",
+				Circle:  "circle-1",
+				Port:    80,
+				Routing: circlerriov1alpha1.CircleRouting{Strategy: "DEFAULT"},
+			},
+			{
+				Host:   "circle-2-guestbook-ui",
+				Circle: "circle-2",
+				Port:   80,
+				Routing: circlerriov1alpha1.CircleRouting{
+					Strategy: "MATCH",
+					Match:    &circlerriov1alpha1.CircleMatch{Headers: map[string]string{"x-circle-id": "circle-2"}},
+				},
+			},
+			{
+				Host:   "circle-3-guestbook-ui",
+				Circle: "circle-3",
+				Port:   80,
+				Routing: circlerriov1alpha1.CircleRouting{
+					Strategy: "CANARY",
+					Canary:   &circlerriov1alpha1.CanaryDeployStrategy{Weight: 20},
+				},
+			},
+		},
+	}
+}
+
+func (s *RoutingManagerTestSuite) TestGetWeightedBackends() {
+	backends, err := GetWeightedBackends(s.route)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), []WeightedBackend{
+		{Host: "circle-3-guestbook-ui", Circle: "circle-3", Port: 80, Weight: 20},
+		{Host: "circle-1-guestbook-ui", Circle: "circle-1", Port: 80, Weight: 80},
+	}, backends)
+}
+
+func (s *RoutingManagerTestSuite) TestGetWeightedBackendsWithoutDefaultCircle() {
+	s.route.Backends = s.route.Backends[1:]
+
+	backends, err := GetWeightedBackends(s.route)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), []WeightedBackend{
+		{Host: "circle-3-guestbook-ui", Circle: "circle-3", Port: 80, Weight: 20},
+		{Host: "circle-2-guestbook-ui", Circle: "circle-2", Port: 80, Weight: 80},
+	}, backends)
+}
+
+func (s *RoutingManagerTestSuite) TestGetWeightedBackendsWithCanaryCirclesOnly() {
+	s.route.Backends = s.route.Backends[2:]
+
+	backends, err := GetWeightedBackends(s.route)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), []WeightedBackend{{Host: "circle-3-guestbook-ui", Circle: "circle-3", Port: 80, Weight: 100}}, backends)
+}
+
+func (s *RoutingManagerTestSuite) TestRenderIstioWithoutDefaultCircle() {
+	s.route.Backends = s.route.Backends[1:]
+
+	objects, err := NewIstioProvider().GetManifests([]ServiceRoute{s.route})
+	assert.NoError(s.T(), err)
+
+	destinations, _, _ := unstructured.NestedSlice(objects[1].Object, "spec", "http")
+	assert.Equal(s.T(), []interface{}{
+		map[string]interface{}{
+			"destination": map[string]interface{}{"host": "circle-3-guestbook-ui", "subset": "circle-3"},
+			"weight":      int64(20),
+		},
+		map[string]interface{}{
+			"destination": map[string]interface{}{"host": "circle-2-guestbook-ui", "subset": "circle-2"},
+			"weight":      int64(80),
+		},
+	}, destinations[1].(map[string]interface{})["route"])
+}
+
+func (s *RoutingManagerTestSuite) TestGetWeightedBackendsExceedingWeights() {
+	s.route.Backends[0].Routing = circlerriov1alpha1.CircleRouting{
+		Strategy: "CANARY",
+		Canary:   &circlerriov1alpha1.CanaryDeployStrategy{Weight: 90},
+	}
+
+	_, err := GetWeightedBackends(s.route)
+	assert.Error(s.T(), err)
+}
+
+func (s *RoutingManagerTestSuite) TestRenderIstio() {
+	objects, err := NewIstioProvider().GetManifests([]ServiceRoute{s.route})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), 5, len(objects))
+
+	expectedService := `
+apiVersion: v1
+kind: Service
+metadata:
+  name: guestbook-ui
+  namespace: default
+spec:
+  selector:
+    app: guestbook-ui
+  ports:
+  - port: 80
+    targetPort: 8080
+`
+	s.assertObject(expectedService, objects[0])
+
+	expectedVirtualService := `
+apiVersion: networking.istio.io/v1beta1
+kind: VirtualService
+metadata:
+  name: guestbook-ui
+  namespace: default
+spec:
+  hosts:
+  - guestbook-ui
+  http:
+  - name: circle-2
+    match:
+    - headers:
+        x-circle-id:
+          exact: circle-2
+    route:
+    - destination:
+        host: circle-2-guestbook-ui
+        subset: circle-2
+  - name: default
+    route:
+    - destination:
+        host: circle-3-guestbook-ui
+        subset: circle-3
+      weight: 20
+    - destination:
+        host: circle-1-guestbook-ui
+        subset: circle-1
+      weight: 80
+`
+	s.assertObject(expectedVirtualService, objects[1])
+
+	expectedDestinationRule := `
+apiVersion: networking.istio.io/v1beta1
+kind: DestinationRule
+metadata:
+  name: circle-1-guestbook-ui
+  namespace: default
+spec:
+  host: circle-1-guestbook-ui
+  subsets:
+  - name: circle-1
+    labels:
+      circlerr.io/circle: circle-1
+`
+	s.assertObject(expectedDestinationRule, objects[2])
+}
+
+func (s *RoutingManagerTestSuite) TestRenderGatewayAPI() {
+	objects, err := NewGatewayAPIProvider("edge", "gateways").GetManifests([]ServiceRoute{s.route})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), 1, len(objects))
+
+	expectedHTTPRoute := `
+apiVersion: gateway.networking.k8s.io/v1beta1
+kind: HTTPRoute
+metadata:
+  name: guestbook-ui
+  namespace: default
+spec:
+  parentRefs:
+  - name: edge
+    namespace: gateways
+  rules:
+  - matches:
+    - headers:
+      - type: Exact
+        name: x-circle-id
+        value: circle-2
+    backendRefs:
+    - name: circle-2-guestbook-ui
+      port: 80
+  - backendRefs:
+    - name: circle-3-guestbook-ui
+      port: 80
+      weight: 20
+    - name: circle-1-guestbook-ui
+      port: 80
+      weight: 80
+`
+	s.assertObject(expectedHTTPRoute, objects[0])
+}
+
+func (s *RoutingManagerTestSuite) TestRenderGatewayAPIWithoutGateway() {
+	objects, err := NewGatewayAPIProvider("", "").GetManifests([]ServiceRoute{s.route})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), 2, len(objects))
+	assert.Equal(s.T(), GetFrontendService(s.route), objects[0])
+
+	parentRefs, _, _ := unstructured.NestedSlice(objects[1].Object, "spec", "parentRefs")
+	assert.Equal(s.T(), []interface{}{map[string]interface{}{"group": "", "kind": "Service", "name": "guestbook-ui"}}, parentRefs)
+}
+
+func (s *RoutingManagerTestSuite) TestNewServiceRoute() {
+	route := newServiceRoute("guestbook-ui", "default", s.unmarshal(`
+apiVersion: v1
+kind: Service
+metadata:
+  name: circle-1-guestbook-ui
+spec:
+  type: NodePort
+  selector:
+    app: guestbook-ui
+    circlerr.io/circle: circle-1
+  ports:
+  - port: 80
+    targetPort: 8080
+    nodePort: 30080
+`))
+
+	assert.Equal(s.T(), map[string]string{"app": "guestbook-ui"}, route.Selector)
+	assert.Equal(s.T(), []interface{}{map[string]interface{}{"port": float64(80), "targetPort": float64(8080)}}, route.Ports)
+}
+
+func (s *RoutingManagerTestSuite) TestPrepareObject() {
+	un := s.unmarshal(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: guestbook-ui
+spec:
+  template:
+    metadata:
+      labels:
+        app: guestbook-ui
+`)
+
+	circle := circlerriov1alpha1.Circle{}
+	circle.SetName("circle-1")
+	un = NewIstioProvider().PrepareObject(un, circle)
+
+	labels, _, _ := unstructured.NestedStringMap(un.Object, "spec", "template", "metadata", "labels")
+	assert.Equal(s.T(), map[string]string{"app": "guestbook-ui", annotation.CircleLabel: "circle-1"}, labels)
+}
+
+func (s *RoutingManagerTestSuite) TestPrepareServiceSelector() {
+	un := s.unmarshal(`
+apiVersion: v1
+kind: Service
+metadata:
+  name: circle-1-guestbook-ui
+spec:
+  selector:
+    app: guestbook-ui
+`)
+
+	circle := circlerriov1alpha1.Circle{}
+	circle.SetName("circle-1")
+
+	istioSelector, _, _ := unstructured.NestedStringMap(NewIstioProvider().PrepareObject(un.DeepCopy(), circle).Object, "spec", "selector")
+	assert.Equal(s.T(), map[string]string{"app": "guestbook-ui"}, istioSelector)
+
+	gatewaySelector, _, _ := unstructured.NestedStringMap(NewGatewayAPIProvider("", "").PrepareObject(un.DeepCopy(), circle).Object, "spec", "selector")
+	assert.Equal(s.T(), map[string]string{"app": "guestbook-ui", annotation.CircleLabel: "circle-1"}, gatewaySelector)
+}
+
+func (s *RoutingManagerTestSuite) TestPrepareNginxIngress() {
+	un := s.unmarshal(`
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: circle-2-guestbook-ui
+spec:
+  rules:
+  - host: guestbook.local
+    http:
+      paths:
+      - path: /
+        pathType: Prefix
+        backend:
+          service:
+            name: guestbook-ui
+            port:
+              number: 80
+`)
+
+	circle := circlerriov1alpha1.Circle{}
+	circle.SetName("circle-2")
+	circle.Spec.Routing = s.route.Backends[1].Routing
+	un = NewNginxProvider().PrepareObject(un, circle)
+
+	assert.Equal(s.T(), map[string]string{
+		nginxCanaryAnnotation:            "true",
+		nginxCanaryByHeaderAnnotation:    "x-circle-id",
+		nginxCanaryHeaderValueAnnotation: "circle-2",
+	}, un.GetAnnotations())
+
+	rules, _, _ := unstructured.NestedSlice(un.Object, "spec", "rules")
+	paths, _, _ := unstructured.NestedSlice(rules[0].(map[string]interface{}), "http", "paths")
+	name, _, _ := unstructured.NestedString(paths[0].(map[string]interface{}), "backend", "service", "name")
+	assert.Equal(s.T(), "circle-2-guestbook-ui", name)
+
+	circle.SetName("circle-3")
+	circle.Spec.Routing = s.route.Backends[2].Routing
+	un = NewNginxProvider().PrepareObject(s.unmarshal(`
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: circle-3-guestbook-ui
+spec:
+  defaultBackend:
+    service:
+      name: guestbook-ui
+`), circle)
+
+	assert.Equal(s.T(), "20", un.GetAnnotations()[nginxCanaryWeightAnnotation])
+	name, _, _ = unstructured.NestedString(un.Object, "spec", "defaultBackend", "service", "name")
+	assert.Equal(s.T(), "circle-3-guestbook-ui", name)
+}
+
+func (s *RoutingManagerTestSuite) unmarshal(raw string) *unstructured.Unstructured {
+	un := &unstructured.Unstructured{}
+	err := yaml.Unmarshal([]byte(raw), &un.Object)
+	assert.NoError(s.T(), err)
+	return un
+}
+
+func (s *RoutingManagerTestSuite) assertObject(expected string, un *unstructured.Unstructured) {
+	expectedJSON, err := yaml.YAMLToJSON([]byte(expected))
+	assert.NoError(s.T(), err)
+
+	rawJSON, err := un.MarshalJSON()
+	assert.NoError(s.T(), err)
+	assert.JSONEq(s.T(), string(expectedJSON), string(rawJSON))
+}
+
+func TestRoutingManagerTestSuite(t *testing.T) {
+	suite.Run(t, new(RoutingManagerTestSuite))
+}
@@ -0,0 +1,388 @@
+package templatemanager
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/repo"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	dockerauth "oras.land/oras-go/pkg/auth/docker"
+	"sigs.k8s.io/yaml"
+)
+
+// chartCache stores the chart archives downloaded from chart repositories and
+// OCI registries by digest, so a chart version is only downloaded once.
+type chartCache struct {
+	dir string
+}
+
+func newChartCache() chartCache {
+	dir := os.Getenv("CHART_CACHE_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "circlerr-charts")
+	}
+
+	return chartCache{dir: dir}
+}
+
+func (c chartCache) path(digest string) string {
+	return filepath.Join(c.dir, strings.ReplaceAll(digest, ":", "-")+".tgz")
+}
+
+func (c chartCache) get(digest string) ([]byte, bool) {
+	data, err := os.ReadFile(c.path(digest))
+	return data, err == nil
+}
+
+// set writes the archive to a temporary file renamed once complete, so
+// concurrent renders never read a partial archive.
+func (c chartCache) set(digest string, data []byte) error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(c.dir, "chart-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), c.path(digest))
+}
+
+const defaultIndexTTL = 5 * time.Minute
+
+// indexCache keeps the indexes of chart repositories for a TTL, along with the
+// digests computed for the archives their index has no digest for.
+type indexCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*indexCacheEntry
+}
+
+type indexCacheEntry struct {
+	index     *repo.IndexFile
+	digests   map[string]string
+	expiresAt time.Time
+}
+
+func newIndexCache() *indexCache {
+	ttl, err := time.ParseDuration(os.Getenv("CHART_INDEX_TTL"))
+	if err != nil {
+		ttl = defaultIndexTTL
+	}
+
+	return &indexCache{ttl: ttl, entries: map[string]*indexCacheEntry{}}
+}
+
+func (c *indexCache) get(key string) (*repo.IndexFile, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+
+	return entry.index, true
+}
+
+func (c *indexCache) set(key string, index *repo.IndexFile) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = &indexCacheEntry{index: index, digests: map[string]string{}, expiresAt: time.Now().Add(c.ttl)}
+}
+
+// getDigest returns the digest computed for an archive of the cached index.
+func (c *indexCache) getDigest(key string, chartURL string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return ""
+	}
+
+	return entry.digests[chartURL]
+}
+
+func (c *indexCache) setDigest(key string, chartURL string, digest string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[key]; ok {
+		entry.digests[chartURL] = digest
+	}
+}
+
+type chartCredentials struct {
+	username string
+	password string
+}
+
+// loadChart loads the chart of the module from its chart source, or from the
+// module path when it has none.
+func (t helmTemplate) loadChart(ctx context.Context, repositoryPath string, module circlerriov1alpha1.Module) (*chart.Chart, error) {
+	if module.Spec.Chart == nil {
+		chart, err := loader.Load(filepath.Join(repositoryPath, module.Spec.Path))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, &ChartNotFoundError{Path: module.Spec.Path, Err: err}
+			}
+
+			return nil, &InvalidChartError{Path: module.Spec.Path, Err: err}
+		}
+
+		return chart, nil
+	}
+
+	source := *module.Spec.Chart
+	credentials, err := t.getChartCredentials(ctx, module.GetNamespace(), source.SecretRef)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if registry.IsOCI(source.RepoURL) {
+		data, err = t.pullOCIChart(ctx, source, credentials)
+	} else {
+		data, err = t.pullRepositoryChart(source, credentials)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	chart, err := loader.LoadArchive(bytes.NewReader(data))
+	if err != nil {
+		return nil, &InvalidChartError{Path: source.Chart, Err: err}
+	}
+
+	return chart, nil
+}
+
+func (t helmTemplate) getChartCredentials(ctx context.Context, namespace string, secretRef *circlerriov1alpha1.SecretRef) (*chartCredentials, error) {
+	if secretRef == nil {
+		return nil, nil
+	}
+
+	if secretRef.Namespace != "" {
+		namespace = secretRef.Namespace
+	}
+
+	secret := &corev1.Secret{}
+	if err := t.Get(ctx, types.NamespacedName{Namespace: namespace, Name: secretRef.Name}, secret); err != nil {
+		return nil, err
+	}
+
+	username, ok := secret.Data["username"]
+	if !ok {
+		return nil, errors.New("username not found")
+	}
+
+	password, ok := secret.Data["password"]
+	if !ok {
+		return nil, errors.New("password not found")
+	}
+
+	return &chartCredentials{username: string(username), password: string(password)}, nil
+}
+
+// pullRepositoryChart downloads the chart version matching the source from the
+// index of a chart repository. Versions without digest in the index are cached
+// by the digest of their archive until the index expires.
+func (t helmTemplate) pullRepositoryChart(source circlerriov1alpha1.ChartSource, credentials *chartCredentials) ([]byte, error) {
+	// Credentials are only sent to the host of the repository, not to the
+	// hosts charts may be downloaded from.
+	opts := []getter.Option{getter.WithURL(source.RepoURL)}
+	if credentials != nil {
+		opts = append(opts, getter.WithBasicAuth(credentials.username, credentials.password))
+	}
+
+	g, err := getter.NewHTTPGetter(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Indexes are cached per user, so an index is never served to renders
+	// without the credentials it was downloaded with.
+	indexKey := source.RepoURL
+	if credentials != nil {
+		indexKey = credentials.username + "@" + indexKey
+	}
+
+	index, ok := t.indexCache.get(indexKey)
+	if !ok {
+		buf, err := g.Get(strings.TrimSuffix(source.RepoURL, "/") + "/index.yaml")
+		if err != nil {
+			return nil, err
+		}
+
+		index = &repo.IndexFile{}
+		if err := yaml.Unmarshal(buf.Bytes(), index); err != nil {
+			return nil, fmt.Errorf("invalid index of chart repository %s: %w", source.RepoURL, err)
+		}
+		index.SortEntries()
+		t.indexCache.set(indexKey, index)
+	}
+
+	chartVersion, err := index.Get(source.Chart, source.Version)
+	if err != nil || len(chartVersion.URLs) == 0 {
+		return nil, &ChartNotFoundError{Path: chartPath(source), Err: fmt.Errorf("no version matching %q", source.Version)}
+	}
+
+	chartURL, err := repo.ResolveReferenceURL(source.RepoURL, chartVersion.URLs[0])
+	if err != nil {
+		return nil, err
+	}
+
+	digest := t.indexCache.getDigest(indexKey, chartURL)
+	if chartVersion.Digest != "" {
+		digest = "sha256:" + chartVersion.Digest
+	}
+
+	if digest != "" {
+		if data, ok := t.chartCache.get(digest); ok {
+			return data, nil
+		}
+	}
+
+	buf, err := g.Get(chartURL)
+	if err != nil {
+		return nil, err
+	}
+
+	data := buf.Bytes()
+	sum := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	if chartVersion.Digest == "" {
+		t.indexCache.setDigest(indexKey, chartURL, sum)
+		return data, t.chartCache.set(sum, data)
+	}
+
+	if sum != digest {
+		return nil, &InvalidChartError{Path: chartPath(source), Err: fmt.Errorf("digest %s does not match %s", sum, digest)}
+	}
+
+	return data, t.chartCache.set(digest, data)
+}
+
+// pullOCIChart resolves the tag matching the source version in the registry
+// repository and pulls its manifest by digest, charts are cached by the digest
+// of their manifest.
+func (t helmTemplate) pullOCIChart(ctx context.Context, source circlerriov1alpha1.ChartSource, credentials *chartCredentials) ([]byte, error) {
+	opts := []registry.ClientOption{}
+	credentialsFiles := []string{}
+	if credentials != nil {
+		credentialsFile, err := writeRegistryCredentials(source.RepoURL, credentials)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(credentialsFile)
+
+		opts = append(opts, registry.ClientOptCredentialsFile(credentialsFile))
+		credentialsFiles = append(credentialsFiles, credentialsFile)
+	}
+
+	client, err := registry.NewClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	repository := strings.TrimPrefix(chartPath(source), "oci://")
+	tags, err := client.Tags(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	tag, err := registry.GetTagMatchingVersionOrConstraint(tags, source.Version)
+	if err != nil {
+		return nil, &ChartNotFoundError{Path: chartPath(source), Err: err}
+	}
+
+	// Registries don't allow + in tags, helm pushes versions with _ instead.
+	ref := fmt.Sprintf("%s:%s", repository, strings.ReplaceAll(tag, "+", "_"))
+	authClient, err := dockerauth.NewClientWithDockerFallback(credentialsFiles...)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver, err := authClient.ResolverWithOpts()
+	if err != nil {
+		return nil, err
+	}
+
+	_, desc, err := resolver.Resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := desc.Digest.String()
+	if data, ok := t.chartCache.get(digest); ok {
+		return data, nil
+	}
+
+	// The resolved manifest is pulled by digest, the tag may have been pushed
+	// again since it was resolved.
+	result, err := client.Pull(fmt.Sprintf("%s@%s", repository, digest))
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Chart.Data, t.chartCache.set(digest, result.Chart.Data)
+}
+
+func chartPath(source circlerriov1alpha1.ChartSource) string {
+	return strings.TrimSuffix(source.RepoURL, "/") + "/" + source.Chart
+}
+
+// writeRegistryCredentials writes a docker config file with the credentials of
+// the registry, registry clients only read credentials from files.
+func writeRegistryCredentials(repoURL string, credentials *chartCredentials) (string, error) {
+	host := strings.SplitN(strings.TrimPrefix(repoURL, "oci://"), "/", 2)[0]
+	auth := base64.StdEncoding.EncodeToString([]byte(credentials.username + ":" + credentials.password))
+	data, err := json.Marshal(map[string]interface{}{
+		"auths": map[string]interface{}{host: map[string]string{"auth": auth}},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.CreateTemp("", "circlerr-registry-")
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), f.Close()
+}
@@ -0,0 +1,385 @@
+package templatemanager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/repo"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	chartUsername = "circlerr"
+	chartPassword = "secret"
+)
+
+// requireBasicAuth rejects requests without the chart credentials.
+func requireBasicAuth(w http.ResponseWriter, r *http.Request) bool {
+	username, password, ok := r.BasicAuth()
+	if ok && username == chartUsername && password == chartPassword {
+		return true
+	}
+
+	w.Header().Set("WWW-Authenticate", `Basic realm="charts"`)
+	w.WriteHeader(http.StatusUnauthorized)
+	return false
+}
+
+// fakeRegistry is an in-process OCI registry serving the pull API for the
+// charts pushed to it.
+type fakeRegistry struct {
+	mu        sync.Mutex
+	tags      map[string][]string
+	manifests map[string][]byte
+	blobs     map[string][]byte
+	pulls     []string
+}
+
+var registryPathRegex = regexp.MustCompile(`^/v2/(.+)/(manifests|blobs|tags)/(.+)$`)
+
+func newFakeRegistry() *fakeRegistry {
+	return &fakeRegistry{
+		tags:      map[string][]string{},
+		manifests: map[string][]byte{},
+		blobs:     map[string][]byte{},
+	}
+}
+
+func (f *fakeRegistry) addBlob(mediaType string, data []byte) map[string]interface{} {
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	f.blobs[digest] = data
+	return map[string]interface{}{"mediaType": mediaType, "digest": digest, "size": len(data)}
+}
+
+func (f *fakeRegistry) push(repository string, tag string, chartData []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	chart, err := loader.LoadArchive(strings.NewReader(string(chartData)))
+	if err != nil {
+		return err
+	}
+
+	config, err := json.Marshal(chart.Metadata)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"config":        f.addBlob(registry.ConfigMediaType, config),
+		"layers":        []interface{}{f.addBlob(registry.ChartLayerMediaType, chartData)},
+	})
+	if err != nil {
+		return err
+	}
+
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(manifest))
+	f.manifests[repository+":"+tag] = manifest
+	f.manifests[repository+"@"+digest] = manifest
+	f.tags[repository] = append(f.tags[repository], tag)
+	return nil
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !requireBasicAuth(w, r) {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/v2/" {
+		return
+	}
+
+	match := registryPathRegex.FindStringSubmatch(r.URL.Path)
+	if match == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	repository, kind, ref := match[1], match[2], match[3]
+	var data []byte
+	var ok bool
+	switch kind {
+	case "tags":
+		data, _ = json.Marshal(map[string]interface{}{"name": repository, "tags": f.tags[repository]})
+		ok = true
+		w.Header().Set("Content-Type", "application/json")
+	case "manifests":
+		separator := ":"
+		if strings.HasPrefix(ref, "sha256:") {
+			separator = "@"
+		}
+
+		data, ok = f.manifests[repository+separator+ref]
+		if r.Method == http.MethodGet {
+			f.pulls = append(f.pulls, ref)
+		}
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w.Header().Set("Docker-Content-Digest", fmt.Sprintf("sha256:%x", sha256.Sum256(data)))
+	case "blobs":
+		data, ok = f.blobs[ref]
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(data)
+	}
+}
+
+type ChartSourceTestSuite struct {
+	suite.Suite
+	charts    map[string][]byte
+	template  helmTemplate
+	module    circlerriov1alpha1.Module
+	downloads map[string]int
+	mu        sync.Mutex
+}
+
+func (s *ChartSourceTestSuite) SetupTest() {
+	s.downloads = map[string]int{}
+	s.charts = map[string][]byte{}
+	chart, err := loader.Load("testdata/guestbook")
+	assert.NoError(s.T(), err)
+
+	for _, version := range []string{"0.1.0", "0.2.0", "1.0.0"} {
+		chart.Metadata.Version = version
+		path, err := chartutil.Save(chart, s.T().TempDir())
+		assert.NoError(s.T(), err)
+
+		s.charts[version], err = os.ReadFile(path)
+		assert.NoError(s.T(), err)
+	}
+
+	s.template = helmTemplate{
+		Client: fake.NewClientBuilder().WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "chart-credentials", Namespace: "default"},
+			Data:       map[string][]byte{"username": []byte(chartUsername), "password": []byte(chartPassword)},
+		}).Build(),
+		chartCache: chartCache{dir: s.T().TempDir()},
+		indexCache: newIndexCache(),
+	}
+
+	s.module = circlerriov1alpha1.Module{}
+	s.module.SetName("guestbook")
+	s.module.SetNamespace("default")
+}
+
+func (s *ChartSourceTestSuite) newChartRepository(withDigests bool) *httptest.Server {
+	index := repo.NewIndexFile()
+	for version, data := range s.charts {
+		chart, err := loader.LoadArchive(strings.NewReader(string(data)))
+		assert.NoError(s.T(), err)
+
+		digest := ""
+		if withDigests {
+			digest = fmt.Sprintf("%x", sha256.Sum256(data))
+		}
+		assert.NoError(s.T(), index.MustAdd(chart.Metadata, fmt.Sprintf("guestbook-%s.tgz", version), "", digest))
+	}
+
+	indexData, err := yaml.Marshal(index)
+	assert.NoError(s.T(), err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !requireBasicAuth(w, r) {
+			return
+		}
+
+		s.mu.Lock()
+		s.downloads[r.URL.Path]++
+		s.mu.Unlock()
+
+		if r.URL.Path == "/index.yaml" {
+			_, _ = w.Write(indexData)
+			return
+		}
+
+		version := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/guestbook-"), ".tgz")
+		data, ok := s.charts[version]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		_, _ = w.Write(data)
+	}))
+	s.T().Cleanup(server.Close)
+	return server
+}
+
+func (s *ChartSourceTestSuite) newRegistry() (*fakeRegistry, string) {
+	fakeRegistry := newFakeRegistry()
+	for version, data := range s.charts {
+		assert.NoError(s.T(), fakeRegistry.push("charts/guestbook", version, data))
+	}
+
+	server := httptest.NewServer(fakeRegistry)
+	s.T().Cleanup(server.Close)
+	return fakeRegistry, "oci://" + strings.TrimPrefix(server.URL, "http://") + "/charts"
+}
+
+func (s *ChartSourceTestSuite) loadChartVersion() (string, error) {
+	chart, err := s.template.loadChart(context.Background(), "", s.module)
+	if err != nil {
+		return "", err
+	}
+
+	return chart.Metadata.Version, nil
+}
+
+func (s *ChartSourceTestSuite) TestLoadChartFromRepository() {
+	server := s.newChartRepository(true)
+	s.module.Spec.Chart = &circlerriov1alpha1.ChartSource{
+		RepoURL:   server.URL,
+		Chart:     "guestbook",
+		Version:   "~0.1.0",
+		SecretRef: &circlerriov1alpha1.SecretRef{Name: "chart-credentials"},
+	}
+
+	version, err := s.loadChartVersion()
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "0.1.0", version)
+
+	s.module.Spec.Chart.Version = ""
+	version, err = s.loadChartVersion()
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "1.0.0", version)
+}
+
+func (s *ChartSourceTestSuite) TestLoadChartFromRepositoryIsCached() {
+	server := s.newChartRepository(true)
+	s.module.Spec.Chart = &circlerriov1alpha1.ChartSource{
+		RepoURL:   server.URL,
+		Chart:     "guestbook",
+		Version:   "0.2.0",
+		SecretRef: &circlerriov1alpha1.SecretRef{Name: "chart-credentials"},
+	}
+
+	for i := 0; i < 2; i++ {
+		version, err := s.loadChartVersion()
+		assert.NoError(s.T(), err)
+		assert.Equal(s.T(), "0.2.0", version)
+	}
+
+	assert.Equal(s.T(), 1, s.downloads["/index.yaml"])
+	assert.Equal(s.T(), 1, s.downloads["/guestbook-0.2.0.tgz"])
+	_, err := os.Stat(filepath.Join(s.template.chartCache.dir, fmt.Sprintf("sha256-%x.tgz", sha256.Sum256(s.charts["0.2.0"]))))
+	assert.NoError(s.T(), err)
+}
+
+func (s *ChartSourceTestSuite) TestLoadChartFromRepositoryWithoutDigestIsCached() {
+	server := s.newChartRepository(false)
+	s.module.Spec.Chart = &circlerriov1alpha1.ChartSource{
+		RepoURL:   server.URL,
+		Chart:     "guestbook",
+		Version:   "0.2.0",
+		SecretRef: &circlerriov1alpha1.SecretRef{Name: "chart-credentials"},
+	}
+
+	for i := 0; i < 2; i++ {
+		version, err := s.loadChartVersion()
+		assert.NoError(s.T(), err)
+		assert.Equal(s.T(), "0.2.0", version)
+	}
+
+	assert.Equal(s.T(), 1, s.downloads["/guestbook-0.2.0.tgz"])
+	_, err := os.Stat(filepath.Join(s.template.chartCache.dir, fmt.Sprintf("sha256-%x.tgz", sha256.Sum256(s.charts["0.2.0"]))))
+	assert.NoError(s.T(), err)
+
+	for _, entry := range s.template.indexCache.entries {
+		entry.expiresAt = time.Time{}
+	}
+
+	version, err := s.loadChartVersion()
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "0.2.0", version)
+	assert.Equal(s.T(), 2, s.downloads["/index.yaml"])
+	assert.Equal(s.T(), 2, s.downloads["/guestbook-0.2.0.tgz"])
+}
+
+func (s *ChartSourceTestSuite) TestLoadChartFromRepositoryVersionNotFound() {
+	server := s.newChartRepository(true)
+	s.module.Spec.Chart = &circlerriov1alpha1.ChartSource{
+		RepoURL:   server.URL,
+		Chart:     "guestbook",
+		Version:   ">=2.0.0",
+		SecretRef: &circlerriov1alpha1.SecretRef{Name: "chart-credentials"},
+	}
+
+	_, err := s.loadChartVersion()
+	assert.Equal(s.T(), ChartNotFoundReason, ErrorReason(err))
+}
+
+func (s *ChartSourceTestSuite) TestLoadChartFromRepositoryUnauthorized() {
+	server := s.newChartRepository(true)
+	s.module.Spec.Chart = &circlerriov1alpha1.ChartSource{RepoURL: server.URL, Chart: "guestbook"}
+
+	_, err := s.loadChartVersion()
+	assert.Error(s.T(), err)
+}
+
+func (s *ChartSourceTestSuite) TestLoadChartFromRegistry() {
+	fakeRegistry, repoURL := s.newRegistry()
+	s.module.Spec.Chart = &circlerriov1alpha1.ChartSource{
+		RepoURL:   repoURL,
+		Chart:     "guestbook",
+		Version:   "<1.0.0",
+		SecretRef: &circlerriov1alpha1.SecretRef{Name: "chart-credentials", Namespace: "default"},
+	}
+
+	for i := 0; i < 2; i++ {
+		version, err := s.loadChartVersion()
+		assert.NoError(s.T(), err)
+		assert.Equal(s.T(), "0.2.0", version)
+	}
+
+	manifestDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(fakeRegistry.manifests["charts/guestbook:0.2.0"]))
+	assert.Equal(s.T(), []string{manifestDigest}, fakeRegistry.pulls)
+}
+
+func (s *ChartSourceTestSuite) TestLoadChartFromRegistryVersionNotFound() {
+	_, repoURL := s.newRegistry()
+	s.module.Spec.Chart = &circlerriov1alpha1.ChartSource{
+		RepoURL:   repoURL,
+		Chart:     "guestbook",
+		Version:   "2.0.0",
+		SecretRef: &circlerriov1alpha1.SecretRef{Name: "chart-credentials"},
+	}
+
+	_, err := s.loadChartVersion()
+	assert.Equal(s.T(), ChartNotFoundReason, ErrorReason(err))
+}
+
+func TestChartSourceTestSuite(t *testing.T) {
+	suite.Run(t, new(ChartSourceTestSuite))
+}
@@ -0,0 +1,125 @@
+package templatemanager
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Reasons recorded on the status conditions of circles and modules that fail
+// to render.
+const (
+	ChartNotFoundReason = "ChartNotFound"
+	InvalidChartReason  = "InvalidChart"
+	InvalidValuesReason = "InvalidValues"
+	TemplateErrorReason = "TemplateError"
+)
+
+// ChartNotFoundError is returned when the chart of a HELM module does not exist.
+type ChartNotFoundError struct {
+	Path string
+	Err  error
+}
+
+func (e *ChartNotFoundError) Error() string {
+	return fmt.Sprintf("chart %s not found: %s", e.Path, e.Err)
+}
+
+func (e *ChartNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// InvalidChartError is returned when the chart of a HELM module can't be
+// loaded.
+type InvalidChartError struct {
+	Path string
+	Err  error
+}
+
+func (e *InvalidChartError) Error() string {
+	return fmt.Sprintf("invalid chart %s: %s", e.Path, e.Err)
+}
+
+func (e *InvalidChartError) Unwrap() error {
+	return e.Err
+}
+
+// InvalidValuesError is returned when the values a module is rendered with
+// can't be read or don't match the schema of the chart.
+type InvalidValuesError struct {
+	Source string
+	Err    error
+}
+
+func (e *InvalidValuesError) Error() string {
+	return fmt.Sprintf("invalid values in %s: %s", e.Source, e.Err)
+}
+
+func (e *InvalidValuesError) Unwrap() error {
+	return e.Err
+}
+
+// TemplateError is returned when a template fails to render, File and Line
+// locate the failure when the template engine reports it.
+type TemplateError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *TemplateError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("template error: %s", e.Err)
+	}
+
+	return fmt.Sprintf("template error in %s line %d: %s", e.File, e.Line, e.Err)
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// templateLocationRegex matches the locations reported by the template engine,
+// "template: file:line:col", "error at (file:line)" and YAML parse errors of
+// rendered files.
+var templateLocationRegex = regexp.MustCompile(`(?:template: |error at \()([^:\s()]+):(\d+)|YAML parse error on ([^:\s]+):.*?line (\d+)`)
+
+func newTemplateError(err error) *TemplateError {
+	templateErr := &TemplateError{Err: err}
+	match := templateLocationRegex.FindStringSubmatch(err.Error())
+	if match == nil {
+		return templateErr
+	}
+
+	file, line := match[1], match[2]
+	if file == "" {
+		file, line = match[3], match[4]
+	}
+
+	templateErr.File = file
+	templateErr.Line, _ = strconv.Atoi(line)
+	return templateErr
+}
+
+// ErrorReason returns the reason err failed a render, it is empty for errors
+// that are not render errors.
+func ErrorReason(err error) string {
+	var chartNotFoundErr *ChartNotFoundError
+	var invalidChartErr *InvalidChartError
+	var invalidValuesErr *InvalidValuesError
+	var templateErr *TemplateError
+
+	switch {
+	case errors.As(err, &chartNotFoundErr):
+		return ChartNotFoundReason
+	case errors.As(err, &invalidChartErr):
+		return InvalidChartReason
+	case errors.As(err, &invalidValuesErr):
+		return InvalidValuesReason
+	case errors.As(err, &templateErr):
+		return TemplateErrorReason
+	default:
+		return ""
+	}
+}
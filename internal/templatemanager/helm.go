@@ -2,43 +2,45 @@ package templatemanager
 
 import (
 	"context"
-	"fmt"
-	"log"
-	"os"
-	"path/filepath"
+	"strconv"
+	"strings"
 
 	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"github.com/octopipe/circlerr/internal/utils/annotation"
+	"github.com/octopipe/circlerr/internal/utils/manifest"
+	"github.com/octopipe/circlerr/pkg/twice/reconciler"
 	"helm.sh/helm/v3/pkg/action"
-	"helm.sh/helm/v3/pkg/chart/loader"
-	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/release"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
 )
 
 type helmTemplate struct {
 	client.Client
+	chartCache chartCache
+	indexCache *indexCache
 }
 
 func NewHelmTemplate(client client.Client) Template {
-	return helmTemplate{Client: client}
+	return helmTemplate{Client: client, chartCache: newChartCache(), indexCache: newIndexCache()}
 }
 
-func (t helmTemplate) GetManifests(ctx context.Context, module circlerriov1alpha1.Module, circle circlerriov1alpha1.Circle) ([][]byte, error) {
-	settings := cli.New()
-
-	actionConfig := new(action.Configuration)
-	if err := actionConfig.Init(settings.RESTClientGetter(), circle.Namespace,
-		os.Getenv("HELM_DRIVER"), log.Printf); err != nil {
-		log.Printf("%+v", err)
-		os.Exit(1)
+// GetManifests renders the chart at the module path, or the one of its chart
+// source, without reaching the cluster. Hooks are returned as manifests of
+// their own annotated with their circlerr phases. Failures are returned as
+// ChartNotFoundError, InvalidChartError, InvalidValuesError or TemplateError.
+func (t helmTemplate) GetManifests(ctx context.Context, repositoryPath string, module circlerriov1alpha1.Module, circle circlerriov1alpha1.Circle) ([][]byte, error) {
+	vals, err := t.getValues(ctx, repositoryPath, module, circle)
+	if err != nil {
+		return nil, err
 	}
 
-	vals := map[string]interface{}{}
-	repositoryPath := fmt.Sprintf("%s/%s", os.Getenv("GIT_TMP_DIR"), module.Spec.Url)
-	chart, err := loader.Load(filepath.Join(repositoryPath, module.Spec.Path))
+	chart, err := t.loadChart(ctx, repositoryPath, module)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
+	actionConfig := &action.Configuration{Log: func(string, ...interface{}) {}}
 	client := action.NewInstall(actionConfig)
 	client.Namespace = circle.Spec.Namespace
 	client.ReleaseName = module.Name
@@ -47,13 +49,101 @@ func (t helmTemplate) GetManifests(ctx context.Context, module circlerriov1alpha
 	client.Replace = true
 	client.ClientOnly = true
 
-	values, err := client.Run(chart, vals)
+	rel, err := client.Run(chart, vals)
 	if err != nil {
-		panic(err)
+		if strings.Contains(err.Error(), "values don't meet the specifications of the schema") {
+			return nil, &InvalidValuesError{Source: "chart " + chart.Name(), Err: err}
+		}
+
+		return nil, newTemplateError(err)
 	}
 
-	manifest := []byte(values.Manifest)
-	manifests := [][]byte{manifest}
+	runTests := module.Spec.Helm != nil && module.Spec.Helm.RunTests
+	manifests := [][]byte{[]byte(rel.Manifest)}
+	for _, hook := range rel.Hooks {
+		hookManifest, err := getHookManifest(hook, runTests)
+		if err != nil {
+			return nil, err
+		}
+
+		if hookManifest != nil {
+			manifests = append(manifests, hookManifest)
+		}
+	}
 
 	return manifests, nil
 }
+
+// hookPhases maps the Helm hook events onto the phases of circlerr. Rollback
+// hooks have no phase, and neither have post-delete hooks: on-delete hooks run
+// before the objects are deleted. Test hooks run after the sync for modules
+// opting in with runTests.
+var hookPhases = map[release.HookEvent]string{
+	release.HookPreInstall:  reconciler.PreSyncHookPhase,
+	release.HookPreUpgrade:  reconciler.PreSyncHookPhase,
+	release.HookPostInstall: reconciler.PostSyncHookPhase,
+	release.HookPostUpgrade: reconciler.PostSyncHookPhase,
+	release.HookPreDelete:   reconciler.OnDeleteHookPhase,
+}
+
+// getHookManifest annotates the hook with its circlerr phases, delete policies
+// and weight as sync wave. Hooks without phase are dropped.
+func getHookManifest(hook *release.Hook, runTests bool) ([]byte, error) {
+	phases := []string{}
+	for _, event := range hook.Events {
+		phase, ok := hookPhases[event]
+		if event == release.HookTest && runTests {
+			phase, ok = reconciler.PostSyncHookPhase, true
+		}
+
+		if ok && !containsString(phases, phase) {
+			phases = append(phases, phase)
+		}
+	}
+
+	if len(phases) == 0 {
+		return nil, nil
+	}
+
+	rawJSON, err := yaml.YAMLToJSON([]byte(hook.Manifest))
+	if err != nil {
+		return nil, err
+	}
+
+	un, err := manifest.ToUnstructured(string(rawJSON))
+	if err != nil {
+		return nil, err
+	}
+
+	policies := []string{}
+	for _, policy := range hook.DeletePolicies {
+		policies = append(policies, string(policy))
+	}
+
+	annotations := un.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	annotations[annotation.HookAnnotation] = strings.Join(phases, ",")
+	if len(policies) > 0 {
+		annotations[annotation.HookDeletePolicyAnnotation] = strings.Join(policies, ",")
+	}
+
+	if _, ok := annotations[annotation.SyncWaveAnnotation]; !ok && hook.Weight != 0 {
+		annotations[annotation.SyncWaveAnnotation] = strconv.Itoa(hook.Weight)
+	}
+
+	un.SetAnnotations(annotations)
+	return un.MarshalJSON()
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
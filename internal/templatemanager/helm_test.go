@@ -0,0 +1,202 @@
+package templatemanager
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"github.com/octopipe/circlerr/internal/utils/annotation"
+	"github.com/octopipe/circlerr/internal/utils/manifest"
+	"github.com/octopipe/circlerr/pkg/twice/reconciler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type HelmTemplateTestSuite struct {
+	suite.Suite
+	repositoryPath string
+	template       Template
+	module         circlerriov1alpha1.Module
+	circle         circlerriov1alpha1.Circle
+}
+
+func (s *HelmTemplateTestSuite) SetupTest() {
+	s.repositoryPath = s.T().TempDir()
+	s.copyChart("testdata/guestbook", filepath.Join(s.repositoryPath, "guestbook"))
+	s.template = NewHelmTemplate(fake.NewClientBuilder().Build())
+
+	s.module = circlerriov1alpha1.Module{}
+	s.module.SetName("guestbook")
+	s.module.SetNamespace("default")
+	s.module.Spec.Path = "guestbook"
+
+	s.circle = circlerriov1alpha1.Circle{}
+	s.circle.Spec.Namespace = "default"
+	s.circle.Spec.Modules = []circlerriov1alpha1.CircleModule{{Name: "guestbook", Namespace: "default"}}
+}
+
+func (s *HelmTemplateTestSuite) copyChart(src string, dst string) {
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(dst, rel), 0755)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		return os.WriteFile(filepath.Join(dst, rel), data, 0644)
+	})
+	assert.NoError(s.T(), err)
+}
+
+func (s *HelmTemplateTestSuite) writeTemplate(name string, content string) {
+	path := filepath.Join(s.repositoryPath, "guestbook", "templates", name)
+	assert.NoError(s.T(), os.WriteFile(path, []byte(content), 0644))
+}
+
+func (s *HelmTemplateTestSuite) TestGetManifests() {
+	s.circle.Spec.Modules[0].Helm = &circlerriov1alpha1.CircleModuleHelm{
+		Set: []circlerriov1alpha1.Override{{Key: "image.tag", Value: "v2"}, {Key: "replicas", Value: "3"}},
+	}
+
+	manifests, err := s.template.GetManifests(context.Background(), s.repositoryPath, s.module, s.circle)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), manifests, 1)
+
+	splitedManifests, err := manifest.SplitManifests(manifests[0])
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), splitedManifests, 1)
+
+	un, err := manifest.ToUnstructured(splitedManifests[0])
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "guestbook", un.GetName())
+	replicas, _, _ := unstructured.NestedInt64(un.Object, "spec", "replicas")
+	assert.Equal(s.T(), int64(3), replicas)
+	containers, _, _ := unstructured.NestedSlice(un.Object, "spec", "template", "spec", "containers")
+	assert.Equal(s.T(), "guestbook-ui:v2", containers[0].(map[string]interface{})["image"])
+}
+
+func (s *HelmTemplateTestSuite) TestGetManifestsHooks() {
+	s.writeTemplate("migration.yaml", `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migration
+  annotations:
+    helm.sh/hook: pre-install,pre-upgrade
+    helm.sh/hook-weight: "-5"
+    helm.sh/hook-delete-policy: before-hook-creation,hook-succeeded
+`)
+	s.writeTemplate("test.yaml", "apiVersion: v1\nkind: Pod\nmetadata:\n  name: guestbook-test\n  annotations:\n    helm.sh/hook: test\n")
+	s.writeTemplate("rollback.yaml", "apiVersion: v1\nkind: Pod\nmetadata:\n  name: rollback\n  annotations:\n    helm.sh/hook: pre-rollback\n")
+	s.writeTemplate("cleanup.yaml", "apiVersion: v1\nkind: Pod\nmetadata:\n  name: cleanup\n  annotations:\n    helm.sh/hook: pre-delete,post-delete\n")
+
+	manifests, err := s.template.GetManifests(context.Background(), s.repositoryPath, s.module, s.circle)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), manifests, 3)
+
+	annotations := map[string]map[string]string{}
+	for _, m := range manifests[1:] {
+		un, err := manifest.ToUnstructured(string(m))
+		assert.NoError(s.T(), err)
+		annotations[un.GetName()] = un.GetAnnotations()
+	}
+
+	assert.Equal(s.T(), reconciler.PreSyncHookPhase, annotations["migration"][annotation.HookAnnotation])
+	assert.Equal(s.T(), "before-hook-creation,hook-succeeded", annotations["migration"][annotation.HookDeletePolicyAnnotation])
+	assert.Equal(s.T(), "-5", annotations["migration"][annotation.SyncWaveAnnotation])
+	assert.Equal(s.T(), reconciler.OnDeleteHookPhase, annotations["cleanup"][annotation.HookAnnotation])
+	assert.NotContains(s.T(), annotations["cleanup"], annotation.HookDeletePolicyAnnotation)
+	assert.NotContains(s.T(), annotations, "guestbook-test")
+}
+
+func (s *HelmTemplateTestSuite) TestGetManifestsTestHooks() {
+	s.writeTemplate("test.yaml", "apiVersion: v1\nkind: Pod\nmetadata:\n  name: guestbook-test\n  annotations:\n    helm.sh/hook: test\n    helm.sh/hook-delete-policy: before-hook-creation\n")
+	s.module.Spec.Helm = &circlerriov1alpha1.ModuleHelm{RunTests: true}
+
+	manifests, err := s.template.GetManifests(context.Background(), s.repositoryPath, s.module, s.circle)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), manifests, 2)
+
+	un, err := manifest.ToUnstructured(string(manifests[1]))
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "guestbook-test", un.GetName())
+	assert.Equal(s.T(), reconciler.PostSyncHookPhase, un.GetAnnotations()[annotation.HookAnnotation])
+	assert.Equal(s.T(), "before-hook-creation", un.GetAnnotations()[annotation.HookDeletePolicyAnnotation])
+}
+
+func (s *HelmTemplateTestSuite) TestGetManifestsChartNotFound() {
+	s.module.Spec.Path = "unknown"
+
+	_, err := s.template.GetManifests(context.Background(), s.repositoryPath, s.module, s.circle)
+	chartNotFoundErr := &ChartNotFoundError{}
+	assert.True(s.T(), errors.As(err, &chartNotFoundErr))
+	assert.Equal(s.T(), "unknown", chartNotFoundErr.Path)
+	assert.Equal(s.T(), ChartNotFoundReason, ErrorReason(err))
+}
+
+func (s *HelmTemplateTestSuite) TestGetManifestsInvalidChart() {
+	assert.NoError(s.T(), os.Remove(filepath.Join(s.repositoryPath, "guestbook", "Chart.yaml")))
+
+	_, err := s.template.GetManifests(context.Background(), s.repositoryPath, s.module, s.circle)
+	assert.Equal(s.T(), InvalidChartReason, ErrorReason(err))
+}
+
+func (s *HelmTemplateTestSuite) TestGetManifestsValuesNotMatchingSchema() {
+	s.module.Spec.Helm = &circlerriov1alpha1.ModuleHelm{Values: "replicas: many"}
+
+	_, err := s.template.GetManifests(context.Background(), s.repositoryPath, s.module, s.circle)
+	invalidValuesErr := &InvalidValuesError{}
+	assert.True(s.T(), errors.As(err, &invalidValuesErr))
+	assert.Equal(s.T(), "chart guestbook", invalidValuesErr.Source)
+}
+
+func (s *HelmTemplateTestSuite) TestGetManifestsExecutionError() {
+	s.writeTemplate("configmap.yaml", "apiVersion: v1\nkind: ConfigMap\ndata:\n  key: {{ .Values.config.key }}\n")
+
+	_, err := s.template.GetManifests(context.Background(), s.repositoryPath, s.module, s.circle)
+	templateErr := &TemplateError{}
+	assert.True(s.T(), errors.As(err, &templateErr))
+	assert.Equal(s.T(), "guestbook/templates/configmap.yaml", templateErr.File)
+	assert.Equal(s.T(), 4, templateErr.Line)
+	assert.Equal(s.T(), TemplateErrorReason, ErrorReason(err))
+}
+
+func (s *HelmTemplateTestSuite) TestGetManifestsParseError() {
+	s.writeTemplate("configmap.yaml", "apiVersion: v1\nkind: ConfigMap\n{{ if }}\n")
+
+	_, err := s.template.GetManifests(context.Background(), s.repositoryPath, s.module, s.circle)
+	templateErr := &TemplateError{}
+	assert.True(s.T(), errors.As(err, &templateErr))
+	assert.Equal(s.T(), "guestbook/templates/configmap.yaml", templateErr.File)
+	assert.Equal(s.T(), 3, templateErr.Line)
+}
+
+func (s *HelmTemplateTestSuite) TestGetManifestsYAMLError() {
+	s.writeTemplate("configmap.yaml", "apiVersion: v1\nkind: ConfigMap\ndata:\n  key: [value\n")
+
+	_, err := s.template.GetManifests(context.Background(), s.repositoryPath, s.module, s.circle)
+	templateErr := &TemplateError{}
+	assert.True(s.T(), errors.As(err, &templateErr))
+	assert.Equal(s.T(), "guestbook/templates/configmap.yaml", templateErr.File)
+	assert.NotZero(s.T(), templateErr.Line)
+}
+
+func TestHelmTemplateTestSuite(t *testing.T) {
+	suite.Run(t, new(HelmTemplateTestSuite))
+}
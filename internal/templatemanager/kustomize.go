@@ -0,0 +1,125 @@
+package templatemanager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/yaml"
+)
+
+type kustomizeTemplate struct {
+	client.Client
+}
+
+func NewKustomizeTemplate(client client.Client) Template {
+	return kustomizeTemplate{Client: client}
+}
+
+// GetManifests builds the kustomization at the module path. The kustomize
+// settings of the circle module are applied by an overlay generated in a
+// temporary directory, so the checked out revision is never modified.
+func (t kustomizeTemplate) GetManifests(ctx context.Context, repositoryPath string, module circlerriov1alpha1.Module, circle circlerriov1alpha1.Circle) ([][]byte, error) {
+	path, err := filepath.Abs(filepath.Join(repositoryPath, module.Spec.Path))
+	if err != nil {
+		return nil, err
+	}
+
+	circleModule := getCircleModule(circle, module)
+	if circleModule != nil && circleModule.Kustomize != nil {
+		overlayPath, err := os.MkdirTemp("", "circlerr-kustomize-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(overlayPath)
+
+		if err := writeOverlay(overlayPath, path, *circleModule.Kustomize); err != nil {
+			return nil, err
+		}
+
+		path = overlayPath
+	}
+
+	kustomizer := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+	resMap, err := kustomizer.Run(filesys.MakeFsOnDisk(), path)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := resMap.AsYaml()
+	if err != nil {
+		return nil, err
+	}
+
+	return [][]byte{manifest}, nil
+}
+
+func getCircleModule(circle circlerriov1alpha1.Circle, module circlerriov1alpha1.Module) *circlerriov1alpha1.CircleModule {
+	for i, circleModule := range circle.Spec.Modules {
+		if circleModule.Name == module.GetName() && circleModule.Namespace == module.GetNamespace() {
+			return &circle.Spec.Modules[i]
+		}
+	}
+
+	return nil
+}
+
+// writeOverlay writes a kustomization to overlayPath that has the kustomization
+// at basePath as its only resource, kustomize only accepts it as a path
+// relative to the overlay.
+func writeOverlay(overlayPath string, basePath string, settings circlerriov1alpha1.CircleModuleKustomize) error {
+	basePath, err := filepath.Rel(overlayPath, basePath)
+	if err != nil {
+		return err
+	}
+
+	kustomization := types.Kustomization{
+		TypeMeta: types.TypeMeta{
+			APIVersion: types.KustomizationVersion,
+			Kind:       types.KustomizationKind,
+		},
+		Resources:    []string{basePath},
+		NamePrefix:   settings.NamePrefix,
+		CommonLabels: settings.CommonLabels,
+	}
+
+	for _, image := range settings.Images {
+		kustomization.Images = append(kustomization.Images, types.Image{
+			Name:    image.Name,
+			NewName: image.NewName,
+			NewTag:  image.NewTag,
+			Digest:  image.Digest,
+		})
+	}
+
+	for _, patch := range settings.Patches {
+		p := types.Patch{Patch: patch.Patch}
+		if patch.Target != nil {
+			p.Target = &types.Selector{
+				ResId: resid.ResId{
+					Gvk:       resid.Gvk{Group: patch.Target.Group, Version: patch.Target.Version, Kind: patch.Target.Kind},
+					Name:      patch.Target.Name,
+					Namespace: patch.Target.Namespace,
+				},
+				LabelSelector:      patch.Target.LabelSelector,
+				AnnotationSelector: patch.Target.AnnotationSelector,
+			}
+		}
+
+		kustomization.Patches = append(kustomization.Patches, p)
+	}
+
+	data, err := yaml.Marshal(kustomization)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(overlayPath, konfig.DefaultKustomizationFileName()), data, 0644)
+}
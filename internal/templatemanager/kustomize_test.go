@@ -0,0 +1,111 @@
+package templatemanager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"github.com/octopipe/circlerr/internal/utils/manifest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const guestbookKustomization = `
+apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+- deployment.yaml
+`
+
+const guestbookDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: guestbook-ui
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: guestbook-ui
+        image: guestbook-ui:v1
+`
+
+type KustomizeTemplateTestSuite struct {
+	suite.Suite
+	repositoryPath string
+	module         circlerriov1alpha1.Module
+	circle         circlerriov1alpha1.Circle
+}
+
+func (s *KustomizeTemplateTestSuite) SetupTest() {
+	s.repositoryPath = s.T().TempDir()
+	path := filepath.Join(s.repositoryPath, "guestbook")
+	assert.NoError(s.T(), os.MkdirAll(path, 0755))
+	assert.NoError(s.T(), os.WriteFile(filepath.Join(path, "kustomization.yaml"), []byte(guestbookKustomization), 0644))
+	assert.NoError(s.T(), os.WriteFile(filepath.Join(path, "deployment.yaml"), []byte(guestbookDeployment), 0644))
+
+	s.module = circlerriov1alpha1.Module{}
+	s.module.SetName("guestbook")
+	s.module.SetNamespace("default")
+	s.module.Spec.Path = "guestbook"
+
+	s.circle = circlerriov1alpha1.Circle{}
+	s.circle.Spec.Modules = []circlerriov1alpha1.CircleModule{{Name: "guestbook", Namespace: "default"}}
+}
+
+func (s *KustomizeTemplateTestSuite) getDeployment() *unstructured.Unstructured {
+	manifests, err := NewKustomizeTemplate(nil).GetManifests(context.Background(), s.repositoryPath, s.module, s.circle)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), manifests, 1)
+
+	splitedManifests, err := manifest.SplitManifests(manifests[0])
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), splitedManifests, 1)
+
+	un, err := manifest.ToUnstructured(splitedManifests[0])
+	assert.NoError(s.T(), err)
+	return un
+}
+
+func (s *KustomizeTemplateTestSuite) TestBuild() {
+	un := s.getDeployment()
+
+	assert.Equal(s.T(), "Deployment", un.GetKind())
+	assert.Equal(s.T(), "guestbook-ui", un.GetName())
+}
+
+func (s *KustomizeTemplateTestSuite) TestBuildWithCircleKustomize() {
+	s.circle.Spec.Modules[0].Kustomize = &circlerriov1alpha1.CircleModuleKustomize{
+		NamePrefix:   "circle-a-",
+		CommonLabels: map[string]string{"circle": "circle-a"},
+		Images:       []circlerriov1alpha1.KustomizeImage{{Name: "guestbook-ui", NewTag: "v2"}},
+		Patches: []circlerriov1alpha1.KustomizePatch{{
+			Patch:  `[{"op": "replace", "path": "/spec/replicas", "value": 3}]`,
+			Target: &circlerriov1alpha1.KustomizePatchTarget{Kind: "Deployment", Name: "guestbook-ui"},
+		}},
+	}
+
+	un := s.getDeployment()
+
+	assert.Equal(s.T(), "circle-a-guestbook-ui", un.GetName())
+	assert.Equal(s.T(), map[string]string{"circle": "circle-a"}, un.GetLabels())
+	replicas, _, _ := unstructured.NestedInt64(un.Object, "spec", "replicas")
+	assert.Equal(s.T(), int64(3), replicas)
+	containers, _, _ := unstructured.NestedSlice(un.Object, "spec", "template", "spec", "containers")
+	assert.Equal(s.T(), "guestbook-ui:v2", containers[0].(map[string]interface{})["image"])
+}
+
+func (s *KustomizeTemplateTestSuite) TestBuildInvalidPath() {
+	s.module.Spec.Path = "not-found"
+
+	_, err := NewKustomizeTemplate(nil).GetManifests(context.Background(), s.repositoryPath, s.module, s.circle)
+	assert.Error(s.T(), err)
+}
+
+func TestKustomizeTemplateTestSuite(t *testing.T) {
+	suite.Run(t, new(KustomizeTemplateTestSuite))
+}
@@ -2,7 +2,6 @@ package templatemanager
 
 import (
 	"context"
-	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -20,11 +19,10 @@ func NewSimpleTemplate(client client.Client) Template {
 	return simpleTemplate{Client: client}
 }
 
-func (t simpleTemplate) GetManifests(ctx context.Context, module circlerriov1alpha1.Module, circle circlerriov1alpha1.Circle) ([][]byte, error) {
+func (t simpleTemplate) GetManifests(ctx context.Context, repositoryPath string, module circlerriov1alpha1.Module, circle circlerriov1alpha1.Circle) ([][]byte, error) {
 	manifests := [][]byte{}
 
 	deploymentPath := module.Spec.Path
-	repositoryPath := fmt.Sprintf("%s/%s", os.Getenv("GIT_TMP_DIR"), module.Spec.Url)
 
 	if err := filepath.Walk(filepath.Join(repositoryPath, deploymentPath), func(path string, info os.FileInfo, err error) error {
 		if err != nil {
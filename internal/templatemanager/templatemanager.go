@@ -3,36 +3,48 @@ package templatemanager
 import (
 	"context"
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 
-	"github.com/goccy/go-yaml"
+	goyaml "github.com/goccy/go-yaml"
 	"github.com/goccy/go-yaml/parser"
 	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
 	"github.com/octopipe/circlerr/internal/domain"
+	"github.com/octopipe/circlerr/internal/gitmanager"
+	"github.com/octopipe/circlerr/internal/utils/annotation"
 	"github.com/octopipe/circlerr/internal/utils/manifest"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
 )
 
 type Template interface {
-	GetManifests(ctx context.Context, module circlerriov1alpha1.Module, circle circlerriov1alpha1.Circle) ([][]byte, error)
+	GetManifests(ctx context.Context, repositoryPath string, module circlerriov1alpha1.Module, circle circlerriov1alpha1.Circle) ([][]byte, error)
 }
 
 type TemplateManager struct {
 	client.Client
-	simpleTemplate Template
-	helmTemplate   Template
+	gitManager        gitmanager.Manager
+	simpleTemplate    Template
+	helmTemplate      Template
+	kustomizeTemplate Template
 }
 
-func NewTemplateManager(client client.Client) TemplateManager {
+func NewTemplateManager(client client.Client, gitManager gitmanager.Manager) TemplateManager {
 	return TemplateManager{
-		Client:         client,
-		simpleTemplate: NewSimpleTemplate(client),
-		helmTemplate:   NewHelmTemplate(client),
+		Client:            client,
+		gitManager:        gitManager,
+		simpleTemplate:    NewSimpleTemplate(client),
+		helmTemplate:      NewHelmTemplate(client),
+		kustomizeTemplate: NewKustomizeTemplate(client),
 	}
 }
 
 func (t TemplateManager) RenderManifests(ctx context.Context, circle circlerriov1alpha1.Circle) ([]string, error) {
 	manifests := []string{}
+	envs := getEnvs(circle.Spec.Environments)
 
 	for _, circleModule := range circle.Spec.Modules {
 		module := &circlerriov1alpha1.Module{}
@@ -42,7 +54,17 @@ func (t TemplateManager) RenderManifests(ctx context.Context, circle circlerriov
 			return nil, err
 		}
 
-		rawManifests, err := t.getManifests(ctx, *module, circle)
+		// Modules rendering a chart from a chart source may have no repository.
+		revision := gitmanager.Revision{}
+		if module.Spec.Url != "" {
+			revision, err = t.gitManager.Sync(*module, circleModule.Revision)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		rawManifests, err := t.getManifests(ctx, revision.Path, *module, circle)
+		revision.Release()
 		if err != nil {
 			return nil, err
 		}
@@ -58,6 +80,11 @@ func (t TemplateManager) RenderManifests(ctx context.Context, circle circlerriov
 				if err != nil {
 					return nil, err
 				}
+
+				m, err = t.prepareManifest(m, *module, revision.Commit, envs)
+				if err != nil {
+					return nil, err
+				}
 				manifests = append(manifests, m)
 			}
 		}
@@ -66,6 +93,47 @@ func (t TemplateManager) RenderManifests(ctx context.Context, circle circlerriov
 	return manifests, nil
 }
 
+// ValidateModule renders the module checked out at repositoryPath into its own
+// namespace and checks that every manifest is a valid object. The path is
+// empty for modules without repository.
+func (t TemplateManager) ValidateModule(ctx context.Context, repositoryPath string, module circlerriov1alpha1.Module) error {
+	if module.Spec.Chart == nil {
+		if _, err := os.Stat(filepath.Join(repositoryPath, module.Spec.Path)); err != nil {
+			return fmt.Errorf("path %q not found in repository", module.Spec.Path)
+		}
+	}
+
+	circle := circlerriov1alpha1.Circle{}
+	circle.SetName(module.GetName())
+	circle.SetNamespace(module.GetNamespace())
+	circle.Spec.Namespace = module.GetNamespace()
+
+	rawManifests, err := t.getManifests(ctx, repositoryPath, module, circle)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range rawManifests {
+		splitedManifests, err := manifest.SplitManifests(r)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range splitedManifests {
+			un, err := manifest.ToUnstructured(m)
+			if err != nil {
+				return err
+			}
+
+			if un.GetKind() == "" || un.GetAPIVersion() == "" || un.GetName() == "" {
+				return errors.New("manifest without apiVersion, kind or name")
+			}
+		}
+	}
+
+	return nil
+}
+
 func (t TemplateManager) overrideValues(manifest string, overrides []circlerriov1alpha1.Override) (string, error) {
 	file, err := parser.ParseBytes([]byte(manifest), 1)
 	if err != nil {
@@ -73,12 +141,12 @@ func (t TemplateManager) overrideValues(manifest string, overrides []circlerriov
 	}
 
 	for _, override := range overrides {
-		p, err := yaml.PathString(override.Key)
+		p, err := goyaml.PathString(override.Key)
 		if err != nil {
 			return "", err
 		}
 
-		node, err := yaml.NewEncoder(nil, yaml.JSON()).EncodeToNode(override.Value)
+		node, err := goyaml.NewEncoder(nil, goyaml.JSON()).EncodeToNode(override.Value)
 		if err != nil {
 			return "", err
 		}
@@ -92,12 +160,59 @@ func (t TemplateManager) overrideValues(manifest string, overrides []circlerriov
 	return file.String(), nil
 }
 
-func (t TemplateManager) getManifests(ctx context.Context, module circlerriov1alpha1.Module, circle circlerriov1alpha1.Circle) ([][]byte, error) {
+// prepareManifest annotates the object with its module and injects the circle
+// environments into its containers, circle values take precedence over the
+// values of the rendered manifest.
+func (t TemplateManager) prepareManifest(m string, module circlerriov1alpha1.Module, commit string, envs []corev1.EnvVar) (string, error) {
+	rawJSON, err := yaml.YAMLToJSON([]byte(m))
+	if err != nil {
+		return "", err
+	}
+
+	un, err := manifest.ToUnstructured(string(rawJSON))
+	if err != nil {
+		return "", err
+	}
+
+	if err := manifest.SetContainerEnvs(un, envs); err != nil {
+		return "", err
+	}
+
+	un = annotation.AddModuleAnnotationsToObject(un, module, commit)
+	rawJSON, err = un.MarshalJSON()
+	if err != nil {
+		return "", err
+	}
+
+	return string(rawJSON), nil
+}
+
+func getEnvs(environments []circlerriov1alpha1.CircleEnvironments) []corev1.EnvVar {
+	envs := []corev1.EnvVar{}
+	for _, environment := range environments {
+		env := corev1.EnvVar{Name: environment.Key, Value: environment.Value}
+		if environment.ValueFrom != nil {
+			env.Value = ""
+			env.ValueFrom = &corev1.EnvVarSource{
+				ConfigMapKeyRef: environment.ValueFrom.ConfigMapKeyRef,
+				SecretKeyRef:    environment.ValueFrom.SecretKeyRef,
+			}
+		}
+
+		envs = append(envs, env)
+	}
+
+	return envs
+}
+
+func (t TemplateManager) getManifests(ctx context.Context, repositoryPath string, module circlerriov1alpha1.Module, circle circlerriov1alpha1.Circle) ([][]byte, error) {
 	switch module.Spec.TemplateType {
 	case domain.SimpleModuleTemplateType:
-		return t.simpleTemplate.GetManifests(ctx, module, circle)
+		return t.simpleTemplate.GetManifests(ctx, repositoryPath, module, circle)
 	case domain.HelmModuleTemplateType:
-		return t.helmTemplate.GetManifests(ctx, module, circle)
+		return t.helmTemplate.GetManifests(ctx, repositoryPath, module, circle)
+	case domain.KustomizeModuleTemplateType:
+		return t.kustomizeTemplate.GetManifests(ctx, repositoryPath, module, circle)
 	default:
 		return nil, errors.New("invalid module type")
 	}
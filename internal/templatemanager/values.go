@@ -0,0 +1,202 @@
+package templatemanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"helm.sh/helm/v3/pkg/strvals"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// getValues merges the values a HELM module is rendered with in the circle.
+// The chart values are overridden, in order, by the module value files, values
+// from ConfigMaps and Secrets and inline values, then by the circle values from
+// ConfigMaps and Secrets, inline values and set keys.
+func (t helmTemplate) getValues(ctx context.Context, repositoryPath string, module circlerriov1alpha1.Module, circle circlerriov1alpha1.Circle) (map[string]interface{}, error) {
+	vals := map[string]interface{}{}
+
+	if module.Spec.Helm != nil {
+		chartPath := filepath.Join(repositoryPath, module.Spec.Path)
+		for _, valueFile := range module.Spec.Helm.ValueFiles {
+			source := fmt.Sprintf("values file %q", valueFile)
+			data, err := readValueFile(repositoryPath, chartPath, valueFile)
+			if err != nil {
+				return nil, &InvalidValuesError{Source: source, Err: err}
+			}
+
+			if vals, err = mergeValues(vals, data); err != nil {
+				return nil, &InvalidValuesError{Source: source, Err: err}
+			}
+		}
+
+		var err error
+		if vals, err = t.mergeValuesFrom(ctx, vals, module.GetNamespace(), module.Spec.Helm.ValuesFrom); err != nil {
+			return nil, err
+		}
+
+		if vals, err = mergeValues(vals, []byte(module.Spec.Helm.Values)); err != nil {
+			return nil, &InvalidValuesError{Source: "module values", Err: err}
+		}
+	}
+
+	circleModule := getCircleModule(circle, module)
+	if circleModule == nil || circleModule.Helm == nil {
+		return vals, nil
+	}
+
+	vals, err := t.mergeValuesFrom(ctx, vals, circle.GetNamespace(), circleModule.Helm.ValuesFrom)
+	if err != nil {
+		return nil, err
+	}
+
+	if vals, err = mergeValues(vals, []byte(circleModule.Helm.Values)); err != nil {
+		return nil, &InvalidValuesError{Source: "circle values", Err: err}
+	}
+
+	for _, set := range circleModule.Helm.Set {
+		if err := strvals.ParseInto(fmt.Sprintf("%s=%s", set.Key, set.Value), vals); err != nil {
+			return nil, &InvalidValuesError{Source: fmt.Sprintf("set key %q", set.Key), Err: err}
+		}
+	}
+
+	return vals, nil
+}
+
+func (t helmTemplate) mergeValuesFrom(ctx context.Context, vals map[string]interface{}, namespace string, sources []circlerriov1alpha1.HelmValuesSource) (map[string]interface{}, error) {
+	for _, source := range sources {
+		data, name, err := t.getValuesSource(ctx, namespace, source)
+		if err != nil {
+			return nil, err
+		}
+
+		if vals, err = mergeValues(vals, data); err != nil {
+			return nil, &InvalidValuesError{Source: name, Err: err}
+		}
+	}
+
+	return vals, nil
+}
+
+// getValuesSource returns the values stored in the key of the ConfigMap or
+// Secret, optional sources that are not found have no values. Missing sources
+// are returned as InvalidValuesError, any other error is returned as is.
+func (t helmTemplate) getValuesSource(ctx context.Context, namespace string, source circlerriov1alpha1.HelmValuesSource) ([]byte, string, error) {
+	if ref := source.ConfigMapKeyRef; ref != nil {
+		name := fmt.Sprintf("configmap %s/%s", namespace, ref.Name)
+		configMap := &corev1.ConfigMap{}
+		err := t.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, configMap)
+		if err != nil {
+			if k8sErrors.IsNotFound(err) {
+				return nil, name, notFoundValuesSource(name, ref.Optional, err)
+			}
+
+			return nil, name, err
+		}
+
+		value, ok := configMap.Data[ref.Key]
+		if !ok {
+			return nil, name, notFoundValuesSource(name, ref.Optional, fmt.Errorf("key %q not found", ref.Key))
+		}
+
+		return []byte(value), name, nil
+	}
+
+	if ref := source.SecretKeyRef; ref != nil {
+		name := fmt.Sprintf("secret %s/%s", namespace, ref.Name)
+		secret := &corev1.Secret{}
+		err := t.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, secret)
+		if err != nil {
+			if k8sErrors.IsNotFound(err) {
+				return nil, name, notFoundValuesSource(name, ref.Optional, err)
+			}
+
+			return nil, name, err
+		}
+
+		value, ok := secret.Data[ref.Key]
+		if !ok {
+			return nil, name, notFoundValuesSource(name, ref.Optional, fmt.Errorf("key %q not found", ref.Key))
+		}
+
+		return value, name, nil
+	}
+
+	return nil, "", nil
+}
+
+func notFoundValuesSource(name string, optional *bool, err error) error {
+	if optional != nil && *optional {
+		return nil
+	}
+
+	return &InvalidValuesError{Source: name, Err: err}
+}
+
+// readValueFile reads a values file relative to the chart, refusing files
+// outside the repository, symlinks included.
+func readValueFile(repositoryPath string, chartPath string, valueFile string) ([]byte, error) {
+	path := filepath.Join(chartPath, valueFile)
+	if !isInside(repositoryPath, path) {
+		return nil, errors.New("file is outside the repository")
+	}
+
+	root, err := filepath.EvalSymlinks(repositoryPath)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isInside(root, target) {
+		return nil, errors.New("file is outside the repository")
+	}
+
+	return os.ReadFile(target)
+}
+
+func isInside(root string, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// mergeValues merges the YAML values of data into vals, maps are merged key by
+// key and any other value replaces the one in vals.
+func mergeValues(vals map[string]interface{}, data []byte) (map[string]interface{}, error) {
+	override := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &override); err != nil {
+		return nil, err
+	}
+
+	return mergeMaps(vals, override), nil
+}
+
+func mergeMaps(a, b map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(a))
+	for k, v := range a {
+		out[k] = v
+	}
+
+	for k, v := range b {
+		if v, ok := v.(map[string]interface{}); ok {
+			if bv, ok := out[k].(map[string]interface{}); ok {
+				out[k] = mergeMaps(bv, v)
+				continue
+			}
+		}
+
+		out[k] = v
+	}
+
+	return out
+}
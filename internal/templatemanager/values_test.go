@@ -0,0 +1,169 @@
+package templatemanager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const guestbookValues = `
+image:
+  repository: guestbook-ui
+  tag: v1
+replicas: 1
+`
+
+type HelmValuesTestSuite struct {
+	suite.Suite
+	repositoryPath string
+	template       helmTemplate
+	module         circlerriov1alpha1.Module
+	circle         circlerriov1alpha1.Circle
+}
+
+func (s *HelmValuesTestSuite) SetupTest() {
+	s.repositoryPath = s.T().TempDir()
+	path := filepath.Join(s.repositoryPath, "guestbook")
+	assert.NoError(s.T(), os.MkdirAll(path, 0755))
+	assert.NoError(s.T(), os.WriteFile(filepath.Join(path, "values-prod.yaml"), []byte(guestbookValues), 0644))
+	assert.NoError(s.T(), os.WriteFile(filepath.Join(s.repositoryPath, "outside.yaml"), []byte("replicas: 5"), 0644))
+
+	s.template = helmTemplate{Client: fake.NewClientBuilder().WithObjects(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "guestbook-values", Namespace: "default"},
+			Data:       map[string]string{"values.yaml": "replicas: 2\nservice:\n  port: 80\n"},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "circle-values", Namespace: "circles"},
+			Data:       map[string][]byte{"values.yaml": []byte("image:\n  tag: v2\n")},
+		},
+	).Build()}
+
+	s.module = circlerriov1alpha1.Module{}
+	s.module.SetName("guestbook")
+	s.module.SetNamespace("default")
+	s.module.Spec.Path = "guestbook"
+
+	s.circle = circlerriov1alpha1.Circle{}
+	s.circle.SetNamespace("circles")
+	s.circle.Spec.Modules = []circlerriov1alpha1.CircleModule{{Name: "guestbook", Namespace: "default"}}
+}
+
+func (s *HelmValuesTestSuite) TestGetValuesWithoutHelm() {
+	vals, err := s.template.getValues(context.Background(), s.repositoryPath, s.module, s.circle)
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), vals)
+}
+
+func (s *HelmValuesTestSuite) TestGetValuesPrecedence() {
+	s.module.Spec.Helm = &circlerriov1alpha1.ModuleHelm{
+		ValueFiles: []string{"values-prod.yaml"},
+		ValuesFrom: []circlerriov1alpha1.HelmValuesSource{{
+			ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "guestbook-values"},
+				Key:                  "values.yaml",
+			},
+		}},
+		Values: "service:\n  type: ClusterIP\n",
+	}
+	s.circle.Spec.Modules[0].Helm = &circlerriov1alpha1.CircleModuleHelm{
+		ValuesFrom: []circlerriov1alpha1.HelmValuesSource{{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "circle-values"},
+				Key:                  "values.yaml",
+			},
+		}},
+		Values: "replicas: 3\n",
+		Set:    []circlerriov1alpha1.Override{{Key: "image.tag", Value: "v3"}, {Key: "service.port", Value: "8080"}},
+	}
+
+	vals, err := s.template.getValues(context.Background(), s.repositoryPath, s.module, s.circle)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), map[string]interface{}{
+		"image":    map[string]interface{}{"repository": "guestbook-ui", "tag": "v3"},
+		"replicas": float64(3),
+		"service":  map[string]interface{}{"port": int64(8080), "type": "ClusterIP"},
+	}, vals)
+}
+
+func (s *HelmValuesTestSuite) TestGetValuesOptionalSource() {
+	optional := true
+	s.module.Spec.Helm = &circlerriov1alpha1.ModuleHelm{
+		ValuesFrom: []circlerriov1alpha1.HelmValuesSource{{
+			ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "not-found"},
+				Key:                  "values.yaml",
+				Optional:             &optional,
+			},
+		}},
+	}
+
+	vals, err := s.template.getValues(context.Background(), s.repositoryPath, s.module, s.circle)
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), vals)
+
+	s.module.Spec.Helm.ValuesFrom[0].ConfigMapKeyRef.Optional = nil
+	_, err = s.template.getValues(context.Background(), s.repositoryPath, s.module, s.circle)
+	assert.Error(s.T(), err)
+}
+
+func (s *HelmValuesTestSuite) TestGetValuesMissingKey() {
+	s.module.Spec.Helm = &circlerriov1alpha1.ModuleHelm{
+		ValuesFrom: []circlerriov1alpha1.HelmValuesSource{{
+			ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "guestbook-values"},
+				Key:                  "prod.yaml",
+			},
+		}},
+	}
+
+	_, err := s.template.getValues(context.Background(), s.repositoryPath, s.module, s.circle)
+	assert.EqualError(s.T(), err, `invalid values in configmap default/guestbook-values: key "prod.yaml" not found`)
+	assert.Equal(s.T(), InvalidValuesReason, ErrorReason(err))
+}
+
+func (s *HelmValuesTestSuite) TestGetValuesFileOutsideRepository() {
+	s.module.Spec.Helm = &circlerriov1alpha1.ModuleHelm{ValueFiles: []string{"../outside.yaml"}}
+	vals, err := s.template.getValues(context.Background(), s.repositoryPath, s.module, s.circle)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), float64(5), vals["replicas"])
+
+	s.module.Spec.Helm = &circlerriov1alpha1.ModuleHelm{ValueFiles: []string{"../../outside.yaml"}}
+	_, err = s.template.getValues(context.Background(), s.repositoryPath, s.module, s.circle)
+	assert.EqualError(s.T(), err, `invalid values in values file "../../outside.yaml": file is outside the repository`)
+}
+
+func (s *HelmValuesTestSuite) TestGetValuesSymlinkOutsideRepository() {
+	outside := filepath.Join(s.T().TempDir(), "token")
+	assert.NoError(s.T(), os.WriteFile(outside, []byte("replicas: 5"), 0600))
+	assert.NoError(s.T(), os.Symlink(outside, filepath.Join(s.repositoryPath, "guestbook", "values-link.yaml")))
+
+	s.module.Spec.Helm = &circlerriov1alpha1.ModuleHelm{ValueFiles: []string{"values-link.yaml"}}
+	_, err := s.template.getValues(context.Background(), s.repositoryPath, s.module, s.circle)
+	assert.EqualError(s.T(), err, `invalid values in values file "values-link.yaml": file is outside the repository`)
+
+	assert.NoError(s.T(), os.Symlink("values-prod.yaml", filepath.Join(s.repositoryPath, "guestbook", "values-alias.yaml")))
+	s.module.Spec.Helm = &circlerriov1alpha1.ModuleHelm{ValueFiles: []string{"values-alias.yaml"}}
+	vals, err := s.template.getValues(context.Background(), s.repositoryPath, s.module, s.circle)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), float64(1), vals["replicas"])
+}
+
+func (s *HelmValuesTestSuite) TestGetValuesInvalidValues() {
+	s.module.Spec.Helm = &circlerriov1alpha1.ModuleHelm{Values: "replicas: [1"}
+
+	_, err := s.template.getValues(context.Background(), s.repositoryPath, s.module, s.circle)
+	assert.ErrorContains(s.T(), err, "invalid values in module values")
+}
+
+func TestHelmValuesTestSuite(t *testing.T) {
+	suite.Run(t, new(HelmValuesTestSuite))
+}
@@ -1,7 +1,10 @@
 package annotation
 
 import (
+	"fmt"
+
 	circlerriov1alpha1 "github.com/octopipe/circlerr/internal/api/v1alpha1"
+	"github.com/octopipe/circlerr/pkg/twice/resource"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
@@ -14,6 +17,19 @@ const (
 	ModuleNameAnnotation        = "circlerr.io/module-name"
 	ModuleNamespaceAnnotation   = "circlerr.io/module-namespace"
 	ModuleRevisionAnnotation    = "circlerr.io/module-revision"
+	SyncRequestedAtAnnotation   = "circlerr.io/sync-requested-at"
+	RoutingNamespaceAnnotation  = "circlerr.io/routing-namespace"
+	CircleLabel                 = "circlerr.io/circle"
+	CircleFinalizer             = "circlerr.io/finalizer"
+	SyncWaveAnnotation          = "circlerr.io/sync-wave"
+	HookAnnotation              = "circlerr.io/hook"
+	HookDeletePolicyAnnotation  = "circlerr.io/hook-delete-policy"
+
+	WorkspaceLabel                 = "circlerr.io/workspace"
+	WorkspaceLabelValue            = "true"
+	WorkspaceNameAnnotation        = "circlerr.io/workspace-name"
+	WorkspaceDescriptionAnnotation = "circlerr.io/workspace-description"
+	WorkspaceTypeAnnotation        = "circlerr.io/workspace-type"
 )
 
 func AddDefaultAnnotationsToObject(
@@ -32,3 +48,48 @@ func AddDefaultAnnotationsToObject(
 	un.SetAnnotations(annotations)
 	return un
 }
+
+func AddModuleAnnotationsToObject(
+	un *unstructured.Unstructured,
+	module circlerriov1alpha1.Module,
+	revision string,
+) *unstructured.Unstructured {
+	annotations := un.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	annotations[ModuleNameAnnotation] = module.GetName()
+	annotations[ModuleNamespaceAnnotation] = module.GetNamespace()
+	annotations[ModuleRevisionAnnotation] = revision
+
+	un.SetAnnotations(annotations)
+	return un
+}
+
+// IsControlled reports whether the object was deployed by circlerr.
+func IsControlled(un *unstructured.Unstructured) bool {
+	return un.GetAnnotations()[ControlledByAnnotation] == ControlledByAnnotationValue
+}
+
+// CircleIndex indexes cached resources by the circle that deployed them.
+const CircleIndex = "circle"
+
+// IndexCircle returns the namespace/name key of the circle that deployed the
+// cached resource.
+func IndexCircle(res resource.Resource) []string {
+	if res.Object == nil || !IsControlled(res.Object) {
+		return []string{}
+	}
+
+	annotations := res.Object.GetAnnotations()
+	if annotations[CircleNameAnnotation] == "" {
+		return []string{}
+	}
+
+	return []string{GetCircleIndexKey(annotations[CircleNamespaceAnnotation], annotations[CircleNameAnnotation])}
+}
+
+func GetCircleIndexKey(namespace string, name string) string {
+	return fmt.Sprintf("%s/%s", namespace, name)
+}
@@ -3,10 +3,14 @@ package manifest
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
+	"strings"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	kubeyaml "k8s.io/apimachinery/pkg/util/yaml"
 )
 
@@ -43,3 +47,83 @@ func ToUnstructured(manifest string) (*unstructured.Unstructured, error) {
 
 	return newManifest, nil
 }
+
+var podTemplatePaths = map[schema.GroupKind][]string{
+	{Group: "apps", Kind: "Deployment"}:  {"spec", "template"},
+	{Group: "apps", Kind: "StatefulSet"}: {"spec", "template"},
+	{Group: "apps", Kind: "DaemonSet"}:   {"spec", "template"},
+	{Group: "apps", Kind: "ReplicaSet"}:  {"spec", "template"},
+	{Group: "batch", Kind: "Job"}:        {"spec", "template"},
+	{Group: "batch", Kind: "CronJob"}:    {"spec", "jobTemplate", "spec", "template"},
+}
+
+// GetPodTemplatePath returns the field path of the pod template of workload
+// objects, the second value is false for kinds without a pod template.
+func GetPodTemplatePath(un *unstructured.Unstructured) ([]string, bool) {
+	path, ok := podTemplatePaths[un.GroupVersionKind().GroupKind()]
+	return path, ok
+}
+
+// SetContainerEnvs sets the environment variables of every container and init
+// container of a workload. Variables already declared with the same name are
+// replaced, objects without a pod template are left untouched.
+func SetContainerEnvs(un *unstructured.Unstructured, envs []corev1.EnvVar) error {
+	path, ok := GetPodTemplatePath(un)
+	if !ok || len(envs) == 0 {
+		return nil
+	}
+
+	names := map[string]bool{}
+	newEnvs := []interface{}{}
+	for _, env := range envs {
+		rawEnv, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&env)
+		if err != nil {
+			return err
+		}
+
+		names[env.Name] = true
+		newEnvs = append(newEnvs, rawEnv)
+	}
+
+	for _, field := range []string{"initContainers", "containers"} {
+		containersPath := append(append([]string{}, path...), "spec", field)
+		containers, found, err := unstructured.NestedSlice(un.Object, containersPath...)
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			continue
+		}
+
+		for i, rawContainer := range containers {
+			container, ok := rawContainer.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("invalid container %s[%d]", strings.Join(containersPath, "."), i)
+			}
+
+			currentEnvs, _, err := unstructured.NestedSlice(container, "env")
+			if err != nil {
+				return err
+			}
+
+			mergedEnvs := []interface{}{}
+			for _, rawEnv := range currentEnvs {
+				env, ok := rawEnv.(map[string]interface{})
+				if ok && names[fmt.Sprint(env["name"])] {
+					continue
+				}
+
+				mergedEnvs = append(mergedEnvs, rawEnv)
+			}
+
+			container["env"] = append(mergedEnvs, runtime.DeepCopyJSONValue(newEnvs).([]interface{})...)
+		}
+
+		if err := unstructured.SetNestedSlice(un.Object, containers, containersPath...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
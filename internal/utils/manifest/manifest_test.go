@@ -5,6 +5,9 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
 )
 
 type ManifestTestSuite struct {
@@ -89,6 +92,69 @@ spec:
 	assert.Contains(s.T(), "my-nginx", un[1])
 }
 
+func (s *ManifestTestSuite) TestSetContainerEnvs() {
+	cronJob := `
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: report
+spec:
+  schedule: "0 * * * *"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          initContainers:
+          - name: migrate
+            image: migrate
+          containers:
+          - name: report
+            image: report
+            env:
+            - name: API_URL
+              value: http://chart
+            - name: LOG_LEVEL
+              value: debug
+`
+	rawJSON, err := yaml.YAMLToJSON([]byte(cronJob))
+	assert.NoError(s.T(), err)
+	un, err := ToUnstructured(string(rawJSON))
+	assert.NoError(s.T(), err)
+
+	err = SetContainerEnvs(un, []corev1.EnvVar{
+		{Name: "API_URL", Value: "http://circle"},
+		{Name: "TOKEN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "api"},
+			Key:                  "token",
+		}}},
+	})
+	assert.NoError(s.T(), err)
+
+	podSpecPath := []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	initContainers, _, _ := unstructured.NestedSlice(un.Object, append(podSpecPath, "initContainers")...)
+	assert.Equal(s.T(), []interface{}{
+		map[string]interface{}{"name": "API_URL", "value": "http://circle"},
+		map[string]interface{}{"name": "TOKEN", "valueFrom": map[string]interface{}{
+			"secretKeyRef": map[string]interface{}{"name": "api", "key": "token"},
+		}},
+	}, initContainers[0].(map[string]interface{})["env"])
+
+	containers, _, _ := unstructured.NestedSlice(un.Object, append(podSpecPath, "containers")...)
+	envs := containers[0].(map[string]interface{})["env"].([]interface{})
+	assert.Equal(s.T(), 3, len(envs))
+	assert.Equal(s.T(), map[string]interface{}{"name": "LOG_LEVEL", "value": "debug"}, envs[0])
+	assert.Equal(s.T(), map[string]interface{}{"name": "API_URL", "value": "http://circle"}, envs[1])
+}
+
+func (s *ManifestTestSuite) TestSetContainerEnvsIgnoresObjectsWithoutPods() {
+	un, err := ToUnstructured(`{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "config"}}`)
+	assert.NoError(s.T(), err)
+
+	err = SetContainerEnvs(un, []corev1.EnvVar{{Name: "API_URL", Value: "http://circle"}})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]interface{}{"name": "config"}}, un.Object)
+}
+
 func TestManifestTestSuite(t *testing.T) {
 	suite.Run(t, new(ManifestTestSuite))
 }
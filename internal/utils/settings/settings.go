@@ -0,0 +1,30 @@
+package settings
+
+import (
+	"strings"
+
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// GetList splits a comma separated setting, ignoring empty items.
+func GetList(key string) []string {
+	list := []string{}
+	for _, item := range strings.Split(viper.GetString(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+// GetGroupKinds parses a comma separated setting of kinds as Kind.group.
+func GetGroupKinds(key string) []schema.GroupKind {
+	groupKinds := []schema.GroupKind{}
+	for _, item := range GetList(key) {
+		groupKinds = append(groupKinds, schema.ParseGroupKind(item))
+	}
+
+	return groupKinds
+}
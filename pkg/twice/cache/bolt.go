@@ -0,0 +1,254 @@
+package cache
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/octopipe/circlerr/pkg/twice/resource"
+	bolt "go.etcd.io/bbolt"
+)
+
+const defaultFlushInterval = 10 * time.Second
+
+var (
+	resourcesBucket        = []byte("resources")
+	resourceVersionsBucket = []byte("resourceVersions")
+)
+
+type boltCacheOpt func(b *boltCache)
+
+// boltCache serves reads from an in-memory cache and persists its changes to
+// a bbolt database on every flush interval. A flush writes the resources and
+// the resource versions in the same transaction, so the stored resource
+// versions are never ahead of the stored resources.
+type boltCache struct {
+	*localCache
+	db            *bolt.DB
+	flushInterval time.Duration
+
+	mu               sync.Mutex
+	dirty            map[string]bool
+	resourceVersions map[string]string
+	dirtyVersions    map[string]bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// WithFlushInterval sets how often changes are persisted, changes made since
+// the last flush are lost when the process dies.
+func WithFlushInterval(flushInterval time.Duration) boltCacheOpt {
+	return func(b *boltCache) {
+		b.flushInterval = flushInterval
+	}
+}
+
+// NewBoltCache opens the bbolt database at path, creating it when missing, and
+// loads the resources and resource versions it stored.
+func NewBoltCache(path string, opts ...boltCacheOpt) (PersistentCache, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	b := &boltCache{
+		localCache:       NewLocalCache().(*localCache),
+		db:               db,
+		flushInterval:    defaultFlushInterval,
+		dirty:            map[string]bool{},
+		resourceVersions: map[string]string{},
+		dirtyVersions:    map[string]bool{},
+		stop:             make(chan struct{}),
+		done:             make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	if err := b.load(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	go b.flushPeriodically()
+	return b, nil
+}
+
+func (b *boltCache) load() error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		resources, err := tx.CreateBucketIfNotExists(resourcesBucket)
+		if err != nil {
+			return err
+		}
+
+		resourceVersions, err := tx.CreateBucketIfNotExists(resourceVersionsBucket)
+		if err != nil {
+			return err
+		}
+
+		err = resources.ForEach(func(key, value []byte) error {
+			res := resource.Resource{}
+			if err := json.Unmarshal(value, &res); err != nil {
+				return err
+			}
+
+			b.localCache.Set(string(key), res)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return resourceVersions.ForEach(func(key, value []byte) error {
+			b.resourceVersions[string(key)] = string(value)
+			return nil
+		})
+	})
+}
+
+func (b *boltCache) Set(key string, res resource.Resource) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.localCache.Set(key, res)
+	b.dirty[key] = true
+}
+
+func (b *boltCache) Delete(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.localCache.Delete(key)
+	b.dirty[key] = true
+}
+
+func (b *boltCache) GetResourceVersion(key string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.resourceVersions[key]
+}
+
+func (b *boltCache) SetResourceVersion(key string, resourceVersion string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if resourceVersion == "" {
+		delete(b.resourceVersions, key)
+	} else {
+		b.resourceVersions[key] = resourceVersion
+	}
+
+	b.dirtyVersions[key] = true
+}
+
+func (b *boltCache) Close() error {
+	close(b.stop)
+	<-b.done
+
+	if err := b.flush(); err != nil {
+		b.db.Close()
+		return err
+	}
+
+	return b.db.Close()
+}
+
+func (b *boltCache) flushPeriodically() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			// Failed changes are flushed again with the next ones.
+			_ = b.flush()
+		}
+	}
+}
+
+// flush persists the resources and resource versions changed since the last
+// flush. They are read under the same lock Set and SetResourceVersion take, so
+// resource versions are never persisted without the changes they follow.
+func (b *boltCache) flush() error {
+	b.mu.Lock()
+	if len(b.dirty) == 0 && len(b.dirtyVersions) == 0 {
+		b.mu.Unlock()
+		return nil
+	}
+
+	resources := make(map[string][]byte, len(b.dirty))
+	for key := range b.dirty {
+		if !b.localCache.Has(key) {
+			resources[key] = nil
+			continue
+		}
+
+		value, err := json.Marshal(b.localCache.Get(key))
+		if err != nil {
+			b.mu.Unlock()
+			return err
+		}
+
+		resources[key] = value
+	}
+
+	resourceVersions := make(map[string]string, len(b.dirtyVersions))
+	for key := range b.dirtyVersions {
+		resourceVersions[key] = b.resourceVersions[key]
+	}
+
+	dirty, dirtyVersions := b.dirty, b.dirtyVersions
+	b.dirty, b.dirtyVersions = map[string]bool{}, map[string]bool{}
+	b.mu.Unlock()
+
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		resourcesBucket := tx.Bucket(resourcesBucket)
+		for key, value := range resources {
+			if err := putOrDelete(resourcesBucket, key, value); err != nil {
+				return err
+			}
+		}
+
+		resourceVersionsBucket := tx.Bucket(resourceVersionsBucket)
+		for key, resourceVersion := range resourceVersions {
+			if err := putOrDelete(resourceVersionsBucket, key, []byte(resourceVersion)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		b.restoreDirty(dirty, dirtyVersions)
+	}
+
+	return err
+}
+
+func (b *boltCache) restoreDirty(dirty map[string]bool, dirtyVersions map[string]bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for key := range dirty {
+		b.dirty[key] = true
+	}
+
+	for key := range dirtyVersions {
+		b.dirtyVersions[key] = true
+	}
+}
+
+func putOrDelete(bucket *bolt.Bucket, key string, value []byte) error {
+	if len(value) == 0 {
+		return bucket.Delete([]byte(key))
+	}
+
+	return bucket.Put([]byte(key), value)
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/octopipe/circlerr/pkg/twice/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type BoltCacheTestSuite struct {
+	suite.Suite
+
+	path  string
+	cache PersistentCache
+}
+
+func (s *BoltCacheTestSuite) SetupTest() {
+	s.path = filepath.Join(s.T().TempDir(), "cache.db")
+	s.cache = s.open()
+}
+
+func (s *BoltCacheTestSuite) TearDownTest() {
+	if s.cache != nil {
+		assert.NoError(s.T(), s.cache.Close())
+	}
+}
+
+func (s *BoltCacheTestSuite) open(opts ...boltCacheOpt) PersistentCache {
+	c, err := NewBoltCache(s.path, opts...)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	return c
+}
+
+func (s *BoltCacheTestSuite) reopen() {
+	assert.NoError(s.T(), s.cache.Close())
+	s.cache = s.open()
+}
+
+func (s *BoltCacheTestSuite) TestPersistsResourcesAndResourceVersions() {
+	res := newTestResource("Deployment", "default", "app")
+	res.Object = &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "app", "namespace": "default"},
+	}}
+	res.Health = health.Status{Status: health.HealthyStatus}
+	key := res.GetResourceIdentifier()
+	removed := newTestResource("Deployment", "default", "removed")
+
+	s.cache.Set(key, res)
+	s.cache.Set(removed.GetResourceIdentifier(), removed)
+	s.cache.Delete(removed.GetResourceIdentifier())
+	s.cache.SetResourceVersion("deployments", "1024")
+	s.reopen()
+
+	assert.Equal(s.T(), res, s.cache.Get(key))
+	assert.False(s.T(), s.cache.Has(removed.GetResourceIdentifier()))
+	assert.Equal(s.T(), "1024", s.cache.GetResourceVersion("deployments"))
+	assert.Len(s.T(), s.cache.ByIndex(NamespaceIndex, "default"), 1)
+}
+
+func (s *BoltCacheTestSuite) TestEmptyResourceVersionIsRemoved() {
+	s.cache.SetResourceVersion("deployments", "1024")
+	s.cache.SetResourceVersion("deployments", "")
+	s.reopen()
+
+	assert.Equal(s.T(), "", s.cache.GetResourceVersion("deployments"))
+}
+
+func (s *BoltCacheTestSuite) TestFlushesPeriodically() {
+	assert.NoError(s.T(), s.cache.Close())
+	s.cache = s.open(WithFlushInterval(10 * time.Millisecond))
+
+	res := newTestResource("Deployment", "default", "app")
+	s.cache.Set(res.GetResourceIdentifier(), res)
+	s.cache.SetResourceVersion("deployments", "1024")
+
+	assert.Eventually(s.T(), func() bool {
+		b := s.cache.(*boltCache)
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		return len(b.dirty) == 0 && len(b.dirtyVersions) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestBoltCacheTestSuite(t *testing.T) {
+	suite.Run(t, new(BoltCacheTestSuite))
+}
+
+func TestBoltCacheConformance(t *testing.T) {
+	suite.Run(t, &CacheConformanceTestSuite{newCache: func(t *testing.T) Cache {
+		c, err := NewBoltCache(filepath.Join(t.TempDir(), "cache.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return c
+	}})
+}
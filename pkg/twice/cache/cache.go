@@ -2,10 +2,58 @@ package cache
 
 import "github.com/octopipe/circlerr/pkg/twice/resource"
 
+const (
+	// NamespaceIndex indexes resources by namespace, cluster scoped resources
+	// are indexed by an empty namespace.
+	NamespaceIndex = "namespace"
+	// GVKIndex indexes resources by schema.GroupVersionKind.String().
+	GVKIndex = "gvk"
+)
+
+// Stats describes the content of a cache.
+type Stats struct {
+	// Resources is the number of cached resources.
+	Resources int
+	// Objects is the number of cached resources holding their object.
+	Objects int
+	// Bytes estimates the memory held by the cached resources.
+	Bytes int64
+	// ResourcesByGVK counts the cached resources by GVKIndex value.
+	ResourcesByGVK map[string]int
+}
+
+// IndexFunc returns the values a resource is indexed by.
+type IndexFunc func(res resource.Resource) []string
+
 type Cache interface {
 	Set(key string, resource resource.Resource)
 	List(filter func(res resource.Resource) bool) []string
 	Has(key string) bool
 	Get(key string) resource.Resource
 	Delete(key string)
+	// AddIndex registers or replaces an index, resources already cached are
+	// indexed right away.
+	AddIndex(name string, indexFunc IndexFunc)
+	// ByIndex returns the resources indexed by the value, sorted by key.
+	// Unknown indexes return no resources.
+	ByIndex(name string, value string) []resource.Resource
+	// Snapshot returns a copy of the cache that later writes don't change.
+	// Cached objects are shared, so they must not be mutated.
+	Snapshot() Cache
+	Stats() Stats
+}
+
+// PersistentCache is a Cache kept across restarts along with the resource
+// versions its resources were synced at, so watches can resume from them
+// instead of listing the resources again.
+type PersistentCache interface {
+	Cache
+	// GetResourceVersion returns the resource version stored for the key, it
+	// is empty for unknown keys.
+	GetResourceVersion(key string) string
+	// SetResourceVersion stores the resource version of the key, an empty
+	// resource version removes it.
+	SetResourceVersion(key string, resourceVersion string)
+	// Close persists the pending changes and releases the store.
+	Close() error
 }
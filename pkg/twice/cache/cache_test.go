@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/octopipe/circlerr/pkg/twice/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// CacheConformanceTestSuite checks the behavior every Cache implementation
+// must have, newCache returns an empty cache for each test.
+type CacheConformanceTestSuite struct {
+	suite.Suite
+
+	newCache func(t *testing.T) Cache
+	cache    Cache
+}
+
+func (s *CacheConformanceTestSuite) SetupTest() {
+	s.cache = s.newCache(s.T())
+}
+
+func (s *CacheConformanceTestSuite) TearDownTest() {
+	if persistentCache, ok := s.cache.(PersistentCache); ok {
+		assert.NoError(s.T(), persistentCache.Close())
+	}
+}
+
+func newTestResource(kind string, namespace string, name string) resource.Resource {
+	return resource.Resource{
+		Name:      name,
+		Group:     "apps",
+		Version:   "v1",
+		Kind:      kind,
+		Namespace: namespace,
+	}
+}
+
+func (s *CacheConformanceTestSuite) set(res resource.Resource) string {
+	key := res.GetResourceIdentifier()
+	s.cache.Set(key, res)
+	return key
+}
+
+func getNames(resources []resource.Resource) []string {
+	names := []string{}
+	for _, res := range resources {
+		names = append(names, res.Name)
+	}
+
+	return names
+}
+
+func (s *CacheConformanceTestSuite) TestSetGetDelete() {
+	key := s.set(newTestResource("Deployment", "default", "app"))
+
+	assert.True(s.T(), s.cache.Has(key))
+	assert.Equal(s.T(), "app", s.cache.Get(key).Name)
+
+	s.cache.Delete(key)
+	assert.False(s.T(), s.cache.Has(key))
+	assert.Equal(s.T(), resource.Resource{}, s.cache.Get(key))
+	assert.Empty(s.T(), s.cache.ByIndex(NamespaceIndex, "default"))
+}
+
+func (s *CacheConformanceTestSuite) TestByIndex() {
+	s.set(newTestResource("Deployment", "default", "b"))
+	s.set(newTestResource("Deployment", "default", "a"))
+	s.set(newTestResource("StatefulSet", "default", "c"))
+	s.set(newTestResource("Deployment", "other", "d"))
+
+	assert.Equal(s.T(), []string{"a", "b", "c"}, getNames(s.cache.ByIndex(NamespaceIndex, "default")))
+	assert.Equal(s.T(), []string{"a", "b", "d"}, getNames(s.cache.ByIndex(GVKIndex, "apps/v1, Kind=Deployment")))
+	assert.Empty(s.T(), s.cache.ByIndex(NamespaceIndex, "missing"))
+	assert.Empty(s.T(), s.cache.ByIndex("missing", "default"))
+}
+
+func (s *CacheConformanceTestSuite) TestSetReindexesOverwrittenResource() {
+	key := s.set(newTestResource("Deployment", "default", "app"))
+
+	moved := newTestResource("Deployment", "other", "app")
+	s.cache.Set(key, moved)
+
+	assert.Empty(s.T(), s.cache.ByIndex(NamespaceIndex, "default"))
+	assert.Equal(s.T(), []string{"app"}, getNames(s.cache.ByIndex(NamespaceIndex, "other")))
+}
+
+func (s *CacheConformanceTestSuite) TestAddIndexIndexesExistingResources() {
+	s.set(newTestResource("Deployment", "default", "app"))
+	s.set(newTestResource("Deployment", "default", "worker"))
+
+	s.cache.AddIndex("name", func(res resource.Resource) []string {
+		return []string{res.Name}
+	})
+	s.set(newTestResource("Deployment", "other", "app"))
+
+	assert.Len(s.T(), s.cache.ByIndex("name", "app"), 2)
+	assert.Len(s.T(), s.cache.ByIndex("name", "worker"), 1)
+}
+
+func (s *CacheConformanceTestSuite) TestSnapshotIsIsolated() {
+	key := s.set(newTestResource("Deployment", "default", "app"))
+
+	snapshot := s.cache.Snapshot()
+	s.cache.Delete(key)
+	s.set(newTestResource("Deployment", "default", "worker"))
+
+	assert.True(s.T(), snapshot.Has(key))
+	assert.Equal(s.T(), []string{"app"}, getNames(snapshot.ByIndex(NamespaceIndex, "default")))
+	assert.Equal(s.T(), []string{"worker"}, getNames(s.cache.ByIndex(NamespaceIndex, "default")))
+}
+
+func (s *CacheConformanceTestSuite) TestStats() {
+	withObject := newTestResource("Deployment", "default", "app")
+	withObject.Object = &unstructured.Unstructured{Object: map[string]interface{}{"kind": "Deployment"}}
+	key := s.set(withObject)
+	s.set(newTestResource("StatefulSet", "default", "db"))
+
+	stats := s.cache.Stats()
+	assert.Equal(s.T(), 2, stats.Resources)
+	assert.Equal(s.T(), 1, stats.Objects)
+	assert.Equal(s.T(), map[string]int{"apps/v1, Kind=Deployment": 1, "apps/v1, Kind=StatefulSet": 1}, stats.ResourcesByGVK)
+	assert.Greater(s.T(), stats.Bytes, int64(0))
+
+	s.cache.Set(key, newTestResource("Deployment", "default", "app"))
+	s.cache.Delete(newTestResource("StatefulSet", "default", "db").GetResourceIdentifier())
+
+	stats = s.cache.Stats()
+	assert.Equal(s.T(), 1, stats.Resources)
+	assert.Equal(s.T(), 0, stats.Objects)
+}
+
+func (s *CacheConformanceTestSuite) TestConcurrentAccess() {
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				namespace := fmt.Sprintf("ns-%d", j%4)
+				res := newTestResource("Deployment", namespace, fmt.Sprintf("app-%d-%d", i, j))
+				key := res.GetResourceIdentifier()
+
+				s.cache.Set(key, res)
+				s.cache.Get(key)
+				s.cache.ByIndex(NamespaceIndex, namespace)
+				s.cache.List(func(res resource.Resource) bool { return res.Namespace == namespace })
+				if j%10 == 0 {
+					s.cache.Snapshot()
+					s.cache.Stats()
+				}
+				if j%2 == 0 {
+					s.cache.Delete(key)
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	assert.Len(s.T(), s.cache.ByIndex(GVKIndex, "apps/v1, Kind=Deployment"), 8*100)
+}
+
+func TestLocalCacheConformance(t *testing.T) {
+	suite.Run(t, &CacheConformanceTestSuite{newCache: func(t *testing.T) Cache {
+		return NewLocalCache()
+	}})
+}
@@ -1,30 +1,60 @@
 package cache
 
 import (
+	"sort"
 	"sync"
 
 	"github.com/octopipe/circlerr/pkg/twice/resource"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
+// index maps an indexed value to the set of keys indexed by it.
+type index map[string]map[string]struct{}
+
 type localCache struct {
 	mu sync.RWMutex
 
-	cache map[string]resource.Resource
+	cache    map[string]resource.Resource
+	indexers map[string]IndexFunc
+	indices  map[string]index
+
+	objects int
+	bytes   int64
 }
 
 func NewLocalCache() Cache {
-	return &localCache{
-		cache: make(map[string]resource.Resource),
+	l := &localCache{
+		cache:    make(map[string]resource.Resource),
+		indexers: make(map[string]IndexFunc),
+		indices:  make(map[string]index),
 	}
+
+	l.AddIndex(NamespaceIndex, indexNamespace)
+	l.AddIndex(GVKIndex, indexGVK)
+	return l
+}
+
+func indexNamespace(res resource.Resource) []string {
+	return []string{res.Namespace}
+}
+
+func indexGVK(res resource.Resource) []string {
+	return []string{schema.GroupVersionKind{Group: res.Group, Version: res.Version, Kind: res.Kind}.String()}
 }
 
 // Has implements Cache
 func (l *localCache) Has(key string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	_, ok := l.cache[key]
 	return ok
 }
 
 func (l *localCache) Get(key string) resource.Resource {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	res, ok := l.cache[key]
 	if !ok {
 		return resource.Resource{}
@@ -37,12 +67,21 @@ func (l *localCache) Set(key string, resource resource.Resource) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	if old, ok := l.cache[key]; ok {
+		l.unindex(key, old)
+		l.uncount(old)
+	}
+
 	l.cache[key] = resource
+	l.index(key, resource)
+	l.count(resource)
 }
 
 func (l *localCache) List(filter func(res resource.Resource) bool) []string {
-	list := []string{}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
 
+	list := []string{}
 	for key := range l.cache {
 		if filter(l.cache[key]) {
 			list = append(list, key)
@@ -56,5 +95,175 @@ func (l *localCache) Delete(key string) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	if old, ok := l.cache[key]; ok {
+		l.unindex(key, old)
+		l.uncount(old)
+	}
+
 	delete(l.cache, key)
 }
+
+func (l *localCache) AddIndex(name string, indexFunc IndexFunc) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.indexers[name] = indexFunc
+	l.indices[name] = index{}
+	for key, res := range l.cache {
+		l.indices[name].add(key, indexFunc(res))
+	}
+}
+
+func (l *localCache) ByIndex(name string, value string) []resource.Resource {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	keys := make([]string, 0, len(l.indices[name][value]))
+	for key := range l.indices[name][value] {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	resources := make([]resource.Resource, 0, len(keys))
+	for _, key := range keys {
+		resources = append(resources, l.cache[key])
+	}
+
+	return resources
+}
+
+func (l *localCache) Snapshot() Cache {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	snapshot := &localCache{
+		cache:    make(map[string]resource.Resource, len(l.cache)),
+		indexers: make(map[string]IndexFunc, len(l.indexers)),
+		indices:  make(map[string]index, len(l.indices)),
+		objects:  l.objects,
+		bytes:    l.bytes,
+	}
+
+	for key, res := range l.cache {
+		snapshot.cache[key] = res
+	}
+
+	for name, indexFunc := range l.indexers {
+		snapshot.indexers[name] = indexFunc
+	}
+
+	for name, idx := range l.indices {
+		snapshot.indices[name] = idx.copy()
+	}
+
+	return snapshot
+}
+
+func (l *localCache) Stats() Stats {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	stats := Stats{
+		Resources:      len(l.cache),
+		Objects:        l.objects,
+		Bytes:          l.bytes,
+		ResourcesByGVK: make(map[string]int, len(l.indices[GVKIndex])),
+	}
+
+	for gvk, keys := range l.indices[GVKIndex] {
+		stats.ResourcesByGVK[gvk] = len(keys)
+	}
+
+	return stats
+}
+
+func (l *localCache) count(res resource.Resource) {
+	if res.Object != nil {
+		l.objects++
+	}
+
+	l.bytes += resourceSize(res)
+}
+
+func (l *localCache) uncount(res resource.Resource) {
+	if res.Object != nil {
+		l.objects--
+	}
+
+	l.bytes -= resourceSize(res)
+}
+
+// resourceSize estimates the bytes held by the resource from the length of its
+// strings, other values are counted as a word.
+func resourceSize(res resource.Resource) int64 {
+	size := int64(len(res.Name) + len(res.Group) + len(res.Kind) + len(res.Version) + len(res.ResourceName) + len(res.Namespace))
+	if res.Object != nil {
+		size += valueSize(res.Object.Object)
+	}
+
+	return size
+}
+
+func valueSize(value interface{}) int64 {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		size := int64(0)
+		for key, item := range v {
+			size += int64(len(key)) + valueSize(item)
+		}
+		return size
+	case []interface{}:
+		size := int64(0)
+		for _, item := range v {
+			size += valueSize(item)
+		}
+		return size
+	case string:
+		return int64(len(v))
+	default:
+		return 8
+	}
+}
+
+func (l *localCache) index(key string, res resource.Resource) {
+	for name, indexFunc := range l.indexers {
+		l.indices[name].add(key, indexFunc(res))
+	}
+}
+
+func (l *localCache) unindex(key string, res resource.Resource) {
+	for name, indexFunc := range l.indexers {
+		l.indices[name].remove(key, indexFunc(res))
+	}
+}
+
+func (i index) add(key string, values []string) {
+	for _, value := range values {
+		if _, ok := i[value]; !ok {
+			i[value] = map[string]struct{}{}
+		}
+
+		i[value][key] = struct{}{}
+	}
+}
+
+func (i index) remove(key string, values []string) {
+	for _, value := range values {
+		delete(i[value], key)
+		if len(i[value]) == 0 {
+			delete(i, value)
+		}
+	}
+}
+
+func (i index) copy() index {
+	c := make(index, len(i))
+	for value, keys := range i {
+		c[value] = make(map[string]struct{}, len(keys))
+		for key := range keys {
+			c[value][key] = struct{}{}
+		}
+	}
+
+	return c
+}
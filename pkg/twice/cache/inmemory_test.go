@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/octopipe/circlerr/pkg/twice/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type LocalCacheTestSuite struct {
+	suite.Suite
+
+	cache Cache
+}
+
+func (s *LocalCacheTestSuite) SetupTest() {
+	s.cache = NewLocalCache()
+}
+
+func (s *LocalCacheTestSuite) TestStatsBytes() {
+	res := newTestResource("Deployment", "default", "app")
+	key := res.GetResourceIdentifier()
+	s.cache.Set(key, res)
+	assert.Equal(s.T(), resourceSize(res), s.cache.Stats().Bytes)
+
+	withObject := res
+	withObject.Object = &unstructured.Unstructured{Object: map[string]interface{}{"kind": "Deployment"}}
+	s.cache.Set(key, withObject)
+	assert.Equal(s.T(), resourceSize(res)+int64(len("kind")+len("Deployment")), s.cache.Stats().Bytes)
+
+	s.cache.Delete(key)
+	assert.Equal(s.T(), int64(0), s.cache.Stats().Bytes)
+}
+
+func TestLocalCacheTestSuite(t *testing.T) {
+	suite.Run(t, new(LocalCacheTestSuite))
+}
+
+const benchmarkSize = 100000
+
+func newBenchmarkCache(b *testing.B) (Cache, []string) {
+	c := NewLocalCache()
+	keys := make([]string, 0, benchmarkSize)
+	for i := 0; i < benchmarkSize; i++ {
+		res := newTestResource("Deployment", fmt.Sprintf("ns-%d", i%100), fmt.Sprintf("app-%d", i))
+		key := res.GetResourceIdentifier()
+		c.Set(key, res)
+		keys = append(keys, key)
+	}
+
+	b.ResetTimer()
+	return c, keys
+}
+
+func BenchmarkLocalCacheSet(b *testing.B) {
+	c, keys := newBenchmarkCache(b)
+	for i := 0; i < b.N; i++ {
+		key := keys[i%benchmarkSize]
+		c.Set(key, c.Get(key))
+	}
+}
+
+func BenchmarkLocalCacheGet(b *testing.B) {
+	c, keys := newBenchmarkCache(b)
+	for i := 0; i < b.N; i++ {
+		c.Get(keys[i%benchmarkSize])
+	}
+}
+
+func BenchmarkLocalCacheByIndex(b *testing.B) {
+	c, _ := newBenchmarkCache(b)
+	for i := 0; i < b.N; i++ {
+		c.ByIndex(NamespaceIndex, fmt.Sprintf("ns-%d", i%100))
+	}
+}
+
+func BenchmarkLocalCacheList(b *testing.B) {
+	c, _ := newBenchmarkCache(b)
+	for i := 0; i < b.N; i++ {
+		namespace := fmt.Sprintf("ns-%d", i%100)
+		c.List(func(res resource.Resource) bool { return res.Namespace == namespace })
+	}
+}
+
+func BenchmarkLocalCacheSnapshot(b *testing.B) {
+	c, _ := newBenchmarkCache(b)
+	for i := 0; i < b.N; i++ {
+		c.Snapshot()
+	}
+}
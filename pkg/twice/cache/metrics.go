@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+)
+
+// RegisterMetrics reports the stats of the cache on every collection of the
+// meter.
+func RegisterMetrics(meter metric.Meter, c Cache) error {
+	resources, err := meter.Int64ObservableGauge(
+		"twice_cache_resources",
+		instrument.WithDescription("Number of cached resources by group, version and kind"),
+	)
+	if err != nil {
+		return err
+	}
+
+	objects, err := meter.Int64ObservableGauge(
+		"twice_cache_objects",
+		instrument.WithDescription("Number of cached resources holding their object"),
+	)
+	if err != nil {
+		return err
+	}
+
+	size, err := meter.Int64ObservableGauge(
+		"twice_cache_size",
+		instrument.WithDescription("Estimated memory held by the cached resources"),
+		instrument.WithUnit("By"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, observer metric.Observer) error {
+		stats := c.Stats()
+		for gvk, count := range stats.ResourcesByGVK {
+			observer.ObserveInt64(resources, int64(count), attribute.String("gvk", gvk))
+		}
+
+		observer.ObserveInt64(objects, int64(stats.Objects))
+		observer.ObserveInt64(size, stats.Bytes)
+		return nil
+	}, resources, objects, size)
+	return err
+}
@@ -0,0 +1,229 @@
+package health
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// podFailureReasons are the waiting reasons of containers that won't start
+// without a change to the pod or its image.
+var podFailureReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+func fromUnstructured(un *unstructured.Unstructured, obj interface{}) error {
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(un.Object, obj)
+}
+
+// checkDeployment follows the rollout status of kubectl, a deployment is
+// healthy once every replica runs the latest template and is available.
+func checkDeployment(un *unstructured.Unstructured) (Status, error) {
+	deployment := appsv1.Deployment{}
+	if err := fromUnstructured(un, &deployment); err != nil {
+		return Status{}, err
+	}
+
+	if deployment.Spec.Paused {
+		return Status{Status: ProgressingStatus, Message: "deployment is paused"}, nil
+	}
+
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		return Status{Status: ProgressingStatus, Message: "waiting for rollout spec update to be observed"}, nil
+	}
+
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+			return Status{Status: DegradedStatus, Message: fmt.Sprintf("deployment %q exceeded its progress deadline", deployment.Name)}, nil
+		}
+	}
+
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+
+	status := deployment.Status
+	switch {
+	case status.UpdatedReplicas < replicas:
+		return Status{Status: ProgressingStatus, Message: fmt.Sprintf("%d out of %d new replicas have been updated", status.UpdatedReplicas, replicas)}, nil
+	case status.Replicas > status.UpdatedReplicas:
+		return Status{Status: ProgressingStatus, Message: fmt.Sprintf("%d old replicas are pending termination", status.Replicas-status.UpdatedReplicas)}, nil
+	case status.AvailableReplicas < status.UpdatedReplicas:
+		return Status{Status: ProgressingStatus, Message: fmt.Sprintf("%d of %d updated replicas are available", status.AvailableReplicas, status.UpdatedReplicas)}, nil
+	}
+
+	return Status{Status: HealthyStatus}, nil
+}
+
+func checkStatefulSet(un *unstructured.Unstructured) (Status, error) {
+	statefulSet := appsv1.StatefulSet{}
+	if err := fromUnstructured(un, &statefulSet); err != nil {
+		return Status{}, err
+	}
+
+	if statefulSet.Generation > statefulSet.Status.ObservedGeneration {
+		return Status{Status: ProgressingStatus, Message: "waiting for statefulset spec update to be observed"}, nil
+	}
+
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+
+	status := statefulSet.Status
+	if status.ReadyReplicas < replicas {
+		return Status{Status: ProgressingStatus, Message: fmt.Sprintf("%d of %d replicas are ready", status.ReadyReplicas, replicas)}, nil
+	}
+
+	if statefulSet.Spec.UpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+		return Status{Status: HealthyStatus}, nil
+	}
+
+	rollingUpdate := statefulSet.Spec.UpdateStrategy.RollingUpdate
+	if rollingUpdate != nil && rollingUpdate.Partition != nil && *rollingUpdate.Partition > 0 {
+		expected := replicas - *rollingUpdate.Partition
+		if status.UpdatedReplicas < expected {
+			return Status{Status: ProgressingStatus, Message: fmt.Sprintf("%d of %d partitioned replicas have been updated", status.UpdatedReplicas, expected)}, nil
+		}
+
+		return Status{Status: HealthyStatus}, nil
+	}
+
+	if status.UpdateRevision != status.CurrentRevision {
+		return Status{Status: ProgressingStatus, Message: fmt.Sprintf("waiting for replicas to be updated to revision %s", status.UpdateRevision)}, nil
+	}
+
+	return Status{Status: HealthyStatus}, nil
+}
+
+func checkDaemonSet(un *unstructured.Unstructured) (Status, error) {
+	daemonSet := appsv1.DaemonSet{}
+	if err := fromUnstructured(un, &daemonSet); err != nil {
+		return Status{}, err
+	}
+
+	if daemonSet.Generation > daemonSet.Status.ObservedGeneration {
+		return Status{Status: ProgressingStatus, Message: "waiting for daemonset spec update to be observed"}, nil
+	}
+
+	status := daemonSet.Status
+	if daemonSet.Spec.UpdateStrategy.Type == appsv1.RollingUpdateDaemonSetStrategyType && status.UpdatedNumberScheduled < status.DesiredNumberScheduled {
+		return Status{Status: ProgressingStatus, Message: fmt.Sprintf("%d out of %d new pods have been updated", status.UpdatedNumberScheduled, status.DesiredNumberScheduled)}, nil
+	}
+
+	if status.NumberAvailable < status.DesiredNumberScheduled {
+		return Status{Status: ProgressingStatus, Message: fmt.Sprintf("%d of %d updated pods are available", status.NumberAvailable, status.DesiredNumberScheduled)}, nil
+	}
+
+	return Status{Status: HealthyStatus}, nil
+}
+
+func checkJob(un *unstructured.Unstructured) (Status, error) {
+	job := batchv1.Job{}
+	if err := fromUnstructured(un, &job); err != nil {
+		return Status{}, err
+	}
+
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+
+		switch condition.Type {
+		case batchv1.JobFailed:
+			return Status{Status: DegradedStatus, Message: condition.Message}, nil
+		case batchv1.JobComplete:
+			return Status{Status: HealthyStatus, Message: condition.Message}, nil
+		}
+	}
+
+	return Status{Status: ProgressingStatus, Message: "waiting for job to complete"}, nil
+}
+
+func checkPod(un *unstructured.Unstructured) (Status, error) {
+	pod := corev1.Pod{}
+	if err := fromUnstructured(un, &pod); err != nil {
+		return Status{}, err
+	}
+
+	switch pod.Status.Phase {
+	case corev1.PodSucceeded:
+		return Status{Status: HealthyStatus, Message: pod.Status.Message}, nil
+	case corev1.PodFailed:
+		return Status{Status: DegradedStatus, Message: pod.Status.Message}, nil
+	}
+
+	containerStatuses := append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...)
+	for _, containerStatus := range containerStatuses {
+		waiting := containerStatus.State.Waiting
+		if waiting != nil && podFailureReasons[waiting.Reason] {
+			return Status{Status: DegradedStatus, Message: fmt.Sprintf("container %q: %s", containerStatus.Name, waiting.Reason)}, nil
+		}
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
+			return Status{Status: HealthyStatus}, nil
+		}
+	}
+
+	return Status{Status: ProgressingStatus, Message: "waiting for pod to be ready"}, nil
+}
+
+func checkPersistentVolumeClaim(un *unstructured.Unstructured) (Status, error) {
+	pvc := corev1.PersistentVolumeClaim{}
+	if err := fromUnstructured(un, &pvc); err != nil {
+		return Status{}, err
+	}
+
+	switch pvc.Status.Phase {
+	case corev1.ClaimBound:
+		return Status{Status: HealthyStatus}, nil
+	case corev1.ClaimLost:
+		return Status{Status: DegradedStatus, Message: "claim lost its volume"}, nil
+	}
+
+	return Status{Status: ProgressingStatus, Message: "waiting for claim to be bound"}, nil
+}
+
+// checkService only waits for services of type LoadBalancer, which are
+// healthy once the load balancer got an address.
+func checkService(un *unstructured.Unstructured) (Status, error) {
+	serviceType, _, err := unstructured.NestedString(un.Object, "spec", "type")
+	if err != nil {
+		return Status{}, err
+	}
+
+	if serviceType != string(corev1.ServiceTypeLoadBalancer) {
+		return Status{Status: HealthyStatus}, nil
+	}
+
+	return checkLoadBalancerIngress(un, "waiting for load balancer address")
+}
+
+func checkIngress(un *unstructured.Unstructured) (Status, error) {
+	return checkLoadBalancerIngress(un, "waiting for ingress address")
+}
+
+func checkLoadBalancerIngress(un *unstructured.Unstructured, message string) (Status, error) {
+	ingress, _, err := unstructured.NestedSlice(un.Object, "status", "loadBalancer", "ingress")
+	if err != nil {
+		return Status{}, err
+	}
+
+	if len(ingress) == 0 {
+		return Status{Status: ProgressingStatus, Message: message}, nil
+	}
+
+	return Status{Status: HealthyStatus}, nil
+}
@@ -0,0 +1,107 @@
+package health
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	HealthyStatus     = "HEALTHY"
+	ProgressingStatus = "PROGRESSING"
+	DegradedStatus    = "DEGRADED"
+	MissingStatus     = "MISSING"
+)
+
+// statusSeverity orders the statuses from the best to the worst one.
+var statusSeverity = map[string]int{
+	HealthyStatus:     0,
+	ProgressingStatus: 1,
+	MissingStatus:     2,
+	DegradedStatus:    3,
+}
+
+type Status struct {
+	Status  string
+	Message string
+}
+
+// CheckFunc evaluates the health of a live object of the kind it was
+// registered for.
+type CheckFunc func(un *unstructured.Unstructured) (Status, error)
+
+type Checker interface {
+	// Register sets the check of a kind, replacing the built-in one.
+	Register(gk schema.GroupKind, check CheckFunc)
+	// Check evaluates a live object, nil objects are missing and objects of
+	// kinds without a check are healthy once they exist.
+	Check(un *unstructured.Unstructured) Status
+}
+
+type checker struct {
+	mu     sync.RWMutex
+	checks map[schema.GroupKind]CheckFunc
+}
+
+// NewChecker returns a checker with the checks of the built-in workloads,
+// services and ingresses.
+func NewChecker() Checker {
+	c := &checker{checks: map[schema.GroupKind]CheckFunc{}}
+	c.Register(schema.GroupKind{Group: "apps", Kind: "Deployment"}, checkDeployment)
+	c.Register(schema.GroupKind{Group: "apps", Kind: "StatefulSet"}, checkStatefulSet)
+	c.Register(schema.GroupKind{Group: "apps", Kind: "DaemonSet"}, checkDaemonSet)
+	c.Register(schema.GroupKind{Group: "batch", Kind: "Job"}, checkJob)
+	c.Register(schema.GroupKind{Kind: "Pod"}, checkPod)
+	c.Register(schema.GroupKind{Kind: "PersistentVolumeClaim"}, checkPersistentVolumeClaim)
+	c.Register(schema.GroupKind{Kind: "Service"}, checkService)
+	c.Register(schema.GroupKind{Group: "networking.k8s.io", Kind: "Ingress"}, checkIngress)
+	c.Register(schema.GroupKind{Group: "extensions", Kind: "Ingress"}, checkIngress)
+
+	return c
+}
+
+func (c *checker) Register(gk schema.GroupKind, check CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks[gk] = check
+}
+
+func (c *checker) Check(un *unstructured.Unstructured) Status {
+	if un == nil {
+		return Status{Status: MissingStatus, Message: "object not found"}
+	}
+
+	c.mu.RLock()
+	check, ok := c.checks[un.GroupVersionKind().GroupKind()]
+	c.mu.RUnlock()
+	if !ok {
+		return Status{Status: HealthyStatus}
+	}
+
+	status, err := check(un)
+	if err != nil {
+		return Status{Status: DegradedStatus, Message: fmt.Sprintf("failed to check health: %s", err)}
+	}
+
+	return status
+}
+
+// Aggregate returns the worst of the statuses, ignoring empty ones. No
+// statuses at all are healthy.
+func Aggregate(statuses []Status) Status {
+	aggregated := Status{Status: HealthyStatus}
+	for _, status := range statuses {
+		if status.Status == "" {
+			continue
+		}
+
+		if statusSeverity[status.Status] > statusSeverity[aggregated.Status] {
+			aggregated = status
+		}
+	}
+
+	return aggregated
+}
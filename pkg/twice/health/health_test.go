@@ -0,0 +1,246 @@
+package health
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+type HealthTestSuite struct {
+	suite.Suite
+	checker Checker
+}
+
+func (s *HealthTestSuite) SetupTest() {
+	s.checker = NewChecker()
+}
+
+func (s *HealthTestSuite) toUnstructured(manifest string) *unstructured.Unstructured {
+	un := &unstructured.Unstructured{}
+	assert.NoError(s.T(), yaml.Unmarshal([]byte(manifest), &un.Object))
+	return un
+}
+
+func (s *HealthTestSuite) TestDeployment() {
+	deployment := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: guestbook
+  generation: 2
+spec:
+  replicas: 3
+status:
+  observedGeneration: 2
+  replicas: 3
+  updatedReplicas: 3
+  availableReplicas: %s
+`
+	status := s.checker.Check(s.toUnstructured(fmt.Sprintf(deployment, "3")))
+	assert.Equal(s.T(), Status{Status: HealthyStatus}, status)
+
+	status = s.checker.Check(s.toUnstructured(fmt.Sprintf(deployment, "1")))
+	assert.Equal(s.T(), Status{Status: ProgressingStatus, Message: "1 of 3 updated replicas are available"}, status)
+}
+
+func (s *HealthTestSuite) TestDeploymentNotObserved() {
+	status := s.checker.Check(s.toUnstructured(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: guestbook
+  generation: 3
+status:
+  observedGeneration: 2
+`))
+	assert.Equal(s.T(), ProgressingStatus, status.Status)
+}
+
+func (s *HealthTestSuite) TestDeploymentProgressDeadlineExceeded() {
+	status := s.checker.Check(s.toUnstructured(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: guestbook
+status:
+  conditions:
+  - type: Progressing
+    status: "False"
+    reason: ProgressDeadlineExceeded
+`))
+	assert.Equal(s.T(), Status{Status: DegradedStatus, Message: `deployment "guestbook" exceeded its progress deadline`}, status)
+}
+
+func (s *HealthTestSuite) TestStatefulSet() {
+	statefulSet := `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: redis
+spec:
+  replicas: 2
+  updateStrategy:
+    type: RollingUpdate
+status:
+  readyReplicas: 2
+  currentRevision: redis-1
+  updateRevision: %s
+`
+	assert.Equal(s.T(), HealthyStatus, s.checker.Check(s.toUnstructured(fmt.Sprintf(statefulSet, "redis-1"))).Status)
+	assert.Equal(s.T(), ProgressingStatus, s.checker.Check(s.toUnstructured(fmt.Sprintf(statefulSet, "redis-2"))).Status)
+}
+
+func (s *HealthTestSuite) TestDaemonSet() {
+	daemonSet := `
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: fluentd
+spec:
+  updateStrategy:
+    type: RollingUpdate
+status:
+  desiredNumberScheduled: 3
+  updatedNumberScheduled: 3
+  numberAvailable: %s
+`
+	assert.Equal(s.T(), HealthyStatus, s.checker.Check(s.toUnstructured(fmt.Sprintf(daemonSet, "3"))).Status)
+	assert.Equal(s.T(), ProgressingStatus, s.checker.Check(s.toUnstructured(fmt.Sprintf(daemonSet, "2"))).Status)
+}
+
+func (s *HealthTestSuite) TestJob() {
+	job := `
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migration
+status:
+  conditions:
+  - type: %s
+    status: "True"
+    message: done
+`
+	assert.Equal(s.T(), Status{Status: HealthyStatus, Message: "done"}, s.checker.Check(s.toUnstructured(fmt.Sprintf(job, "Complete"))))
+	assert.Equal(s.T(), Status{Status: DegradedStatus, Message: "done"}, s.checker.Check(s.toUnstructured(fmt.Sprintf(job, "Failed"))))
+	assert.Equal(s.T(), ProgressingStatus, s.checker.Check(s.toUnstructured(fmt.Sprintf(job, "Suspended"))).Status)
+}
+
+func (s *HealthTestSuite) TestPod() {
+	pod := s.toUnstructured(`
+apiVersion: v1
+kind: Pod
+metadata:
+  name: guestbook
+status:
+  phase: Running
+  containerStatuses:
+  - name: guestbook
+    state:
+      waiting:
+        reason: CrashLoopBackOff
+`)
+	assert.Equal(s.T(), Status{Status: DegradedStatus, Message: `container "guestbook": CrashLoopBackOff`}, s.checker.Check(pod))
+
+	pod = s.toUnstructured(`
+apiVersion: v1
+kind: Pod
+metadata:
+  name: guestbook
+status:
+  phase: Running
+  conditions:
+  - type: Ready
+    status: "True"
+`)
+	assert.Equal(s.T(), HealthyStatus, s.checker.Check(pod).Status)
+}
+
+func (s *HealthTestSuite) TestPersistentVolumeClaim() {
+	pvc := `
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: data
+status:
+  phase: %s
+`
+	assert.Equal(s.T(), HealthyStatus, s.checker.Check(s.toUnstructured(fmt.Sprintf(pvc, "Bound"))).Status)
+	assert.Equal(s.T(), ProgressingStatus, s.checker.Check(s.toUnstructured(fmt.Sprintf(pvc, "Pending"))).Status)
+	assert.Equal(s.T(), DegradedStatus, s.checker.Check(s.toUnstructured(fmt.Sprintf(pvc, "Lost"))).Status)
+}
+
+func (s *HealthTestSuite) TestServiceAndIngress() {
+	service := s.toUnstructured(`
+apiVersion: v1
+kind: Service
+metadata:
+  name: guestbook
+spec:
+  type: LoadBalancer
+`)
+	assert.Equal(s.T(), ProgressingStatus, s.checker.Check(service).Status)
+
+	assert.NoError(s.T(), unstructured.SetNestedSlice(service.Object, []interface{}{map[string]interface{}{"ip": "10.0.0.1"}}, "status", "loadBalancer", "ingress"))
+	assert.Equal(s.T(), HealthyStatus, s.checker.Check(service).Status)
+
+	unstructured.RemoveNestedField(service.Object, "status")
+	assert.NoError(s.T(), unstructured.SetNestedField(service.Object, "ClusterIP", "spec", "type"))
+	assert.Equal(s.T(), HealthyStatus, s.checker.Check(service).Status)
+
+	ingress := s.toUnstructured(`
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: guestbook
+`)
+	assert.Equal(s.T(), Status{Status: ProgressingStatus, Message: "waiting for ingress address"}, s.checker.Check(ingress))
+}
+
+func (s *HealthTestSuite) TestRegister() {
+	rollout := s.toUnstructured(`
+apiVersion: argoproj.io/v1alpha1
+kind: Rollout
+metadata:
+  name: guestbook
+status:
+  phase: Degraded
+`)
+	assert.Equal(s.T(), HealthyStatus, s.checker.Check(rollout).Status)
+
+	s.checker.Register(schema.GroupKind{Group: "argoproj.io", Kind: "Rollout"}, func(un *unstructured.Unstructured) (Status, error) {
+		phase, _, err := unstructured.NestedString(un.Object, "status", "phase")
+		if phase == "Degraded" {
+			return Status{Status: DegradedStatus, Message: "rollout aborted"}, err
+		}
+
+		return Status{Status: HealthyStatus}, err
+	})
+	assert.Equal(s.T(), Status{Status: DegradedStatus, Message: "rollout aborted"}, s.checker.Check(rollout))
+}
+
+func (s *HealthTestSuite) TestMissing() {
+	assert.Equal(s.T(), MissingStatus, s.checker.Check(nil).Status)
+}
+
+func (s *HealthTestSuite) TestAggregate() {
+	assert.Equal(s.T(), Status{Status: HealthyStatus}, Aggregate(nil))
+	assert.Equal(s.T(), Status{Status: DegradedStatus, Message: "job failed"}, Aggregate([]Status{
+		{Status: HealthyStatus},
+		{Status: DegradedStatus, Message: "job failed"},
+		{Status: ProgressingStatus, Message: "rolling out"},
+		{},
+	}))
+	assert.Equal(s.T(), Status{Status: ProgressingStatus, Message: "rolling out"}, Aggregate([]Status{
+		{Status: HealthyStatus},
+		{Status: ProgressingStatus, Message: "rolling out"},
+	}))
+}
+
+func TestHealthTestSuite(t *testing.T) {
+	suite.Run(t, new(HealthTestSuite))
+}
@@ -0,0 +1,155 @@
+package reconciler
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/octopipe/circlerr/pkg/twice/resource"
+	"github.com/pmezard/go-difflib/difflib"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	redactedValue        = "********"
+	redactedChangedValue = "******** (changed)"
+)
+
+// getDiff returns the unified YAML diff between the live and the target object
+// of a resource, a nil object is rendered as empty. Fields written by the API
+// server are masked and Secret data is redacted, only showing which keys change.
+func getDiff(res resource.Resource, live *unstructured.Unstructured, target *unstructured.Unstructured) ([]string, error) {
+	liveObject := maskObject(live)
+	targetObject := maskObject(target)
+	if res.Group == "" && res.Kind == "Secret" {
+		redactSecretData(liveObject, targetObject)
+	}
+
+	liveYAML, err := toYAML(liveObject)
+	if err != nil {
+		return nil, err
+	}
+
+	targetYAML, err := toYAML(targetObject)
+	if err != nil {
+		return nil, err
+	}
+
+	path := fmt.Sprintf("%s/%s/%s", res.Kind, res.Namespace, res.Name)
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(liveYAML),
+		B:        splitLines(targetYAML),
+		FromFile: fmt.Sprintf("live/%s", path),
+		ToFile:   fmt.Sprintf("target/%s", path),
+		Context:  3,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if diff == "" {
+		return []string{}, nil
+	}
+
+	return strings.Split(strings.TrimSuffix(diff, "\n"), "\n"), nil
+}
+
+func maskObject(un *unstructured.Unstructured) map[string]interface{} {
+	if un == nil {
+		return nil
+	}
+
+	obj := normalizeObject(un)
+	annotations, _, _ := unstructured.NestedStringMap(obj, "metadata", "annotations")
+	delete(annotations, LastAppliedConfigurationAnnotation)
+	delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+	if len(annotations) > 0 {
+		_ = unstructured.SetNestedStringMap(obj, annotations, "metadata", "annotations")
+	} else {
+		unstructured.RemoveNestedField(obj, "metadata", "annotations")
+	}
+
+	return obj
+}
+
+// redactSecretData replaces the values of both secrets, keys with a different
+// value in the target get a distinct placeholder so the change stays visible.
+func redactSecretData(live map[string]interface{}, target map[string]interface{}) {
+	liveData := getSecretData(live)
+	targetData := getSecretData(target)
+
+	for key, value := range liveData {
+		liveData[key] = redactedValue
+		targetValue, ok := targetData[key]
+		if ok && targetValue != value {
+			targetData[key] = redactedChangedValue
+		}
+	}
+
+	for key, value := range targetData {
+		if value != redactedChangedValue {
+			targetData[key] = redactedValue
+		}
+	}
+
+	setSecretData(live, liveData)
+	setSecretData(target, targetData)
+}
+
+// getSecretData returns the encoded data of a secret, merging stringData the
+// same way the API server does when the secret is written.
+func getSecretData(obj map[string]interface{}) map[string]string {
+	if obj == nil {
+		return map[string]string{}
+	}
+
+	data, _, _ := unstructured.NestedStringMap(obj, "data")
+	if data == nil {
+		data = map[string]string{}
+	}
+
+	stringData, _, _ := unstructured.NestedStringMap(obj, "stringData")
+	for key, value := range stringData {
+		data[key] = base64.StdEncoding.EncodeToString([]byte(value))
+	}
+
+	return data
+}
+
+func setSecretData(obj map[string]interface{}, data map[string]string) {
+	if obj == nil {
+		return
+	}
+
+	unstructured.RemoveNestedField(obj, "stringData")
+	if len(data) > 0 {
+		_ = unstructured.SetNestedStringMap(obj, data, "data")
+	}
+}
+
+func toYAML(obj map[string]interface{}) (string, error) {
+	if obj == nil {
+		return "", nil
+	}
+
+	out, err := yaml.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
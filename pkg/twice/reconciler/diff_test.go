@@ -0,0 +1,117 @@
+package reconciler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/octopipe/circlerr/pkg/twice/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type DiffTestSuite struct {
+	suite.Suite
+	live *unstructured.Unstructured
+}
+
+func (s *DiffTestSuite) SetupTest() {
+	s.live = &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":            "guestbook",
+			"namespace":       "default",
+			"resourceVersion": "1024",
+			"generation":      int64(3),
+			"annotations": map[string]interface{}{
+				LastAppliedConfigurationAnnotation: "{}",
+			},
+			"managedFields": []interface{}{
+				map[string]interface{}{"manager": "circlerr", "operation": "Apply"},
+			},
+		},
+		"spec": map[string]interface{}{
+			"replicas": int64(1),
+		},
+		"status": map[string]interface{}{
+			"readyReplicas": int64(1),
+		},
+	}}
+}
+
+func (s *DiffTestSuite) newResource(un *unstructured.Unstructured) resource.Resource {
+	return resource.NewResourceByUnstructured(*un, "default", "deployments", true)
+}
+
+func (s *DiffTestSuite) TestGetDiff() {
+	target := s.live.DeepCopy()
+	assert.NoError(s.T(), unstructured.SetNestedField(target.Object, int64(3), "spec", "replicas"))
+	target.SetResourceVersion("2048")
+	unstructured.RemoveNestedField(target.Object, "status")
+
+	diff, err := getDiff(s.newResource(target), s.live, target)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "--- live/Deployment/default/guestbook", diff[0])
+	assert.Equal(s.T(), "+++ target/Deployment/default/guestbook", diff[1])
+	assert.Contains(s.T(), diff, "-  replicas: 1")
+	assert.Contains(s.T(), diff, "+  replicas: 3")
+
+	text := strings.Join(diff, "\n")
+	for _, masked := range []string{"status", "managedFields", "resourceVersion", "generation", LastAppliedConfigurationAnnotation} {
+		assert.NotContains(s.T(), text, masked)
+	}
+}
+
+func (s *DiffTestSuite) TestGetDiffUnchanged() {
+	target := s.live.DeepCopy()
+	target.SetResourceVersion("2048")
+
+	diff, err := getDiff(s.newResource(target), s.live, target)
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), diff)
+}
+
+func (s *DiffTestSuite) TestGetDiffCreate() {
+	diff, err := getDiff(s.newResource(s.live), nil, s.live)
+	assert.NoError(s.T(), err)
+	assert.Contains(s.T(), diff, "+kind: Deployment")
+	for _, line := range diff[3:] {
+		assert.True(s.T(), strings.HasPrefix(line, "+"), line)
+	}
+}
+
+func (s *DiffTestSuite) TestGetDiffSecret() {
+	live := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "guestbook", "namespace": "default"},
+		"data": map[string]interface{}{
+			"username": "YWRtaW4=",
+			"password": "c2VjcmV0",
+		},
+	}}
+	target := live.DeepCopy()
+	unstructured.RemoveNestedField(target.Object, "data")
+	assert.NoError(s.T(), unstructured.SetNestedStringMap(target.Object, map[string]string{
+		"username": "admin",
+		"password": "changed",
+		"token":    "abc",
+	}, "stringData"))
+
+	diff, err := getDiff(resource.NewResourceByUnstructured(*target, "default", "secrets", true), live, target)
+	assert.NoError(s.T(), err)
+	assert.Contains(s.T(), diff, "-  password: '********'")
+	assert.Contains(s.T(), diff, "+  password: '******** (changed)'")
+	assert.Contains(s.T(), diff, "+  token: '********'")
+	assert.Contains(s.T(), diff, "   username: '********'")
+
+	text := strings.Join(diff, "\n")
+	for _, value := range []string{"YWRtaW4=", "c2VjcmV0", "admin", "changed\n", "abc", "stringData"} {
+		assert.NotContains(s.T(), text, value)
+	}
+}
+
+func TestDiffTestSuite(t *testing.T) {
+	suite.Run(t, new(DiffTestSuite))
+}
@@ -0,0 +1,375 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/octopipe/circlerr/pkg/twice/cache"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+)
+
+var crdGroupKind = schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}
+
+// discoveredResource is a resource served by the cluster that is cached.
+type discoveredResource struct {
+	gvk         schema.GroupVersionKind
+	apiResource v1.APIResource
+}
+
+type cachedResource struct {
+	gvk    schema.GroupVersionKind
+	cancel context.CancelFunc
+}
+
+// watchKey identifies the watch of a resource in a namespace, or in all of
+// them.
+type watchKey struct {
+	resource  schema.GroupVersionResource
+	namespace string
+}
+
+func (k watchKey) String() string {
+	return fmt.Sprintf("%s;namespace=%s", k.resource.String(), k.namespace)
+}
+
+// cachedResources tracks the resources being cached, so discovery refreshes
+// only start and stop the ones that changed, and the state of their watches.
+type cachedResources struct {
+	mu        sync.Mutex
+	resources map[schema.GroupVersionResource]cachedResource
+	stopped   map[schema.GroupVersionResource]bool
+	// staleSince is zero for watches in sync.
+	staleSince map[watchKey]time.Time
+	refresh    chan struct{}
+
+	preloaded  bool
+	isManaged  isManagedFunc
+	liveUpdate bool
+}
+
+func newCachedResources() *cachedResources {
+	return &cachedResources{
+		resources:  map[schema.GroupVersionResource]cachedResource{},
+		stopped:    map[schema.GroupVersionResource]bool{},
+		staleSince: map[watchKey]time.Time{},
+		refresh:    make(chan struct{}, 1),
+	}
+}
+
+func (c *cachedResources) setPreload(isManaged isManagedFunc, liveUpdate bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.preloaded = true
+	c.isManaged = isManaged
+	c.liveUpdate = liveUpdate
+}
+
+func (c *cachedResources) getPreload() (isManagedFunc, bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.isManaged, c.liveUpdate, c.preloaded
+}
+
+func (c *cachedResources) has(gvr schema.GroupVersionResource) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.resources[gvr]
+	return ok
+}
+
+func (c *cachedResources) isStopped(gvr schema.GroupVersionResource) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stopped[gvr]
+}
+
+func (c *cachedResources) add(gvr schema.GroupVersionResource, res cachedResource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.resources[gvr] = res
+}
+
+// stop removes the resource and keeps discovery refreshes from caching it
+// again until it is started.
+func (c *cachedResources) stop(gvr schema.GroupVersionResource) (cachedResource, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stopped[gvr] = true
+	res, ok := c.resources[gvr]
+	delete(c.resources, gvr)
+	return res, ok
+}
+
+func (c *cachedResources) start(gvr schema.GroupVersionResource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.stopped, gvr)
+}
+
+func (c *cachedResources) setSynced(key watchKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.staleSince[key] = time.Time{}
+}
+
+// setStale marks the watch stale, keeping the time it first became stale.
+func (c *cachedResources) setStale(key watchKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if staleSince, ok := c.staleSince[key]; !ok || staleSince.IsZero() {
+		c.staleSince[key] = time.Now()
+	}
+}
+
+func (c *cachedResources) removeWatch(key watchKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.staleSince, key)
+}
+
+// staleness returns how long each watch has been stale, watches in sync have
+// no staleness.
+func (c *cachedResources) staleness(now time.Time) map[watchKey]time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	staleness := make(map[watchKey]time.Duration, len(c.staleSince))
+	for key, staleSince := range c.staleSince {
+		staleness[key] = 0
+		if !staleSince.IsZero() {
+			staleness[key] = now.Sub(staleSince)
+		}
+	}
+
+	return staleness
+}
+
+// removeStale removes the cached resources no longer discovered, except the
+// ones of group versions that failed discovery.
+func (c *cachedResources) removeStale(discovered map[schema.GroupVersionResource]discoveredResource, failed map[schema.GroupVersion]bool) map[schema.GroupVersionResource]cachedResource {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stale := map[schema.GroupVersionResource]cachedResource{}
+	for gvr, res := range c.resources {
+		if _, ok := discovered[gvr]; ok || failed[gvr.GroupVersion()] {
+			continue
+		}
+
+		stale[gvr] = res
+		delete(c.resources, gvr)
+	}
+
+	return stale
+}
+
+// requestRefresh asks for a discovery refresh without waiting for it, requests
+// made while a refresh is pending are merged.
+func (c *cachedResources) requestRefresh() {
+	select {
+	case c.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// discoverResources lists the preferred resources that can be cached. Group
+// versions failing discovery, like aggregated APIs that are down, are logged
+// and returned apart instead of failing the discovery.
+func (r reconciler) discoverResources() (map[schema.GroupVersionResource]discoveredResource, map[schema.GroupVersion]bool, error) {
+	failed := map[schema.GroupVersion]bool{}
+	apiResourceLists, err := r.discoveryClient.ServerPreferredResources()
+	if err != nil {
+		groupErr := &discovery.ErrGroupDiscoveryFailed{}
+		if !errors.As(err, &groupErr) {
+			return nil, nil, err
+		}
+
+		for gv, gvErr := range groupErr.Groups {
+			r.logger.Error(gvErr, "failed to discover group version", "groupVersion", gv.String())
+			failed[gv] = true
+		}
+	}
+
+	resources := map[schema.GroupVersionResource]discoveredResource{}
+	for _, resourceList := range apiResourceLists {
+		gv, err := schema.ParseGroupVersion(resourceList.GroupVersion)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, apiResource := range resourceList.APIResources {
+			if _, ok := ignoredResources[apiResource.Name]; ok || !isSupportedVerb(apiResource.Verbs) {
+				continue
+			}
+
+			gvk := gv.WithKind(apiResource.Kind)
+			if len(r.preloadGroupKinds) > 0 && !r.preloadGroupKinds[gvk.GroupKind()] {
+				continue
+			}
+
+			resources[gv.WithResource(apiResource.Name)] = discoveredResource{gvk: gvk, apiResource: apiResource}
+		}
+	}
+
+	return resources, failed, nil
+}
+
+// syncResources refreshes discovery, starts caching the resources discovered
+// since the last sync and stops caching the ones no longer served. Resources
+// failing to list are logged and retried by the next sync.
+func (r reconciler) syncResources(ctx context.Context) error {
+	r.discoveryClient.Invalidate()
+	resources, failed, err := r.discoverResources()
+	if err != nil {
+		return err
+	}
+
+	for gvr, res := range r.cachedResources.removeStale(resources, failed) {
+		r.dropResource(gvr, res)
+	}
+
+	r.pruneCache(resources, failed)
+
+	wg := sync.WaitGroup{}
+	for gvr, res := range resources {
+		if r.cachedResources.has(gvr) || r.cachedResources.isStopped(gvr) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(gvr schema.GroupVersionResource, res discoveredResource) {
+			defer wg.Done()
+
+			if err := r.startResource(ctx, gvr, res); err != nil {
+				r.logger.Error(err, "failed to cache resource", "resource", gvr.String())
+			}
+		}(gvr, res)
+	}
+
+	wg.Wait()
+	return nil
+}
+
+func (r reconciler) startResource(ctx context.Context, gvr schema.GroupVersionResource, res discoveredResource) error {
+	isManaged, liveUpdate, _ := r.cachedResources.getPreload()
+	resourceCtx, cancel := context.WithCancel(ctx)
+	if err := r.syncCache(resourceCtx, res.gvk, res.apiResource, liveUpdate, isManaged); err != nil {
+		cancel()
+		return err
+	}
+
+	r.cachedResources.add(gvr, cachedResource{gvk: res.gvk, cancel: cancel})
+	return nil
+}
+
+// dropResource stops the watches of the resource and removes its objects and
+// resource versions from the cache.
+func (r reconciler) dropResource(gvr schema.GroupVersionResource, res cachedResource) {
+	res.cancel()
+	for _, cached := range r.cache.ByIndex(cache.GVKIndex, res.gvk.String()) {
+		r.cache.Delete(cached.GetResourceIdentifier())
+	}
+
+	for _, namespace := range append([]string{v1.NamespaceAll}, r.preloadNamespaces...) {
+		r.saveResourceVersion(watchKey{resource: gvr, namespace: namespace}, "")
+	}
+}
+
+// pruneCache removes the objects of kinds that are not discovered anymore, like
+// the ones a persistent cache loaded from a previous run. Kinds of group
+// versions that failed discovery are kept.
+func (r reconciler) pruneCache(discovered map[schema.GroupVersionResource]discoveredResource, failed map[schema.GroupVersion]bool) {
+	kept := map[string]bool{}
+	for _, res := range discovered {
+		kept[res.gvk.String()] = true
+	}
+
+	for gvk := range r.cache.Stats().ResourcesByGVK {
+		if kept[gvk] || isFailedGVK(gvk, failed) {
+			continue
+		}
+
+		for _, cached := range r.cache.ByIndex(cache.GVKIndex, gvk) {
+			r.cache.Delete(cached.GetResourceIdentifier())
+		}
+	}
+}
+
+func isFailedGVK(gvk string, failed map[schema.GroupVersion]bool) bool {
+	for gv := range failed {
+		if strings.HasPrefix(gvk, gv.WithKind("").String()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StartResource caches a resource stopped before, or not preloaded yet. The
+// watches of the resource live until ctx is done.
+func (r reconciler) StartResource(ctx context.Context, gvr schema.GroupVersionResource) error {
+	if _, _, preloaded := r.cachedResources.getPreload(); !preloaded {
+		return errors.New("resources were not preloaded")
+	}
+
+	r.cachedResources.start(gvr)
+	if r.cachedResources.has(gvr) {
+		return nil
+	}
+
+	resources, _, err := r.discoverResources()
+	if err != nil {
+		return err
+	}
+
+	res, ok := resources[gvr]
+	if !ok {
+		return fmt.Errorf("resource %s is not served", gvr.String())
+	}
+
+	return r.startResource(ctx, gvr, res)
+}
+
+// StopResource stops the watches of the resource and removes its objects from
+// the cache, discovery refreshes don't cache it again until it is started.
+func (r reconciler) StopResource(gvr schema.GroupVersionResource) {
+	if res, ok := r.cachedResources.stop(gvr); ok {
+		r.dropResource(gvr, res)
+	}
+}
+
+// refreshDiscovery syncs the cached resources on every interval, and when a
+// refresh is requested by a change of a CRD or a lookup of an unknown kind.
+func (r reconciler) refreshDiscovery(ctx context.Context) {
+	ticker := time.NewTicker(r.discoveryRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.cachedResources.refresh:
+		}
+
+		if err := r.syncResources(ctx); err != nil {
+			r.logger.Error(err, "failed to refresh discovery")
+		}
+	}
+}
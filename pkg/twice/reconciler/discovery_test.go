@@ -0,0 +1,172 @@
+package reconciler
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/octopipe/circlerr/pkg/twice/cache"
+	"github.com/octopipe/circlerr/pkg/twice/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+type fakeCachedDiscovery struct {
+	*fake.FakeDiscovery
+	err error
+}
+
+func (d fakeCachedDiscovery) ServerPreferredResources() ([]*v1.APIResourceList, error) {
+	return d.Resources, d.err
+}
+
+func (d fakeCachedDiscovery) Fresh() bool {
+	return true
+}
+
+func (d fakeCachedDiscovery) Invalidate() {}
+
+type DiscoveryTestSuite struct {
+	suite.Suite
+	discoveryClient fakeCachedDiscovery
+	reconciler      reconciler
+}
+
+func (s *DiscoveryTestSuite) SetupTest() {
+	verbs := v1.Verbs{"get", "list", "watch"}
+	s.discoveryClient = fakeCachedDiscovery{FakeDiscovery: &fake.FakeDiscovery{Fake: &clienttesting.Fake{
+		Resources: []*v1.APIResourceList{
+			{
+				GroupVersion: "v1",
+				APIResources: []v1.APIResource{
+					{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: verbs},
+					{Name: "events", Kind: "Event", Namespaced: true, Verbs: verbs},
+					{Name: "bindings", Kind: "Binding", Namespaced: true, Verbs: v1.Verbs{"create"}},
+				},
+			},
+			{
+				GroupVersion: "apps/v1",
+				APIResources: []v1.APIResource{
+					{Name: "deployments", Kind: "Deployment", Namespaced: true, Verbs: verbs},
+				},
+			},
+		},
+	}}}
+
+	s.reconciler = reconciler{
+		logger:            logr.Discard(),
+		cache:             cache.NewLocalCache(),
+		discoveryClient:   s.discoveryClient,
+		preloadGroupKinds: map[schema.GroupKind]bool{},
+		cachedResources:   newCachedResources(),
+	}
+}
+
+func (s *DiscoveryTestSuite) TestDiscoverResources() {
+	resources, failed, err := s.reconciler.discoverResources()
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), failed)
+	assert.Len(s.T(), resources, 2)
+	assert.Equal(s.T(), "ConfigMap", resources[schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}].gvk.Kind)
+	assert.Equal(s.T(), "apps", resources[schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}].gvk.Group)
+}
+
+func (s *DiscoveryTestSuite) TestDiscoverResourcesOfPreloadGroupKinds() {
+	s.reconciler.preloadGroupKinds[schema.GroupKind{Group: "apps", Kind: "Deployment"}] = true
+
+	resources, _, err := s.reconciler.discoverResources()
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), resources, 1)
+	assert.Contains(s.T(), resources, schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"})
+}
+
+func (s *DiscoveryTestSuite) TestDiscoverResourcesWithFailedGroups() {
+	metricsGV := schema.GroupVersion{Group: "metrics.k8s.io", Version: "v1beta1"}
+	s.discoveryClient.err = &discovery.ErrGroupDiscoveryFailed{
+		Groups: map[schema.GroupVersion]error{metricsGV: errors.New("service unavailable")},
+	}
+	s.reconciler.discoveryClient = s.discoveryClient
+
+	resources, failed, err := s.reconciler.discoverResources()
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), resources, 2)
+	assert.Equal(s.T(), map[schema.GroupVersion]bool{metricsGV: true}, failed)
+}
+
+func (s *DiscoveryTestSuite) TestDiscoverResourcesFailure() {
+	s.discoveryClient.err = errors.New("connection refused")
+	s.reconciler.discoveryClient = s.discoveryClient
+
+	_, _, err := s.reconciler.discoverResources()
+	assert.EqualError(s.T(), err, "connection refused")
+}
+
+func (s *DiscoveryTestSuite) TestRemoveStale() {
+	configMaps := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	widgets := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	metrics := schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"}
+	for _, gvr := range []schema.GroupVersionResource{configMaps, widgets, metrics} {
+		s.reconciler.cachedResources.add(gvr, cachedResource{gvk: gvr.GroupVersion().WithKind(gvr.Resource)})
+	}
+
+	stale := s.reconciler.cachedResources.removeStale(
+		map[schema.GroupVersionResource]discoveredResource{configMaps: {}},
+		map[schema.GroupVersion]bool{metrics.GroupVersion(): true},
+	)
+
+	assert.Len(s.T(), stale, 1)
+	assert.Equal(s.T(), "example.com", stale[widgets].gvk.Group)
+	assert.True(s.T(), s.reconciler.cachedResources.has(configMaps))
+	assert.True(s.T(), s.reconciler.cachedResources.has(metrics))
+	assert.False(s.T(), s.reconciler.cachedResources.has(widgets))
+}
+
+func (s *DiscoveryTestSuite) TestPruneCache() {
+	configMaps := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	metricsGV := schema.GroupVersion{Group: "metrics.k8s.io", Version: "v1beta1"}
+	for _, res := range []resource.Resource{
+		{Name: "guestbook", Version: "v1", Kind: "ConfigMap"},
+		{Name: "widget", Group: "example.com", Version: "v1", Kind: "Widget"},
+		{Name: "pod", Group: "metrics.k8s.io", Version: "v1beta1", Kind: "PodMetrics"},
+	} {
+		s.reconciler.cache.Set(res.GetResourceIdentifier(), res)
+	}
+
+	s.reconciler.pruneCache(
+		map[schema.GroupVersionResource]discoveredResource{configMaps: {gvk: configMaps.GroupVersion().WithKind("ConfigMap")}},
+		map[schema.GroupVersion]bool{metricsGV: true},
+	)
+
+	assert.Equal(s.T(), map[string]int{
+		"/v1, Kind=ConfigMap":                     1,
+		"metrics.k8s.io/v1beta1, Kind=PodMetrics": 1,
+	}, s.reconciler.cache.Stats().ResourcesByGVK)
+}
+
+func (s *DiscoveryTestSuite) TestRequestRefreshIsMerged() {
+	s.reconciler.cachedResources.requestRefresh()
+	s.reconciler.cachedResources.requestRefresh()
+
+	assert.Len(s.T(), s.reconciler.cachedResources.refresh, 1)
+}
+
+func (s *DiscoveryTestSuite) TestUnknownKindRequestsRefresh() {
+	planner := NewPlanner(nil, s.discoveryClient, withUnknownKindHook(s.reconciler.cachedResources.requestRefresh)).(plannerContext)
+	un := &unstructured.Unstructured{}
+	un.SetAPIVersion("example.com/v1")
+	un.SetKind("Widget")
+
+	_, _, err := planner.getResourceName(un)
+	assert.Error(s.T(), err)
+	assert.Len(s.T(), s.reconciler.cachedResources.refresh, 1)
+}
+
+func TestDiscoveryTestSuite(t *testing.T) {
+	suite.Run(t, new(DiscoveryTestSuite))
+}
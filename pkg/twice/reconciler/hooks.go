@@ -0,0 +1,276 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/octopipe/circlerr/pkg/twice/health"
+	"github.com/octopipe/circlerr/pkg/twice/resource"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// PreSyncHookPhase hooks run before the objects of a sync are applied.
+	PreSyncHookPhase = "pre-sync"
+	// PostSyncHookPhase hooks run once every object of a sync was applied.
+	PostSyncHookPhase = "post-sync"
+	// OnDeleteHookPhase hooks run before the objects are deleted, they are only
+	// planned by plans with on-delete hooks.
+	OnDeleteHookPhase = "on-delete"
+)
+
+const (
+	// BeforeHookCreationDeletePolicy deletes the object of a previous run before
+	// the hook is created again, it is the policy of hooks without any.
+	BeforeHookCreationDeletePolicy = "before-hook-creation"
+	// HookSucceededDeletePolicy deletes the hook object once it completed.
+	HookSucceededDeletePolicy = "hook-succeeded"
+	// HookFailedDeletePolicy deletes the hook object once it failed.
+	HookFailedDeletePolicy = "hook-failed"
+)
+
+// withHookAnnotation sets the annotation holding the phases an object is a hook
+// of, so the planner knows the hooks to plan.
+func withHookAnnotation(hookAnnotation string) plannerOpt {
+	return func(ctx *plannerContext) {
+		ctx.hookAnnotation = hookAnnotation
+	}
+}
+
+// WithOnDeleteHooks plans the manifests for a deletion: only their on-delete
+// hooks are planned, every other managed object is planned for deletion.
+func WithOnDeleteHooks() plannerOpt {
+	return func(ctx *plannerContext) {
+		ctx.onDeleteHooks = true
+	}
+}
+
+// isPlanned reports whether an object with the hook phases is planned. Syncs
+// plan objects with their sync hooks, deletions only plan on-delete hooks.
+func (c plannerContext) isPlanned(phases map[string]bool) bool {
+	if c.onDeleteHooks {
+		return phases[OnDeleteHookPhase]
+	}
+
+	return len(phases) == 0 || phases[PreSyncHookPhase] || phases[PostSyncHookPhase]
+}
+
+// planHook plans the hook to be created, or created again when it exists. Hooks
+// are not dry run since an existing object is usually deleted before the hook
+// is applied.
+func (c plannerContext) planHook(manifest []byte, res resource.Resource) (PlanResult, error) {
+	action := PlanCreateAction
+	var live *unstructured.Unstructured
+	key := res.GetResourceIdentifier()
+	if c.cache.Has(key) {
+		action = PlanUpdateAction
+		live = c.cache.Get(key).Object
+	}
+
+	diff, err := getDiff(res, live, res.Object)
+	if err != nil {
+		return PlanResult{}, err
+	}
+
+	return PlanResult{
+		Resource:       res,
+		Action:         action,
+		SrcManifest:    string(manifest),
+		TargetManifest: string(manifest),
+		DiffString:     diff,
+	}, nil
+}
+
+// getHookPhases returns the phases listed by the comma separated hook
+// annotation of the object, unknown phases are ignored.
+func getHookPhases(un *unstructured.Unstructured, hookAnnotation string) map[string]bool {
+	phases := map[string]bool{}
+	if un == nil {
+		return phases
+	}
+
+	for _, phase := range strings.Split(un.GetAnnotations()[hookAnnotation], ",") {
+		phase = strings.TrimSpace(phase)
+		if phase == PreSyncHookPhase || phase == PostSyncHookPhase || phase == OnDeleteHookPhase {
+			phases[phase] = true
+		}
+	}
+
+	return phases
+}
+
+// getHookDeletePolicies returns the delete policies of the hook, hooks without
+// policies are deleted before they are created again.
+func (r reconciler) getHookDeletePolicies(res PlanResult) map[string]bool {
+	value := ""
+	if res.Object != nil {
+		value = res.Object.GetAnnotations()[r.hookDeletePolicyAnnotation]
+	}
+
+	policies := map[string]bool{}
+	for _, policy := range strings.Split(value, ",") {
+		if policy = strings.TrimSpace(policy); policy != "" {
+			policies[policy] = true
+		}
+	}
+
+	if len(policies) == 0 {
+		policies[BeforeHookCreationDeletePolicy] = true
+	}
+
+	return policies
+}
+
+// splitHooks groups the hooks of the plan by phase, deletions of hooks no
+// longer rendered are kept with the other results.
+func splitHooks(planResults []PlanResult, hookAnnotation string) (map[string][]PlanResult, []PlanResult) {
+	hooks := map[string][]PlanResult{}
+	results := []PlanResult{}
+	for _, res := range planResults {
+		phases := getHookPhases(res.Object, hookAnnotation)
+		if len(phases) == 0 || res.Action == PlanDeleteAction {
+			results = append(results, res)
+			continue
+		}
+
+		for phase := range phases {
+			hooks[phase] = append(hooks[phase], res)
+		}
+	}
+
+	return hooks, results
+}
+
+// hasChanges reports whether applying the plan changes any object.
+func hasChanges(planResults []PlanResult) bool {
+	for _, res := range planResults {
+		if res.Action != PlanImmutableAction {
+			return true
+		}
+	}
+
+	return false
+}
+
+// applyHooks runs the hooks of a phase in waves, each wave waits for its hooks
+// to complete. The hooks after a failed one fail with the returned error.
+func (r reconciler) applyHooks(ctx context.Context, phase string, hooks []PlanResult, skipErr error) ([]ApplyResult, error) {
+	waves, invalidResults := getWaves(hooks, r.syncWaveAnnotation)
+	results, skipErr := r.applyWaves(waves, skipErr, func(w wave) ([]ApplyResult, error) {
+		waveResults := []ApplyResult{}
+		for _, res := range w.results {
+			waveResults = append(waveResults, r.applyHook(ctx, res))
+		}
+
+		r.waitHooks(ctx, waveResults)
+		for _, res := range waveResults {
+			if res.Err != nil {
+				return waveResults, fmt.Errorf("skipped after %s hook %s failed", phase, res.Name)
+			}
+		}
+
+		return waveResults, nil
+	})
+
+	return append(invalidResults, results...), skipErr
+}
+
+// applyHook creates the hook, an object left by a previous run is deleted
+// first when the hook has the before-hook-creation policy.
+func (r reconciler) applyHook(ctx context.Context, res PlanResult) ApplyResult {
+	if res.Action != PlanCreateAction && r.getHookDeletePolicies(res)[BeforeHookCreationDeletePolicy] {
+		if err := r.deleteHook(ctx, res); err != nil {
+			return ApplyResult{PlanResult: res, Err: err}
+		}
+
+		res.Action = PlanCreateAction
+	}
+
+	return r.apply(ctx, res)
+}
+
+// waitHooks polls the applied hooks until they complete, hooks failing or not
+// completing within the hook timeout fail. Hooks are deleted afterwards when
+// their delete policies ask for it.
+func (r reconciler) waitHooks(ctx context.Context, results []ApplyResult) {
+	for i, res := range results {
+		if res.Err != nil || res.Object == nil {
+			continue
+		}
+
+		dynamicInterface := getResourceInterface(r.dynamicClient, res.Resource)
+
+		status := health.Status{Status: health.MissingStatus}
+		err := wait.PollImmediate(waveHealthPollInterval, r.hookTimeout, func() (bool, error) {
+			un, err := dynamicInterface.Get(ctx, res.Name, v1.GetOptions{})
+			if err != nil {
+				return false, nil
+			}
+
+			status = r.getHookStatus(un)
+			return status.Status == health.HealthyStatus || status.Status == health.DegradedStatus, nil
+		})
+
+		results[i].Status = status.Status
+		results[i].StatusMessage = status.Message
+		if err != nil {
+			results[i].Err = fmt.Errorf("%s hook %s did not complete: %s", res.Kind, res.Name, status.Message)
+		} else if status.Status == health.DegradedStatus {
+			results[i].Err = fmt.Errorf("%s hook %s failed: %s", res.Kind, res.Name, status.Message)
+		}
+
+		policies := r.getHookDeletePolicies(res.PlanResult)
+		if (results[i].Err == nil && policies[HookSucceededDeletePolicy]) || (results[i].Err != nil && policies[HookFailedDeletePolicy]) {
+			if err := r.deleteHook(ctx, res.PlanResult); err != nil && results[i].Err == nil {
+				results[i].Err = err
+			}
+		}
+	}
+}
+
+// getHookStatus evaluates the health of a hook object, pods complete once they
+// terminated rather than once they are ready.
+func (r reconciler) getHookStatus(un *unstructured.Unstructured) health.Status {
+	if un.GroupVersionKind().GroupKind() != (schema.GroupKind{Kind: "Pod"}) {
+		return r.healthChecker.Check(un)
+	}
+
+	phase, _, _ := unstructured.NestedString(un.Object, "status", "phase")
+	switch phase {
+	case "Succeeded":
+		return health.Status{Status: health.HealthyStatus}
+	case "Failed":
+		message, _, _ := unstructured.NestedString(un.Object, "status", "message")
+		return health.Status{Status: health.DegradedStatus, Message: message}
+	}
+
+	return health.Status{Status: health.ProgressingStatus, Message: "waiting for pod to complete"}
+}
+
+// deleteHook deletes the hook with its dependents and waits until it is gone,
+// so a hook created again never conflicts with the deleted object.
+func (r reconciler) deleteHook(ctx context.Context, res PlanResult) error {
+	dynamicInterface := getResourceInterface(r.dynamicClient, res.Resource)
+
+	propagationPolicy := v1.DeletePropagationBackground
+	err := dynamicInterface.Delete(ctx, res.Name, v1.DeleteOptions{PropagationPolicy: &propagationPolicy})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return err
+	}
+
+	r.cache.Delete(res.GetResourceIdentifier())
+	err = wait.PollImmediate(waveHealthPollInterval, r.hookTimeout, func() (bool, error) {
+		_, err := dynamicInterface.Get(ctx, res.Name, v1.GetOptions{})
+		return k8sErrors.IsNotFound(err), nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s hook %s was not deleted: %w", res.Kind, res.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,249 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/octopipe/circlerr/pkg/twice/cache"
+	"github.com/octopipe/circlerr/pkg/twice/health"
+	"github.com/octopipe/circlerr/pkg/twice/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+var jobGVR = schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}
+
+func newHookManifest(name string, phase string, deletePolicy string) string {
+	annotations := fmt.Sprintf("%s: %s", DefaultHookAnnotation, phase)
+	if deletePolicy != "" {
+		annotations += fmt.Sprintf("\n    %s: %s", DefaultHookDeletePolicyAnnotation, deletePolicy)
+	}
+
+	return fmt.Sprintf(`
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: %s
+  annotations:
+    %s
+spec:
+  template:
+    spec:
+      restartPolicy: Never
+      containers:
+      - name: %s
+        image: busybox
+`, name, annotations, name)
+}
+
+const guestbookConfigMap = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: guestbook
+data:
+  color: blue
+`
+
+type HooksTestSuite struct {
+	suite.Suite
+	reconciler    reconciler
+	dynamicClient *dynamicfake.FakeDynamicClient
+	jobCondition  string
+}
+
+func (s *HooksTestSuite) SetupTest() {
+	verbs := v1.Verbs{"get", "list", "watch", "create", "delete"}
+	discoveryClient := &fake.FakeDiscovery{Fake: &clienttesting.Fake{
+		Resources: []*v1.APIResourceList{
+			{
+				GroupVersion: "v1",
+				APIResources: []v1.APIResource{{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: verbs}},
+			},
+			{
+				GroupVersion: "batch/v1",
+				APIResources: []v1.APIResource{{Name: "jobs", Kind: "Job", Namespaced: true, Verbs: verbs}},
+			},
+		},
+	}}
+
+	s.jobCondition = "Complete"
+	s.dynamicClient = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{configMapGVR: "ConfigMapList", jobGVR: "JobList"},
+	)
+	s.dynamicClient.PrependReactor("create", "jobs", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		un := action.(clienttesting.CreateAction).GetObject().(*unstructured.Unstructured)
+		conditions := []interface{}{map[string]interface{}{"type": s.jobCondition, "status": "True"}}
+		return false, nil, unstructured.SetNestedSlice(un.Object, conditions, "status", "conditions")
+	})
+
+	localCache := cache.NewLocalCache()
+	s.reconciler = reconciler{
+		Planner:                    NewPlanner(localCache, discoveryClient),
+		logger:                     logr.Discard(),
+		cache:                      localCache,
+		healthChecker:              health.NewChecker(),
+		syncWaveAnnotation:         DefaultSyncWaveAnnotation,
+		hookAnnotation:             DefaultHookAnnotation,
+		hookDeletePolicyAnnotation: DefaultHookDeletePolicyAnnotation,
+		hookTimeout:                time.Second,
+		dynamicClient:              s.dynamicClient,
+	}
+}
+
+func (s *HooksTestSuite) plan(manifests []string, opts ...plannerOpt) []PlanResult {
+	planResults, err := s.reconciler.Plan(context.Background(), manifests, "default", isManagedForTest, opts...)
+	assert.NoError(s.T(), err)
+	return planResults
+}
+
+func (s *HooksTestSuite) apply(planResults []PlanResult) []ApplyResult {
+	results, err := s.reconciler.Apply(context.Background(), planResults, "default")
+	assert.NoError(s.T(), err)
+	return results
+}
+
+func (s *HooksTestSuite) exists(gvr schema.GroupVersionResource, name string) bool {
+	_, err := s.dynamicClient.Resource(gvr).Namespace("default").Get(context.Background(), name, v1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		return false
+	}
+
+	assert.NoError(s.T(), err)
+	return true
+}
+
+func (s *HooksTestSuite) getActions() []string {
+	actions := []string{}
+	for _, action := range s.dynamicClient.Actions() {
+		if action.GetVerb() == "create" || action.GetVerb() == "delete" {
+			actions = append(actions, fmt.Sprintf("%s %s", action.GetVerb(), action.GetResource().Resource))
+		}
+	}
+
+	return actions
+}
+
+func getApplyResultNames(results []ApplyResult) []string {
+	names := []string{}
+	for _, res := range results {
+		names = append(names, res.Name)
+	}
+
+	return names
+}
+
+func (s *HooksTestSuite) TestPlanHooks() {
+	manifests := []string{
+		guestbookConfigMap,
+		newHookManifest("migration", PreSyncHookPhase, ""),
+		newHookManifest("cleanup", OnDeleteHookPhase, ""),
+	}
+
+	planResults := s.plan(manifests)
+	assert.Len(s.T(), planResults, 2)
+	assert.Equal(s.T(), "guestbook", planResults[0].Name)
+	assert.Equal(s.T(), "migration", planResults[1].Name)
+	assert.Equal(s.T(), PlanCreateAction, planResults[1].Action)
+
+	planResults = s.plan(manifests, WithOnDeleteHooks())
+	assert.Len(s.T(), planResults, 1)
+	assert.Equal(s.T(), "cleanup", planResults[0].Name)
+}
+
+func (s *HooksTestSuite) TestApplyRunsHooksInOrder() {
+	results := s.apply(s.plan([]string{
+		newHookManifest("smoke-test", PostSyncHookPhase, ""),
+		guestbookConfigMap,
+		newHookManifest("migration", PreSyncHookPhase, ""),
+	}))
+
+	assert.Equal(s.T(), []string{"migration", "guestbook", "smoke-test"}, getApplyResultNames(results))
+	for _, res := range results {
+		assert.NoError(s.T(), res.Err)
+	}
+	assert.Equal(s.T(), health.HealthyStatus, results[0].Status)
+	assert.True(s.T(), s.exists(jobGVR, "migration"))
+	assert.True(s.T(), s.exists(jobGVR, "smoke-test"))
+}
+
+func (s *HooksTestSuite) TestApplyDeletesSucceededHook() {
+	results := s.apply(s.plan([]string{guestbookConfigMap, newHookManifest("migration", PreSyncHookPhase, HookSucceededDeletePolicy)}))
+
+	assert.NoError(s.T(), results[0].Err)
+	assert.False(s.T(), s.exists(jobGVR, "migration"))
+	assert.True(s.T(), s.exists(configMapGVR, "guestbook"))
+}
+
+func (s *HooksTestSuite) TestApplyFailedHookSkipsSync() {
+	s.jobCondition = "Failed"
+	results := s.apply(s.plan([]string{
+		guestbookConfigMap,
+		newHookManifest("migration", PreSyncHookPhase, HookFailedDeletePolicy),
+		newHookManifest("smoke-test", PostSyncHookPhase, ""),
+	}))
+
+	assert.Equal(s.T(), []string{"migration", "guestbook", "smoke-test"}, getApplyResultNames(results))
+	assert.ErrorContains(s.T(), results[0].Err, "Job hook migration failed")
+	assert.Equal(s.T(), health.DegradedStatus, results[0].Status)
+	assert.EqualError(s.T(), results[1].Err, "skipped after pre-sync hook migration failed")
+	assert.EqualError(s.T(), results[2].Err, "skipped after pre-sync hook migration failed")
+	assert.False(s.T(), s.exists(jobGVR, "migration"))
+	assert.False(s.T(), s.exists(configMapGVR, "guestbook"))
+}
+
+func (s *HooksTestSuite) TestApplyRecreatesHookBeforeCreation() {
+	manifests := []string{guestbookConfigMap, newHookManifest("migration", PreSyncHookPhase, "")}
+	s.apply(s.plan(manifests))
+
+	configMap := newConfigMap("guestbook")
+	assert.NoError(s.T(), unstructured.SetNestedField(configMap.Object, "green", "data", "color"))
+	manifest, err := configMap.MarshalJSON()
+	assert.NoError(s.T(), err)
+
+	planResults := s.plan([]string{string(manifest), manifests[1]})
+	assert.Equal(s.T(), PlanUpdateAction, planResults[1].Action)
+
+	s.dynamicClient.ClearActions()
+	results := s.apply(planResults)
+	assert.NoError(s.T(), results[0].Err)
+	assert.Equal(s.T(), []string{"delete jobs", "create jobs"}, s.getActions())
+	assert.True(s.T(), s.exists(jobGVR, "migration"))
+}
+
+func (s *HooksTestSuite) TestApplyWithoutChangesSkipsHooks() {
+	manifests := []string{guestbookConfigMap, newHookManifest("migration", PreSyncHookPhase, HookSucceededDeletePolicy)}
+	s.apply(s.plan(manifests))
+
+	s.dynamicClient.ClearActions()
+	results := s.apply(s.plan(manifests))
+	assert.Equal(s.T(), []string{"guestbook"}, getApplyResultNames(results))
+	assert.Empty(s.T(), s.getActions())
+	assert.False(s.T(), s.exists(jobGVR, "migration"))
+}
+
+func (s *HooksTestSuite) TestGetHookPhases() {
+	un := &unstructured.Unstructured{}
+	un.SetAnnotations(map[string]string{DefaultHookAnnotation: "pre-sync, on-delete,unknown"})
+	assert.Equal(s.T(), map[string]bool{PreSyncHookPhase: true, OnDeleteHookPhase: true}, getHookPhases(un, DefaultHookAnnotation))
+	assert.Empty(s.T(), getHookPhases(nil, DefaultHookAnnotation))
+
+	deletePolicies := s.reconciler.getHookDeletePolicies(PlanResult{Resource: resource.Resource{Object: un}})
+	assert.Equal(s.T(), map[string]bool{BeforeHookCreationDeletePolicy: true}, deletePolicies)
+}
+
+func TestHooksTestSuite(t *testing.T) {
+	suite.Run(t, new(HooksTestSuite))
+}
@@ -0,0 +1,37 @@
+package reconciler
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+)
+
+// registerMetrics reports how long the watches of the cached resources have
+// been stale on every collection of the meter, watches in sync report 0.
+func (r reconciler) registerMetrics(meter metric.Meter) error {
+	staleness, err := meter.Float64ObservableGauge(
+		"twice_cache_watch_staleness",
+		instrument.WithDescription("Time since the watch of a cached resource stopped receiving changes"),
+		instrument.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, observer metric.Observer) error {
+		for key, duration := range r.cachedResources.staleness(time.Now()) {
+			observer.ObserveFloat64(
+				staleness,
+				duration.Seconds(),
+				attribute.String("resource", key.resource.String()),
+				attribute.String("namespace", key.namespace),
+			)
+		}
+
+		return nil
+	}, staleness)
+	return err
+}
@@ -11,16 +11,31 @@ import (
 	jsonpatch "github.com/evanphx/json-patch"
 	"github.com/octopipe/circlerr/pkg/twice/cache"
 	"github.com/octopipe/circlerr/pkg/twice/resource"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/yaml"
 	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
 )
 
+var errUnsupportedResource = errors.New("server resource not supported")
+
 type plannerContext struct {
 	cache           cache.Cache
-	discoveryClient *discovery.DiscoveryClient
+	discoveryClient discovery.DiscoveryInterface
 	preHook         func(un *unstructured.Unstructured) *unstructured.Unstructured
+	dynamicClient   dynamic.Interface
+	fieldManager    string
+
+	maxAnnotationSize int
+	onUnknownKind     func()
+	hookAnnotation    string
+	onDeleteHooks     bool
 }
 
 type plannerOpt func(ctx *plannerContext)
@@ -35,14 +50,49 @@ func WithPreHook(preHook func(un *unstructured.Unstructured) *unstructured.Unstr
 	}
 }
 
-func NewPlanner(cache cache.Cache, discoveryClient *discovery.DiscoveryClient) Planner {
-	return plannerContext{
+// WithServerSideDryRun plans objects with a server-side apply dry run, so the
+// target of each object is computed by the API server with its field
+// ownership instead of merging the last applied configuration.
+func WithServerSideDryRun(dynamicClient dynamic.Interface, fieldManager string) plannerOpt {
+	return func(ctx *plannerContext) {
+		ctx.dynamicClient = dynamicClient
+		ctx.fieldManager = fieldManager
+	}
+}
+
+// WithCacheCompaction compacts the targets of the server-side dry run like the
+// cached objects are, so the annotations dropped from the cache are not
+// planned as changes.
+func WithCacheCompaction(maxAnnotationSize int) plannerOpt {
+	return func(ctx *plannerContext) {
+		ctx.maxAnnotationSize = maxAnnotationSize
+	}
+}
+
+// withUnknownKindHook sets a hook called when a manifest has a kind missing
+// from discovery, so memoized discovery can be refreshed.
+func withUnknownKindHook(onUnknownKind func()) plannerOpt {
+	return func(ctx *plannerContext) {
+		ctx.onUnknownKind = onUnknownKind
+	}
+}
+
+func NewPlanner(cache cache.Cache, discoveryClient discovery.DiscoveryInterface, opts ...plannerOpt) Planner {
+	c := plannerContext{
 		cache:           cache,
 		discoveryClient: discoveryClient,
 		preHook: func(un *unstructured.Unstructured) *unstructured.Unstructured {
 			return un
 		},
+		onUnknownKind:  func() {},
+		hookAnnotation: DefaultHookAnnotation,
+	}
+
+	for _, opt := range opts {
+		opt(&c)
 	}
+
+	return c
 }
 
 func (c plannerContext) Plan(ctx context.Context, manifests []string, namespace string, isManaged isManagedFunc, opts ...plannerOpt) ([]PlanResult, error) {
@@ -69,20 +119,62 @@ func (c plannerContext) Plan(ctx context.Context, manifests []string, namespace
 		}
 
 		un = c.preHook(un)
-		resourceName, err := c.getResourceName(un)
+		phases := getHookPhases(un, c.hookAnnotation)
+		if !c.isPlanned(phases) {
+			continue
+		}
+
+		resourceName, namespaced, err := c.getResourceName(un)
+		if isUnknownKindError(err) {
+			// The kind may be defined by a CRD of the same manifests, the object
+			// is resolved again once the earlier objects are applied.
+			planResult, err := c.planCreate(m, resource.NewResourceByUnstructured(*un, namespace, "", true))
+			if err != nil {
+				return nil, err
+			}
+
+			result = append(result, planResult)
+			continue
+		}
+
 		if err != nil {
 			return nil, err
 		}
 
-		res := resource.NewResourceByUnstructured(*un, namespace, resourceName, true)
+		resourceNamespace := namespace
+		if !namespaced {
+			resourceNamespace = ""
+			un.SetNamespace("")
+		}
+
+		res := resource.NewResourceByUnstructured(*un, resourceNamespace, resourceName, true)
+		if len(phases) > 0 {
+			planResult, err := c.planHook(m, res)
+			if err != nil {
+				return nil, err
+			}
+
+			result = append(result, planResult)
+			continue
+		}
+
+		if c.dynamicClient != nil {
+			planResult, err := c.planServerSide(ctx, m, res)
+			if err != nil {
+				return nil, err
+			}
+
+			result = append(result, planResult)
+			continue
+		}
+
 		if !c.cache.Has(res.GetResourceIdentifier()) {
-			result = append(result, PlanResult{
-				Resource:       res,
-				Action:         PlanCreateAction,
-				SrcManifest:    string(m),
-				TargetManifest: string(m),
-				DiffString:     []string{},
-			})
+			planResult, err := c.planCreate(m, res)
+			if err != nil {
+				return nil, err
+			}
+
+			result = append(result, planResult)
 			continue
 		}
 
@@ -92,6 +184,16 @@ func (c plannerContext) Plan(ctx context.Context, manifests []string, namespace
 
 		currentResource := c.cache.Get(res.GetResourceIdentifier())
 		lastAppliedConfiguration := c.getLastAppliedConfiguration(currentResource.Object)
+		if lastAppliedConfiguration == "" {
+			planResult, err := c.planFromLive(m, res, currentResource.Object)
+			if err != nil {
+				return nil, err
+			}
+
+			result = append(result, planResult)
+			continue
+		}
+
 		patch, err := c.getMergePatch([]byte(lastAppliedConfiguration), m)
 		if err != nil {
 			return nil, err
@@ -116,21 +218,194 @@ func (c plannerContext) Plan(ctx context.Context, manifests []string, namespace
 
 		c.preHook(targetObject)
 		res.Object = targetObject
+		diff, err := c.getUpdateDiff(res, currentResource.Object, patch)
+		if err != nil {
+			return nil, err
+		}
+
 		result = append(result, PlanResult{
 			Resource:       res,
 			Action:         currentAction,
 			SrcManifest:    string(m),
 			TargetManifest: string(target),
-			DiffString:     []string{},
+			DiffString:     diff,
 		})
 	}
 
-	resultsForDeletion := c.getPlanResultsForDeletion(isManaged, result)
+	resultsForDeletion, err := c.getPlanResultsForDeletion(namespace, isManaged, result)
+	if err != nil {
+		return nil, err
+	}
+
 	result = append(result, resultsForDeletion...)
 
 	return result, nil
 }
 
+func (c plannerContext) planCreate(manifest []byte, res resource.Resource) (PlanResult, error) {
+	diff, err := getDiff(res, nil, res.Object)
+	if err != nil {
+		return PlanResult{}, err
+	}
+
+	return PlanResult{
+		Resource:       res,
+		Action:         PlanCreateAction,
+		SrcManifest:    string(manifest),
+		TargetManifest: string(manifest),
+		DiffString:     diff,
+	}, nil
+}
+
+// getDefaultAction returns the action of an object which target could not be
+// computed.
+func (c plannerContext) getDefaultAction(res resource.Resource) string {
+	if c.cache.Has(res.GetResourceIdentifier()) {
+		return PlanUpdateAction
+	}
+
+	return PlanCreateAction
+}
+
+// planServerSide dry runs the apply of the object and compares the result with
+// the cached object, ignoring fields written by the API server on every apply.
+func (c plannerContext) planServerSide(ctx context.Context, manifest []byte, res resource.Resource) (PlanResult, error) {
+	dynamicInterface := getResourceInterface(c.dynamicClient, res)
+
+	target, err := dynamicInterface.Apply(ctx, res.Name, res.Object, metav1.ApplyOptions{
+		FieldManager: c.fieldManager,
+		Force:        true,
+		DryRun:       []string{metav1.DryRunAll},
+	})
+	if k8sErrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		// The namespace or the definition of the object is created by the same
+		// manifests, the rendered object is all that can be planned.
+		return c.planCreate(manifest, res)
+	}
+
+	if err != nil {
+		return PlanResult{Resource: res, Action: c.getDefaultAction(res), SrcManifest: string(manifest), Err: err}, nil
+	}
+
+	targetManifest, err := target.MarshalJSON()
+	if err != nil {
+		return PlanResult{}, err
+	}
+
+	compactObject(target, c.maxAnnotationSize)
+
+	action := PlanCreateAction
+	var live *unstructured.Unstructured
+	key := res.GetResourceIdentifier()
+	if c.cache.Has(key) {
+		action = PlanUpdateAction
+		live = c.cache.Get(key).Object
+		if live != nil && isSameObject(live, target) {
+			action = PlanImmutableAction
+		}
+	}
+
+	diff, err := getDiff(res, live, target)
+	if err != nil {
+		return PlanResult{}, err
+	}
+
+	return PlanResult{
+		Resource:       res,
+		Action:         action,
+		SrcManifest:    string(manifest),
+		TargetManifest: string(targetManifest),
+		DiffString:     diff,
+	}, nil
+}
+
+// getUpdateDiff predicts the object left by a client-side update merging the
+// patch into the live object, so defaulted fields don't show up as removed.
+func (c plannerContext) getUpdateDiff(res resource.Resource, live *unstructured.Unstructured, patch []byte) ([]string, error) {
+	if live == nil || string(patch) == "{}" {
+		return []string{}, nil
+	}
+
+	liveManifest, err := live.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	predictedManifest, err := jsonpatch.MergePatch(liveManifest, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	predicted := &unstructured.Unstructured{}
+	if err := json.Unmarshal(predictedManifest, predicted); err != nil {
+		return nil, err
+	}
+
+	return getDiff(res, live, c.preHook(predicted))
+}
+
+// planFromLive plans an object without last applied configuration, like the
+// ones applied server-side, merging the rendered object into the live one.
+// Fields missing from the rendered object are kept rather than removed.
+func (c plannerContext) planFromLive(manifest []byte, res resource.Resource, live *unstructured.Unstructured) (PlanResult, error) {
+	liveJSON := []byte("{}")
+	if live != nil {
+		var err error
+		liveJSON, err = json.Marshal(normalizeObject(live))
+		if err != nil {
+			return PlanResult{}, err
+		}
+	}
+
+	rendered, err := res.Object.MarshalJSON()
+	if err != nil {
+		return PlanResult{}, err
+	}
+
+	target, err := jsonpatch.MergePatch(liveJSON, rendered)
+	if err != nil {
+		return PlanResult{}, err
+	}
+
+	targetObject := &unstructured.Unstructured{}
+	if err := json.Unmarshal(target, targetObject); err != nil {
+		return PlanResult{}, err
+	}
+
+	action := PlanUpdateAction
+	if live != nil && isSameObject(live, targetObject) {
+		action = PlanImmutableAction
+	}
+
+	res.Object = targetObject
+	diff, err := getDiff(res, live, targetObject)
+	if err != nil {
+		return PlanResult{}, err
+	}
+
+	return PlanResult{
+		Resource:       res,
+		Action:         action,
+		SrcManifest:    string(manifest),
+		TargetManifest: string(manifest),
+		DiffString:     diff,
+	}, nil
+}
+
+func isSameObject(current *unstructured.Unstructured, target *unstructured.Unstructured) bool {
+	return equality.Semantic.DeepEqual(normalizeObject(current), normalizeObject(target))
+}
+
+func normalizeObject(un *unstructured.Unstructured) map[string]interface{} {
+	obj := un.DeepCopy().Object
+	unstructured.RemoveNestedField(obj, "status")
+	for _, field := range []string{"managedFields", "resourceVersion", "generation", "creationTimestamp", "uid"} {
+		unstructured.RemoveNestedField(obj, "metadata", field)
+	}
+
+	return obj
+}
+
 func (c plannerContext) splitManifest(manifest []byte) ([][]byte, error) {
 	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(manifest), 4096)
 	manifests := [][]byte{}
@@ -165,7 +440,13 @@ func (c plannerContext) deserializer(manifest []byte) (*unstructured.Unstructure
 	return un, nil
 }
 
+// getLastAppliedConfiguration returns the configuration the object was last
+// applied with, objects applied server-side don't record it.
 func (c plannerContext) getLastAppliedConfiguration(un *unstructured.Unstructured) string {
+	if un == nil {
+		return ""
+	}
+
 	annotations := un.GetAnnotations()
 
 	kubectlLastAppliedConfigurationAnnotation := "kubectl.kubernetes.io/last-applied-configuration"
@@ -219,10 +500,16 @@ func (c plannerContext) getMergePatch(original []byte, modified []byte) ([]byte,
 	return l, nil
 }
 
-func (c plannerContext) getResourceName(un *unstructured.Unstructured) (string, error) {
+// getResourceName returns the resource of the object kind and whether it is
+// namespaced.
+func (c plannerContext) getResourceName(un *unstructured.Unstructured) (string, bool, error) {
 	apiResourceList, err := c.discoveryClient.ServerResourcesForGroupVersion(un.GroupVersionKind().GroupVersion().String())
+	if k8sErrors.IsNotFound(err) || errors.Is(err, memory.ErrCacheNotFound) {
+		c.onUnknownKind()
+	}
+
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
 
 	for _, apiResource := range apiResourceList.APIResources {
@@ -231,49 +518,72 @@ func (c plannerContext) getResourceName(un *unstructured.Unstructured) (string,
 		}
 
 		if apiResource.Kind == un.GetKind() {
-			return apiResource.Name, nil
+			return apiResource.Name, apiResource.Namespaced, nil
 		}
 	}
 
-	return "", errors.New("server resource not supported")
+	c.onUnknownKind()
+	return "", false, errUnsupportedResource
+}
+
+// isUnknownKindError reports whether the error is about a kind missing from
+// discovery.
+func isUnknownKindError(err error) bool {
+	return err != nil && (k8sErrors.IsNotFound(err) || errors.Is(err, memory.ErrCacheNotFound) || errors.Is(err, errUnsupportedResource))
+}
+
+// isPending reports whether the kind of the object was unknown when it was
+// planned.
+func isPending(res PlanResult) bool {
+	return res.ResourceName == ""
 }
 
-func (c plannerContext) getPlanResultsForDeletion(isManaged isManagedFunc, currentResults []PlanResult) []PlanResult {
+// getPlanResultsForDeletion plans the deletion of managed resources of the
+// namespace, or cluster scoped ones, that are no longer part of the plan.
+func (c plannerContext) getPlanResultsForDeletion(namespace string, isManaged isManagedFunc, currentResults []PlanResult) ([]PlanResult, error) {
+	planned := map[string]bool{}
+	for _, planResult := range currentResults {
+		planned[planResult.GetResourceIdentifier()] = true
+	}
+
+	cachedResources := c.cache.ByIndex(cache.NamespaceIndex, namespace)
+	if namespace != "" {
+		cachedResources = append(cachedResources, c.cache.ByIndex(cache.NamespaceIndex, "")...)
+	}
+
 	result := []PlanResult{}
-	cachedResources := c.cache.List(func(res resource.Resource) bool {
-		return res.Object != nil && isManaged(res.Object)
-	})
-	for _, cachedKey := range cachedResources {
-		forDeletion := true
-		for _, planResult := range currentResults {
-			if cachedKey == planResult.GetResourceIdentifier() {
-				forDeletion = false
-			}
+	for _, cachedItem := range cachedResources {
+		if cachedItem.Object == nil || !isManaged(cachedItem.Object) || planned[cachedItem.GetResourceIdentifier()] {
+			continue
 		}
 
-		if forDeletion {
-			cachedItem := c.cache.Get(cachedKey)
-
-			isControlled := false
-			// Verifying if cached resource has a controller to prevent accidentally deleting
-			for _, owner := range cachedItem.Object.GetOwnerReferences() {
-				isController := owner.Controller
-				if isController != nil && *isController {
-					isControlled = true
-					break
-				}
+		isControlled := false
+		// Verifying if cached resource has a controller to prevent accidentally deleting
+		for _, owner := range cachedItem.Object.GetOwnerReferences() {
+			isController := owner.Controller
+			if isController != nil && *isController {
+				isControlled = true
+				break
 			}
+		}
 
-			if !isControlled {
-				result = append(result, PlanResult{
-					Resource:       cachedItem,
-					Action:         PlanDeleteAction,
-					SrcManifest:    c.getLastAppliedConfiguration(cachedItem.Object),
-					TargetManifest: "",
-				})
-			}
+		if isControlled {
+			continue
+		}
+
+		diff, err := getDiff(cachedItem, cachedItem.Object, nil)
+		if err != nil {
+			return nil, err
 		}
+
+		result = append(result, PlanResult{
+			Resource:       cachedItem,
+			Action:         PlanDeleteAction,
+			SrcManifest:    c.getLastAppliedConfiguration(cachedItem.Object),
+			TargetManifest: "",
+			DiffString:     diff,
+		})
 	}
 
-	return result
+	return result, nil
 }
@@ -0,0 +1,140 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/octopipe/circlerr/pkg/twice/cache"
+	"github.com/octopipe/circlerr/pkg/twice/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+type PlannerTestSuite struct {
+	suite.Suite
+	current *unstructured.Unstructured
+}
+
+func (s *PlannerTestSuite) SetupTest() {
+	s.current = &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":              "guestbook",
+			"namespace":         "default",
+			"uid":               "8c1f9d1a-0d1e-4d52-9f7b-2d7e8f6f3a10",
+			"resourceVersion":   "1024",
+			"creationTimestamp": "2023-01-01T00:00:00Z",
+			"managedFields": []interface{}{
+				map[string]interface{}{"manager": "circlerr", "operation": "Apply"},
+			},
+		},
+		"data": map[string]interface{}{"color": "blue"},
+	}}
+}
+
+func (s *PlannerTestSuite) TestIsSameObject() {
+	target := s.current.DeepCopy()
+	target.SetResourceVersion("2048")
+	target.SetManagedFields(nil)
+	assert.True(s.T(), isSameObject(s.current, target))
+}
+
+func (s *PlannerTestSuite) TestIsSameObjectChangedData() {
+	target := s.current.DeepCopy()
+	assert.NoError(s.T(), unstructured.SetNestedField(target.Object, "green", "data", "color"))
+	assert.False(s.T(), isSameObject(s.current, target))
+}
+
+func (s *PlannerTestSuite) TestIsSameObjectChangedLabels() {
+	target := s.current.DeepCopy()
+	target.SetLabels(map[string]string{"circlerr.io/circle": "circle-1"})
+	assert.False(s.T(), isSameObject(s.current, target))
+}
+
+func (s *PlannerTestSuite) newPlanner() (Planner, cache.Cache) {
+	discoveryClient := &fake.FakeDiscovery{Fake: &clienttesting.Fake{
+		Resources: []*v1.APIResourceList{{
+			GroupVersion: "v1",
+			APIResources: []v1.APIResource{{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: v1.Verbs{"get", "list", "watch"}}},
+		}},
+	}}
+
+	localCache := cache.NewLocalCache()
+	return NewPlanner(localCache, discoveryClient), localCache
+}
+
+func (s *PlannerTestSuite) TestPlanWithoutLastAppliedConfiguration() {
+	planner, localCache := s.newPlanner()
+	localCache.Set(
+		resource.NewResourceByUnstructured(*s.current, "default", "configmaps", true).GetResourceIdentifier(),
+		resource.NewResourceByUnstructured(*s.current, "default", "configmaps", true),
+	)
+
+	planResults, err := planner.Plan(context.Background(), []string{guestbookConfigMap}, "default", isManagedForTest)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), planResults, 1)
+	assert.Equal(s.T(), PlanImmutableAction, planResults[0].Action)
+
+	green := strings.ReplaceAll(guestbookConfigMap, "blue", "green")
+	planResults, err = planner.Plan(context.Background(), []string{green}, "default", isManagedForTest)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), PlanUpdateAction, planResults[0].Action)
+	assert.Contains(s.T(), planResults[0].DiffString, "+  color: green")
+}
+
+func (s *PlannerTestSuite) newDryRunClient(err error) *dynamicfake.FakeDynamicClient {
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{configMapGVR: "ConfigMapList"},
+	)
+	dynamicClient.PrependReactor("patch", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, err
+	})
+
+	return dynamicClient
+}
+
+func (s *PlannerTestSuite) TestPlanServerSideMissingNamespace() {
+	planner, _ := s.newPlanner()
+	dynamicClient := s.newDryRunClient(k8sErrors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, "default"))
+
+	planResults, err := planner.Plan(context.Background(), []string{guestbookConfigMap}, "default", isManagedForTest, WithServerSideDryRun(dynamicClient, "circlerr"))
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), planResults, 1)
+	assert.NoError(s.T(), planResults[0].Err)
+	assert.Equal(s.T(), PlanCreateAction, planResults[0].Action)
+	assert.Equal(s.T(), "guestbook", planResults[0].Object.GetName())
+}
+
+func (s *PlannerTestSuite) TestPlanServerSideDryRunError() {
+	planner, _ := s.newPlanner()
+	dynamicClient := s.newDryRunClient(errors.New("admission webhook denied the request"))
+	manifests := []string{guestbookConfigMap, strings.ReplaceAll(guestbookConfigMap, "name: guestbook", "name: frontend")}
+
+	planResults, err := planner.Plan(context.Background(), manifests, "default", isManagedForTest, WithServerSideDryRun(dynamicClient, "circlerr"))
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), planResults, 2)
+	for _, planResult := range planResults {
+		assert.Equal(s.T(), PlanCreateAction, planResult.Action)
+		assert.EqualError(s.T(), planResult.Err, "admission webhook denied the request")
+	}
+
+	r := reconciler{dynamicClient: dynamicClient}
+	applyResult := r.apply(context.Background(), planResults[0])
+	assert.EqualError(s.T(), applyResult.Err, "admission webhook denied the request")
+}
+
+func TestPlannerTestSuite(t *testing.T) {
+	suite.Run(t, new(PlannerTestSuite))
+}
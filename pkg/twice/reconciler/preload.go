@@ -0,0 +1,124 @@
+package reconciler
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/metadata"
+)
+
+// resourceClient lists and watches the objects of a resource, only their
+// metadata is transferred when metadata is set.
+type resourceClient struct {
+	gvk       schema.GroupVersionKind
+	gvr       schema.GroupVersionResource
+	namespace string
+	dynamic   dynamic.ResourceInterface
+	metadata  metadata.ResourceInterface
+}
+
+func (c resourceClient) watchKey() watchKey {
+	return watchKey{resource: c.gvr, namespace: c.namespace}
+}
+
+func (c resourceClient) list(ctx context.Context) ([]*unstructured.Unstructured, string, error) {
+	if c.metadata == nil {
+		list, err := c.dynamic.List(ctx, v1.ListOptions{})
+		if err != nil {
+			return nil, "", err
+		}
+
+		uns := make([]*unstructured.Unstructured, 0, len(list.Items))
+		for i := range list.Items {
+			uns = append(uns, &list.Items[i])
+		}
+
+		return uns, list.GetResourceVersion(), nil
+	}
+
+	list, err := c.metadata.List(ctx, v1.ListOptions{})
+	if err != nil {
+		return nil, "", err
+	}
+
+	uns := make([]*unstructured.Unstructured, 0, len(list.Items))
+	for i := range list.Items {
+		un, ok := c.toUnstructured(&list.Items[i])
+		if !ok {
+			continue
+		}
+
+		uns = append(uns, un)
+	}
+
+	return uns, list.GetResourceVersion(), nil
+}
+
+func (c resourceClient) watch(ctx context.Context, options v1.ListOptions) (watch.Interface, error) {
+	if c.metadata == nil {
+		return c.dynamic.Watch(ctx, options)
+	}
+
+	return c.metadata.Watch(ctx, options)
+}
+
+// getObject returns the full object of a managed object received with only its
+// metadata.
+func (c resourceClient) getObject(ctx context.Context, un *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if c.metadata == nil {
+		return un, nil
+	}
+
+	return c.dynamic.Get(ctx, un.GetName(), v1.GetOptions{})
+}
+
+func (c resourceClient) toUnstructured(obj runtime.Object) (*unstructured.Unstructured, bool) {
+	switch o := obj.(type) {
+	case *unstructured.Unstructured:
+		return o, true
+	case *v1.PartialObjectMetadata:
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(o)
+		if err != nil {
+			return nil, false
+		}
+
+		un := &unstructured.Unstructured{Object: content}
+		un.SetGroupVersionKind(c.gvk)
+		return un, true
+	default:
+		return nil, false
+	}
+}
+
+// compactObject strips the fields of an object that are never read once it is
+// cached. Annotations larger than maxAnnotationSize are dropped too, except the
+// last applied configurations used for planning, a size of 0 keeps them all.
+func compactObject(un *unstructured.Unstructured, maxAnnotationSize int) {
+	un.SetManagedFields(nil)
+	if maxAnnotationSize <= 0 {
+		return
+	}
+
+	annotations := un.GetAnnotations()
+	changed := false
+	for key, value := range annotations {
+		if key == LastAppliedConfigurationAnnotation || key == corev1.LastAppliedConfigAnnotation {
+			continue
+		}
+
+		if len(value) > maxAnnotationSize {
+			delete(annotations, key)
+			changed = true
+		}
+	}
+
+	if changed {
+		un.SetAnnotations(annotations)
+	}
+}
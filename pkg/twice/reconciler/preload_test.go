@@ -0,0 +1,74 @@
+package reconciler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type PreloadTestSuite struct {
+	suite.Suite
+	object *unstructured.Unstructured
+}
+
+func (s *PreloadTestSuite) SetupTest() {
+	s.object = &unstructured.Unstructured{}
+	s.object.SetKind("ConfigMap")
+	s.object.SetName("guestbook")
+	s.object.SetManagedFields([]v1.ManagedFieldsEntry{{Manager: "circlerr", Operation: v1.ManagedFieldsOperationApply}})
+	s.object.SetAnnotations(map[string]string{
+		"circlerr.io/circle-name":          "main",
+		"example.com/large":                strings.Repeat("a", 64),
+		LastAppliedConfigurationAnnotation: strings.Repeat("b", 64),
+		corev1.LastAppliedConfigAnnotation: strings.Repeat("c", 64),
+	})
+}
+
+func (s *PreloadTestSuite) TestCompactObjectStripsManagedFields() {
+	compactObject(s.object, 0)
+
+	assert.Empty(s.T(), s.object.GetManagedFields())
+	assert.Len(s.T(), s.object.GetAnnotations(), 4)
+}
+
+func (s *PreloadTestSuite) TestCompactObjectDropsLargeAnnotations() {
+	compactObject(s.object, 32)
+
+	annotations := s.object.GetAnnotations()
+	assert.NotContains(s.T(), annotations, "example.com/large")
+	assert.Contains(s.T(), annotations, "circlerr.io/circle-name")
+	assert.Contains(s.T(), annotations, LastAppliedConfigurationAnnotation)
+	assert.Contains(s.T(), annotations, corev1.LastAppliedConfigAnnotation)
+}
+
+func (s *PreloadTestSuite) TestToUnstructuredFromMetadata() {
+	gvk := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "ReplicaSet"}
+	client := resourceClient{gvk: gvk}
+	obj := &v1.PartialObjectMetadata{ObjectMeta: v1.ObjectMeta{
+		Name:        "guestbook-5d4f",
+		Namespace:   "default",
+		Annotations: map[string]string{"circlerr.io/circle-name": "main"},
+	}}
+
+	un, ok := client.toUnstructured(obj)
+	assert.True(s.T(), ok)
+	assert.Equal(s.T(), gvk, un.GroupVersionKind())
+	assert.Equal(s.T(), "guestbook-5d4f", un.GetName())
+	assert.Equal(s.T(), "default", un.GetNamespace())
+	assert.Equal(s.T(), "main", un.GetAnnotations()["circlerr.io/circle-name"])
+}
+
+func (s *PreloadTestSuite) TestToUnstructuredIgnoresOtherObjects() {
+	_, ok := resourceClient{}.toUnstructured(&v1.Status{})
+	assert.False(s.T(), ok)
+}
+
+func TestPreloadTestSuite(t *testing.T) {
+	suite.Run(t, new(PreloadTestSuite))
+}
@@ -2,14 +2,14 @@ package reconciler
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/octopipe/circlerr/pkg/twice/cache"
+	"github.com/octopipe/circlerr/pkg/twice/health"
 	"github.com/octopipe/circlerr/pkg/twice/resource"
-	"golang.org/x/sync/errgroup"
+	"go.opentelemetry.io/otel/metric"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -17,15 +17,37 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
-	clientCache "k8s.io/client-go/tools/cache"
-	watchutil "k8s.io/client-go/tools/watch"
 	"k8s.io/client-go/util/retry"
 )
 
 const (
 	LastAppliedConfigurationAnnotation = "twice.io/last-applied-configuration"
+	DefaultSyncWaveAnnotation          = "twice.io/sync-wave"
+	DefaultHookAnnotation              = "twice.io/hook"
+	DefaultHookDeletePolicyAnnotation  = "twice.io/hook-delete-policy"
+	DefaultFieldManager                = "twice"
+)
+
+const (
+	defaultWaveTimeout              = 5 * time.Minute
+	waveHealthPollInterval          = 2 * time.Second
+	defaultHookTimeout              = 10 * time.Minute
+	defaultDiscoveryRefreshInterval = 5 * time.Minute
+	defaultPendingKindTimeout       = 30 * time.Second
+)
+
+const (
+	// ClientSideApplyStrategy creates and updates objects tracking the last
+	// applied configuration in an annotation.
+	ClientSideApplyStrategy = "CLIENT_SIDE"
+	// ServerSideApplyStrategy applies objects with server-side apply, forcing
+	// conflicts so the field manager owns every field it declares. It is opt-in,
+	// objects applied client-side are taken over on their next sync.
+	ServerSideApplyStrategy = "SERVER_SIDE"
 )
 
 const (
@@ -44,6 +66,8 @@ var (
 type Reconciler interface {
 	Planner
 	Preload(ctx context.Context, isManaged isManagedFunc, liveUpdate bool) error
+	StartResource(ctx context.Context, gvr schema.GroupVersionResource) error
+	StopResource(gvr schema.GroupVersionResource)
 	Apply(ctx context.Context, planResults []PlanResult, namespace string) ([]ApplyResult, error)
 }
 
@@ -53,39 +77,248 @@ type PlanResult struct {
 	SrcManifest    string
 	TargetManifest string
 	DiffString     []string
+	// Err is set when the object could not be planned, it is not applied.
+	Err error
 }
 
+// ApplyResult is the outcome of a plan result, Status and StatusMessage hold
+// the health of the object once it was applied.
 type ApplyResult struct {
 	PlanResult
-	Status string
-	Err    error
+	Status        string
+	StatusMessage string
+	Err           error
 }
 
 type isManagedFunc func(un *unstructured.Unstructured) bool
 
+// OnChangeFunc is called by live updates after the cache stored a change of a
+// resource, old is empty for resources not cached before the change.
+type OnChangeFunc func(eventType watch.EventType, old resource.Resource, new resource.Resource)
+
+type reconcilerOpt func(r *reconciler)
+
 type reconciler struct {
 	Planner
-	logger logr.Logger
-	config *rest.Config
-	cache  cache.Cache
+	logger        logr.Logger
+	config        *rest.Config
+	cache         cache.Cache
+	onChange      OnChangeFunc
+	applyStrategy string
+	fieldManager  string
+
+	syncWaveAnnotation string
+	waveHealthGate     bool
+	waveTimeout        time.Duration
+	healthChecker      health.Checker
+
+	hookAnnotation             string
+	hookDeletePolicyAnnotation string
+	hookTimeout                time.Duration
+
+	preloadGroupKinds map[schema.GroupKind]bool
+	preloadNamespaces []string
+	metadataOnly      map[schema.GroupKind]bool
+	maxAnnotationSize int
+
+	discoveryRefreshInterval time.Duration
+	pendingKindTimeout       time.Duration
+	cachedResources          *cachedResources
+	meter                    metric.Meter
+
+	dynamicClient   dynamic.Interface
+	metadataClient  metadata.Interface
+	discoveryClient discovery.CachedDiscoveryInterface
+}
+
+// WithOnChange sets a hook notified of every change received by live updates.
+func WithOnChange(onChange OnChangeFunc) reconcilerOpt {
+	return func(r *reconciler) {
+		r.onChange = onChange
+	}
+}
+
+// WithApplyStrategy sets how objects are applied, the client-side strategy is
+// used by default.
+func WithApplyStrategy(applyStrategy string) reconcilerOpt {
+	return func(r *reconciler) {
+		r.applyStrategy = applyStrategy
+	}
+}
+
+// WithFieldManager sets the field manager owning the fields applied by the
+// server-side strategy.
+func WithFieldManager(fieldManager string) reconcilerOpt {
+	return func(r *reconciler) {
+		r.fieldManager = fieldManager
+	}
+}
+
+// WithSyncWaveAnnotation sets the annotation holding the wave of an object,
+// objects without it belong to wave 0.
+func WithSyncWaveAnnotation(syncWaveAnnotation string) reconcilerOpt {
+	return func(r *reconciler) {
+		r.syncWaveAnnotation = syncWaveAnnotation
+	}
+}
+
+// WithWaveHealthGate waits for the objects of a wave to be healthy, as
+// reported by the health checker, before applying the next wave. Degraded
+// objects and objects not healthy within the timeout fail, a zero timeout
+// disables the gate.
+func WithWaveHealthGate(timeout time.Duration) reconcilerOpt {
+	return func(r *reconciler) {
+		r.waveHealthGate = timeout > 0
+		r.waveTimeout = timeout
+	}
+}
+
+// WithHookAnnotations sets the annotations holding the phases an object is a
+// hook of and the delete policies of the hook.
+func WithHookAnnotations(hookAnnotation string, deletePolicyAnnotation string) reconcilerOpt {
+	return func(r *reconciler) {
+		r.hookAnnotation = hookAnnotation
+		r.hookDeletePolicyAnnotation = deletePolicyAnnotation
+	}
+}
+
+// WithHookTimeout sets how long a hook may run before it fails.
+func WithHookTimeout(timeout time.Duration) reconcilerOpt {
+	return func(r *reconciler) {
+		r.hookTimeout = timeout
+	}
+}
+
+// WithHealthChecker sets the checker evaluating the health of cached objects,
+// a checker with the built-in checks is used by default.
+func WithHealthChecker(healthChecker health.Checker) reconcilerOpt {
+	return func(r *reconciler) {
+		r.healthChecker = healthChecker
+	}
+}
+
+// WithPreloadGroupKinds restricts the preloaded resources to the kinds, every
+// listable kind is preloaded by default. Objects of other kinds are never
+// cached, so the client-side strategy plans them as created.
+func WithPreloadGroupKinds(groupKinds ...schema.GroupKind) reconcilerOpt {
+	return func(r *reconciler) {
+		for _, groupKind := range groupKinds {
+			r.preloadGroupKinds[groupKind] = true
+		}
+	}
+}
+
+// WithPreloadNamespaces restricts the preloaded namespaced resources to the
+// namespaces, cluster scoped resources are always preloaded.
+func WithPreloadNamespaces(namespaces ...string) reconcilerOpt {
+	return func(r *reconciler) {
+		r.preloadNamespaces = append(r.preloadNamespaces, namespaces...)
+	}
+}
+
+// WithMetadataOnly lists and watches only the metadata of the objects of the
+// kinds, the full object is fetched for the ones found managed.
+func WithMetadataOnly(groupKinds ...schema.GroupKind) reconcilerOpt {
+	return func(r *reconciler) {
+		for _, groupKind := range groupKinds {
+			r.metadataOnly[groupKind] = true
+		}
+	}
+}
+
+// WithMaxAnnotationSize drops the annotations larger than size from cached
+// objects, except the last applied configurations.
+func WithMaxAnnotationSize(size int) reconcilerOpt {
+	return func(r *reconciler) {
+		r.maxAnnotationSize = size
+	}
+}
 
-	dynamicClient   *dynamic.DynamicClient
-	discoveryClient *discovery.DiscoveryClient
+// WithDiscoveryRefreshInterval sets how often live updates refresh discovery
+// to cache the resources served since the preload, changes of CRDs refresh it
+// right away.
+func WithDiscoveryRefreshInterval(interval time.Duration) reconcilerOpt {
+	return func(r *reconciler) {
+		r.discoveryRefreshInterval = interval
+	}
 }
 
-func NewReconciler(logger logr.Logger, config *rest.Config, cache cache.Cache) Reconciler {
+// WithMeter reports the staleness of the watches of the cached resources with
+// the meter.
+func WithMeter(meter metric.Meter) reconcilerOpt {
+	return func(r *reconciler) {
+		r.meter = meter
+	}
+}
+
+func NewReconciler(logger logr.Logger, config *rest.Config, cache cache.Cache, opts ...reconcilerOpt) Reconciler {
 	dynamicClient := dynamic.NewForConfigOrDie(config)
-	discoveryClient := discovery.NewDiscoveryClientForConfigOrDie(config)
-	planner := NewPlanner(cache, discoveryClient)
-
-	return reconciler{
-		Planner:         planner,
-		logger:          logger,
-		config:          config,
-		cache:           cache,
+	discoveryClient := memory.NewMemCacheClient(discovery.NewDiscoveryClientForConfigOrDie(config))
+
+	r := reconciler{
+		logger:        logger,
+		config:        config,
+		cache:         cache,
+		onChange:      func(eventType watch.EventType, old resource.Resource, new resource.Resource) {},
+		applyStrategy: ClientSideApplyStrategy,
+		fieldManager:  DefaultFieldManager,
+
+		syncWaveAnnotation: DefaultSyncWaveAnnotation,
+		waveTimeout:        defaultWaveTimeout,
+		healthChecker:      health.NewChecker(),
+
+		hookAnnotation:             DefaultHookAnnotation,
+		hookDeletePolicyAnnotation: DefaultHookDeletePolicyAnnotation,
+		hookTimeout:                defaultHookTimeout,
+
+		preloadGroupKinds: map[schema.GroupKind]bool{},
+		metadataOnly:      map[schema.GroupKind]bool{},
+
+		discoveryRefreshInterval: defaultDiscoveryRefreshInterval,
+		pendingKindTimeout:       defaultPendingKindTimeout,
+		cachedResources:          newCachedResources(),
+
 		dynamicClient:   dynamicClient,
+		metadataClient:  metadata.NewForConfigOrDie(config),
 		discoveryClient: discoveryClient,
 	}
+
+	for _, opt := range opts {
+		opt(&r)
+	}
+
+	if r.meter != nil {
+		if err := r.registerMetrics(r.meter); err != nil {
+			logger.Error(err, "failed to register reconciler metrics")
+		}
+	}
+
+	plannerOpts := []plannerOpt{
+		withUnknownKindHook(r.cachedResources.requestRefresh),
+		withHookAnnotation(r.hookAnnotation),
+	}
+	if r.applyStrategy == ServerSideApplyStrategy {
+		plannerOpts = append(
+			plannerOpts,
+			WithServerSideDryRun(dynamicClient, r.fieldManager),
+			WithCacheCompaction(r.maxAnnotationSize),
+		)
+	}
+
+	r.Planner = NewPlanner(cache, discoveryClient, plannerOpts...)
+	return r
+}
+
+// setCache stores the resource with the health of its object, the object is
+// compacted before it is stored. It returns the stored resource.
+func (r reconciler) setCache(res resource.Resource) resource.Resource {
+	if res.Object != nil {
+		res.Health = r.healthChecker.Check(res.Object)
+		compactObject(res.Object, r.maxAnnotationSize)
+	}
+
+	r.cache.Set(res.GetResourceIdentifier(), res)
+	return res
 }
 
 func isSupportedVerb(verbs []string) bool {
@@ -106,96 +339,75 @@ func isSupportedVerb(verbs []string) bool {
 	return foundList && foundWatch
 }
 
-func (r reconciler) syncCache(ctx context.Context, resourceList *v1.APIResourceList, apiResource v1.APIResource, liveUpdate bool, isManaged isManagedFunc) func() error {
-	return func() error {
-		gvk := schema.FromAPIVersionAndKind(resourceList.GroupVersion, apiResource.Kind)
-		gvr := gvk.GroupVersion().WithResource(apiResource.Name)
+func (r reconciler) syncCache(ctx context.Context, gvk schema.GroupVersionKind, apiResource v1.APIResource, liveUpdate bool, isManaged isManagedFunc) error {
+	gvr := gvk.GroupVersion().WithResource(apiResource.Name)
 
-		dynamicInterface := r.dynamicClient.Resource(gvr)
-		uns, err := dynamicInterface.List(ctx, v1.ListOptions{})
-		if err != nil {
-			return err
-		}
+	namespaces := []string{v1.NamespaceAll}
+	if apiResource.Namespaced && len(r.preloadNamespaces) > 0 {
+		namespaces = r.preloadNamespaces
+	}
 
-		for _, un := range uns.Items {
-			isManaged := isManaged(&un)
-			newRes := resource.NewResourceByUnstructured(un, un.GetNamespace(), apiResource.Name, isManaged)
-			r.cache.Set(newRes.GetResourceIdentifier(), newRes)
+	for _, namespace := range namespaces {
+		client := resourceClient{
+			gvk:       gvk,
+			gvr:       gvr,
+			namespace: namespace,
+			dynamic:   r.dynamicClient.Resource(gvr).Namespace(namespace),
+		}
+		if r.metadataOnly[gvk.GroupKind()] {
+			client.metadata = r.metadataClient.Resource(gvr).Namespace(namespace)
 		}
 
+		resourceVersion := ""
 		if liveUpdate {
-			go r.watch(ctx, uns.GetResourceVersion(), apiResource.Name, dynamicInterface, isManaged)
+			resourceVersion = r.loadResourceVersion(client.watchKey())
 		}
 
-		return nil
+		// Watches resume from the resource version of a persistent cache, the
+		// resource is listed again when it expired.
+		if resourceVersion == "" {
+			var err error
+			resourceVersion, err = r.relist(ctx, apiResource.Name, client, isManaged, func(watch.EventType, resource.Resource, resource.Resource) {})
+			if err != nil {
+				return err
+			}
+		}
+
+		if liveUpdate {
+			go r.watch(ctx, resourceVersion, apiResource.Name, client, isManaged)
+		}
 	}
-}
 
-func (r reconciler) watch(ctx context.Context, resourceVersion string, apiResourceName string, dynamicInterface dynamic.NamespaceableResourceInterface, isManaged isManagedFunc) {
-	wait.PollImmediateUntil(time.Second*3, func() (bool, error) {
-		w, err := watchutil.NewRetryWatcher(resourceVersion, &clientCache.ListWatch{
-			WatchFunc: func(options v1.ListOptions) (watch.Interface, error) {
-				res, err := dynamicInterface.Watch(ctx, options)
-				if k8sErrors.IsNotFound(err) {
-					fmt.Println("RES NOT FOUND")
-				}
+	return nil
+}
 
-				return res, err
-			},
-		})
+// newResource creates the resource of a listed or watched object. Managed
+// objects received with only their metadata are fetched in full, they keep
+// their metadata when that fails.
+func (r reconciler) newResource(ctx context.Context, client resourceClient, un *unstructured.Unstructured, apiResourceName string, isManaged isManagedFunc) resource.Resource {
+	managed := isManaged(un)
+	if managed {
+		obj, err := client.getObject(ctx, un)
 		if err != nil {
-			return false, err
+			r.logger.Error(err, "failed to get managed object", "kind", un.GetKind(), "namespace", un.GetNamespace(), "name", un.GetName())
+		} else {
+			un = obj
 		}
+	}
 
-		defer w.Stop()
-
-		for {
-			select {
-			case <-ctx.Done():
-				return true, nil
-			case <-w.Done():
-				return false, errors.New("was done on init")
-			case event, ok := <-w.ResultChan():
-				if !ok {
-					return false, errors.New("was closed on init")
-				}
-
-				obj, ok := event.Object.(*unstructured.Unstructured)
-				if !ok {
-					return false, errors.New("was closed")
-				}
-
-				res := resource.NewResourceByUnstructured(*obj, obj.GetNamespace(), apiResourceName, isManaged(obj))
-				key := res.GetResourceIdentifier()
-				if event.Type == watch.Deleted && r.cache.Has(key) {
-					r.cache.Delete(key)
-				} else {
-					r.cache.Set(key, res)
-				}
-			}
-		}
-	}, ctx.Done())
+	return resource.NewResourceByUnstructured(*un, un.GetNamespace(), apiResourceName, managed)
 }
 
+// Preload caches the resources served by the cluster. Live updates keep them
+// in sync and refresh discovery to cache the resources served afterwards.
 func (r reconciler) Preload(ctx context.Context, isManaged isManagedFunc, liveUpdate bool) error {
-	apiResouceList, err := r.discoveryClient.ServerPreferredResources()
-	if err != nil {
+	r.cachedResources.setPreload(isManaged, liveUpdate)
+	if err := r.syncResources(ctx); err != nil {
 		return err
 	}
 
-	g, _ := errgroup.WithContext(ctx)
-	for _, resourceList := range apiResouceList {
-		for _, apiResource := range resourceList.APIResources {
-			if _, ok := ignoredResources[apiResource.Name]; ok || !isSupportedVerb(apiResource.Verbs) {
-				continue
-			}
-
-			g.Go(r.syncCache(ctx, resourceList, apiResource, liveUpdate, isManaged))
-		}
-	}
-
-	if err := g.Wait(); err != nil {
-		return err
+	if liveUpdate {
+		go r.refreshDiscovery(ctx)
 	}
 
 	return nil
@@ -213,7 +425,9 @@ func (r reconciler) SetLastAppliedConfiguration(un *unstructured.Unstructured, n
 	return un
 }
 
-// TODO: hook before apply is necessary?
+// Apply applies the plan in waves. Pre-sync and on-delete hooks run before
+// the waves and post-sync hooks after them, hooks only run when the plan
+// changes an object, so resyncs without changes don't run them again.
 func (r reconciler) Apply(ctx context.Context, planResults []PlanResult, namespace string) ([]ApplyResult, error) {
 	result := []ApplyResult{}
 
@@ -221,62 +435,244 @@ func (r reconciler) Apply(ctx context.Context, planResults []PlanResult, namespa
 		return []ApplyResult{}, nil
 	}
 
-	for _, res := range planResults {
-		newApplyResult := ApplyResult{PlanResult: res}
+	hooks, planResults := splitHooks(planResults, r.hookAnnotation)
+	if !hasChanges(planResults) {
+		hooks = map[string][]PlanResult{}
+	}
+
+	var skipErr error
+	for _, phase := range []string{PreSyncHookPhase, OnDeleteHookPhase} {
+		var hookResults []ApplyResult
+		hookResults, skipErr = r.applyHooks(ctx, phase, hooks[phase], skipErr)
+		result = append(result, hookResults...)
+	}
 
-		dynamicInterface := r.dynamicClient.Resource(schema.GroupVersionResource{
-			Group:    res.Group,
-			Version:  res.Version,
-			Resource: res.ResourceName,
-		}).Namespace(namespace)
+	waves, invalidResults := getWaves(planResults, r.syncWaveAnnotation)
+	result = append(result, invalidResults...)
 
-		if res.Action == PlanCreateAction {
-			res.Object = r.SetLastAppliedConfiguration(res.Object, res.TargetManifest)
-			_, err := dynamicInterface.Create(ctx, res.Object, v1.CreateOptions{})
-			if err != nil {
-				newApplyResult.Err = err
-				result = append(result, newApplyResult)
-				continue
+	waveResults, skipErr := r.applyWaves(waves, skipErr, func(w wave) ([]ApplyResult, error) {
+		return r.applyWave(ctx, w)
+	})
+	result = append(result, waveResults...)
+
+	hookResults, _ := r.applyHooks(ctx, PostSyncHookPhase, hooks[PostSyncHookPhase], skipErr)
+	return append(result, hookResults...), nil
+}
+
+// applyWaves applies the waves in order until one fails, the results of the
+// following waves fail with the error returned by the failed wave.
+func (r reconciler) applyWaves(waves []wave, skipErr error, applyWave func(w wave) ([]ApplyResult, error)) ([]ApplyResult, error) {
+	result := []ApplyResult{}
+	for _, w := range waves {
+		if skipErr != nil {
+			for _, res := range w.results {
+				result = append(result, ApplyResult{PlanResult: res, Err: skipErr})
 			}
+			continue
+		}
 
-			r.cache.Set(res.GetResourceIdentifier(), res.Resource)
-			result = append(result, newApplyResult)
+		waveResults, err := applyWave(w)
+		skipErr = err
+		result = append(result, waveResults...)
+	}
+
+	return result, skipErr
+}
+
+func (r reconciler) applyWave(ctx context.Context, w wave) ([]ApplyResult, error) {
+	waveResults := []ApplyResult{}
+	for _, res := range w.results {
+		waveResults = append(waveResults, r.apply(ctx, res))
+	}
+
+	if r.waveHealthGate && !w.isDeletion {
+		r.waitHealthy(ctx, waveResults)
+	}
+
+	for _, res := range waveResults {
+		if res.Err != nil {
+			return waveResults, fmt.Errorf("skipped after wave %d failed", w.number)
 		}
+	}
 
-		if res.Action == PlanUpdateAction {
-			res.Object = r.SetLastAppliedConfiguration(res.Object, res.TargetManifest)
-			err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
-				_, err := dynamicInterface.Update(ctx, res.Object, v1.UpdateOptions{})
-				if err != nil {
-					return err
-				}
+	return waveResults, nil
+}
 
-				return nil
-			})
+func (r reconciler) apply(ctx context.Context, res PlanResult) ApplyResult {
+	newApplyResult := ApplyResult{PlanResult: res}
+	if res.Err != nil {
+		newApplyResult.Err = res.Err
+		return newApplyResult
+	}
 
-			if err != nil {
-				newApplyResult.Err = err
-				result = append(result, newApplyResult)
-				continue
-			}
+	if isPending(res) {
+		var err error
+		res, err = r.resolvePending(res)
+		newApplyResult.PlanResult = res
+		if err != nil {
+			newApplyResult.Err = err
+			return newApplyResult
+		}
+	}
 
-			r.cache.Set(res.GetResourceIdentifier(), res.Resource)
-			result = append(result, newApplyResult)
+	dynamicInterface := getResourceInterface(r.dynamicClient, res.Resource)
+
+	if r.applyStrategy == ServerSideApplyStrategy && (res.Action == PlanCreateAction || res.Action == PlanUpdateAction) {
+		obj, err := dynamicInterface.Apply(ctx, res.Name, res.Object, v1.ApplyOptions{FieldManager: r.fieldManager, Force: true})
+		if err != nil {
+			newApplyResult.Err = err
+			return newApplyResult
 		}
 
-		if res.Action == PlanDeleteAction {
-			err := dynamicInterface.Delete(ctx, res.Name, v1.DeleteOptions{})
-			if err != nil {
-				newApplyResult.Err = err
-				result = append(result, newApplyResult)
+		res.Object = obj
+		r.setCache(res.Resource)
+		return r.withHealth(newApplyResult)
+	}
+
+	switch res.Action {
+	case PlanCreateAction:
+		res.Object = r.SetLastAppliedConfiguration(res.Object, res.TargetManifest)
+		_, err := dynamicInterface.Create(ctx, res.Object, v1.CreateOptions{})
+		if err != nil {
+			newApplyResult.Err = err
+			return newApplyResult
+		}
+
+		r.setCache(res.Resource)
+	case PlanUpdateAction:
+		res.Object = r.SetLastAppliedConfiguration(res.Object, res.TargetManifest)
+		err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+			_, err := dynamicInterface.Update(ctx, res.Object, v1.UpdateOptions{})
+			return err
+		})
+		if err != nil {
+			newApplyResult.Err = err
+			return newApplyResult
+		}
+
+		r.setCache(res.Resource)
+	case PlanDeleteAction:
+		err := dynamicInterface.Delete(ctx, res.Name, v1.DeleteOptions{})
+		if err != nil {
+			newApplyResult.Err = err
+			return newApplyResult
+		}
+
+		r.cache.Delete(res.GetResourceIdentifier())
+		return newApplyResult
+	}
+
+	return r.withHealth(newApplyResult)
+}
+
+// resolvePending resolves the kind of an object planned before its kind was
+// served, refreshing discovery until the definitions applied by earlier objects
+// are served or the pending kind timeout expires.
+func (r reconciler) resolvePending(res PlanResult) (PlanResult, error) {
+	planner := plannerContext{discoveryClient: r.discoveryClient, onUnknownKind: func() {}}
+	var resourceName string
+	var namespaced bool
+	var lastErr error
+	err := wait.PollImmediate(waveHealthPollInterval, r.pendingKindTimeout, func() (bool, error) {
+		r.discoveryClient.Invalidate()
+		resourceName, namespaced, lastErr = planner.getResourceName(res.Object)
+		if isUnknownKindError(lastErr) {
+			return false, nil
+		}
+
+		return true, lastErr
+	})
+	if err == wait.ErrWaitTimeout {
+		err = fmt.Errorf("kind %s of %s is not served: %w", res.Object.GroupVersionKind().String(), res.Name, lastErr)
+	}
+
+	if err != nil {
+		return res, err
+	}
+
+	if r.cachedResources != nil {
+		r.cachedResources.requestRefresh()
+	}
+
+	res.Object = res.Object.DeepCopy()
+	res.ResourceName = resourceName
+	if !namespaced {
+		res.Namespace = ""
+		res.Object.SetNamespace("")
+	}
+
+	return res, nil
+}
+
+// getResourceInterface returns the client of the resource, cluster scoped
+// resources have no namespace.
+func getResourceInterface(dynamicClient dynamic.Interface, res resource.Resource) dynamic.ResourceInterface {
+	resourceInterface := dynamicClient.Resource(schema.GroupVersionResource{
+		Group:    res.Group,
+		Version:  res.Version,
+		Resource: res.ResourceName,
+	})
+	if res.Namespace == "" {
+		return resourceInterface
+	}
+
+	return resourceInterface.Namespace(res.Namespace)
+}
+
+// withHealth sets the health of the applied object as stored in the cache.
+func (r reconciler) withHealth(applyResult ApplyResult) ApplyResult {
+	cached := r.cache.Get(applyResult.GetResourceIdentifier())
+	applyResult.Status = cached.Health.Status
+	applyResult.StatusMessage = cached.Health.Message
+	return applyResult
+}
+
+// waitHealthy polls the objects applied by a wave together until the health
+// checker reports all of them healthy. Degraded objects fail right away and the
+// objects still unhealthy when the wave timeout expires fail with their last
+// status.
+func (r reconciler) waitHealthy(ctx context.Context, results []ApplyResult) {
+	pending := map[int]error{}
+	for i, res := range results {
+		if res.Err == nil && res.Object != nil && res.Action != PlanDeleteAction {
+			pending[i] = fmt.Errorf("%s %s is not healthy", res.Kind, res.Name)
+		}
+	}
+
+	err := wait.PollImmediate(waveHealthPollInterval, r.waveTimeout, func() (bool, error) {
+		for i := range pending {
+			res := results[i]
+			un, err := getResourceInterface(r.dynamicClient, res.Resource).Get(ctx, res.Name, v1.GetOptions{})
+			if err != nil && !k8sErrors.IsNotFound(err) {
+				pending[i] = err
 				continue
 			}
 
-			r.cache.Delete(res.GetResourceIdentifier())
-			result = append(result, newApplyResult)
+			if err != nil {
+				un = nil
+			}
+
+			status := r.healthChecker.Check(un)
+			results[i].Status = status.Status
+			results[i].StatusMessage = status.Message
+			switch status.Status {
+			case health.HealthyStatus:
+				delete(pending, i)
+			case health.DegradedStatus:
+				results[i].Err = fmt.Errorf("%s %s is degraded: %s", res.Kind, res.Name, status.Message)
+				delete(pending, i)
+			default:
+				pending[i] = fmt.Errorf("%s %s is not healthy: %s", res.Kind, res.Name, status.Message)
+			}
 		}
 
+		return len(pending) == 0, nil
+	})
+	if err == nil {
+		return
 	}
 
-	return result, nil
+	for i, pendingErr := range pending {
+		results[i].Err = pendingErr
+	}
 }
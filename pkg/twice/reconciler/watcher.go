@@ -0,0 +1,182 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/octopipe/circlerr/pkg/twice/cache"
+	"github.com/octopipe/circlerr/pkg/twice/resource"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	watchInitialBackoff = time.Second
+	watchMaxBackoff     = 2 * time.Minute
+)
+
+func newWatchBackoff() wait.Backoff {
+	return wait.Backoff{
+		Duration: watchInitialBackoff,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    int(^uint(0) >> 1),
+		Cap:      watchMaxBackoff,
+	}
+}
+
+// watch keeps the cached objects of the resource in sync until ctx is done.
+// Failed watches are restarted from the last resource version seen with an
+// exponential backoff, and the resource is listed again once that version
+// expired.
+func (r reconciler) watch(ctx context.Context, resourceVersion string, apiResourceName string, client resourceClient, isManaged isManagedFunc) {
+	key := client.watchKey()
+	logger := r.logger.WithValues("resource", key.resource.String(), "namespace", key.namespace)
+	defer r.cachedResources.removeWatch(key)
+
+	backoff := newWatchBackoff()
+	for {
+		var err error
+		resourceVersion, err = r.watchChanges(ctx, resourceVersion, apiResourceName, client, isManaged)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err == nil {
+			backoff = newWatchBackoff()
+			continue
+		}
+
+		r.cachedResources.setStale(key)
+		if k8sErrors.IsResourceExpired(err) || k8sErrors.IsGone(err) {
+			logger.Info("resource version expired, listing resource again", "resourceVersion", resourceVersion)
+			resourceVersion, err = r.relist(ctx, apiResourceName, client, isManaged, r.onChange)
+			if err == nil {
+				r.cachedResources.setSynced(key)
+				continue
+			}
+		}
+
+		delay := backoff.Step()
+		logger.Error(err, "failed to watch resource", "retryIn", delay.String())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// watchChanges caches the changes received by a watch started at the resource
+// version. It returns the last resource version seen, with no error when the
+// watch was closed by the server or ctx.
+func (r reconciler) watchChanges(ctx context.Context, resourceVersion string, apiResourceName string, client resourceClient, isManaged isManagedFunc) (string, error) {
+	w, err := client.watch(ctx, v1.ListOptions{ResourceVersion: resourceVersion, AllowWatchBookmarks: true})
+	if err != nil {
+		return resourceVersion, err
+	}
+
+	defer w.Stop()
+	r.cachedResources.setSynced(client.watchKey())
+
+	for {
+		select {
+		case <-ctx.Done():
+			return resourceVersion, nil
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return resourceVersion, nil
+			}
+
+			if event.Type == watch.Error {
+				return resourceVersion, k8sErrors.FromObject(event.Object)
+			}
+
+			obj, ok := client.toUnstructured(event.Object)
+			if !ok {
+				return resourceVersion, fmt.Errorf("unexpected watch object %T", event.Object)
+			}
+
+			resourceVersion = obj.GetResourceVersion()
+			if event.Type != watch.Bookmark {
+				r.handleEvent(ctx, event.Type, obj, apiResourceName, client, isManaged)
+			}
+
+			r.saveResourceVersion(client.watchKey(), resourceVersion)
+		}
+	}
+}
+
+func (r reconciler) handleEvent(ctx context.Context, eventType watch.EventType, obj *unstructured.Unstructured, apiResourceName string, client resourceClient, isManaged isManagedFunc) {
+	if eventType == watch.Deleted {
+		res := resource.NewResourceByUnstructured(*obj, obj.GetNamespace(), apiResourceName, isManaged(obj))
+		key := res.GetResourceIdentifier()
+		old := r.cache.Get(key)
+		r.cache.Delete(key)
+		r.onChange(eventType, old, res)
+	} else {
+		res := r.newResource(ctx, client, obj, apiResourceName, isManaged)
+		old := r.cache.Get(res.GetResourceIdentifier())
+		r.onChange(eventType, old, r.setCache(res))
+	}
+
+	if client.gvk.GroupKind() == crdGroupKind {
+		r.cachedResources.requestRefresh()
+	}
+}
+
+// relist lists the resource and replaces its cached objects, the changes found
+// are notified to onChange like the ones received by watches.
+func (r reconciler) relist(ctx context.Context, apiResourceName string, client resourceClient, isManaged isManagedFunc, onChange OnChangeFunc) (string, error) {
+	uns, resourceVersion, err := client.list(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	listed := map[string]bool{}
+	for _, un := range uns {
+		eventType := watch.Modified
+		res := r.newResource(ctx, client, un, apiResourceName, isManaged)
+		key := res.GetResourceIdentifier()
+		if !r.cache.Has(key) {
+			eventType = watch.Added
+		}
+
+		listed[key] = true
+		old := r.cache.Get(key)
+		onChange(eventType, old, r.setCache(res))
+	}
+
+	for _, cached := range r.cache.ByIndex(cache.GVKIndex, client.gvk.String()) {
+		key := cached.GetResourceIdentifier()
+		if listed[key] || (client.namespace != v1.NamespaceAll && cached.Namespace != client.namespace) {
+			continue
+		}
+
+		r.cache.Delete(key)
+		onChange(watch.Deleted, cached, cached)
+	}
+
+	r.saveResourceVersion(client.watchKey(), resourceVersion)
+	return resourceVersion, nil
+}
+
+// saveResourceVersion stores the resource version a watch is synced at in
+// persistent caches, so the watch resumes from it after a restart.
+func (r reconciler) saveResourceVersion(key watchKey, resourceVersion string) {
+	if persistentCache, ok := r.cache.(cache.PersistentCache); ok {
+		persistentCache.SetResourceVersion(key.String(), resourceVersion)
+	}
+}
+
+func (r reconciler) loadResourceVersion(key watchKey) string {
+	if persistentCache, ok := r.cache.(cache.PersistentCache); ok {
+		return persistentCache.GetResourceVersion(key.String())
+	}
+
+	return ""
+}
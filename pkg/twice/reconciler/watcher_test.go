@@ -0,0 +1,191 @@
+package reconciler
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/octopipe/circlerr/pkg/twice/cache"
+	"github.com/octopipe/circlerr/pkg/twice/health"
+	"github.com/octopipe/circlerr/pkg/twice/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+var (
+	configMapGVK = schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+	configMapGVR = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+)
+
+func newConfigMap(name string) *unstructured.Unstructured {
+	un := &unstructured.Unstructured{}
+	un.SetGroupVersionKind(configMapGVK)
+	un.SetName(name)
+	un.SetNamespace("default")
+	return un
+}
+
+func isManagedForTest(un *unstructured.Unstructured) bool {
+	return true
+}
+
+type WatcherTestSuite struct {
+	suite.Suite
+	reconciler    reconciler
+	dynamicClient *dynamicfake.FakeDynamicClient
+	client        resourceClient
+
+	mu     sync.Mutex
+	events map[string]watch.EventType
+}
+
+func (s *WatcherTestSuite) SetupTest() {
+	s.events = map[string]watch.EventType{}
+	s.dynamicClient = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{configMapGVR: "ConfigMapList"},
+		newConfigMap("guestbook"),
+	)
+
+	s.reconciler = reconciler{
+		logger:          logr.Discard(),
+		cache:           cache.NewLocalCache(),
+		healthChecker:   health.NewChecker(),
+		cachedResources: newCachedResources(),
+		onChange: func(eventType watch.EventType, old resource.Resource, new resource.Resource) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.events[new.Name] = eventType
+		},
+	}
+
+	s.client = resourceClient{
+		gvk:     configMapGVK,
+		gvr:     configMapGVR,
+		dynamic: s.dynamicClient.Resource(configMapGVR),
+	}
+}
+
+func (s *WatcherTestSuite) getEvent(name string) watch.EventType {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.events[name]
+}
+
+func (s *WatcherTestSuite) isCached(name string) bool {
+	res := resource.NewResourceByUnstructured(*newConfigMap(name), "default", "configmaps", true)
+	return s.reconciler.cache.Has(res.GetResourceIdentifier())
+}
+
+func (s *WatcherTestSuite) TestRelistReplacesCachedObjects() {
+	s.reconciler.setCache(resource.NewResourceByUnstructured(*newConfigMap("removed"), "default", "configmaps", true))
+
+	_, err := s.reconciler.relist(context.Background(), "configmaps", s.client, isManagedForTest, s.reconciler.onChange)
+	assert.NoError(s.T(), err)
+
+	assert.True(s.T(), s.isCached("guestbook"))
+	assert.False(s.T(), s.isCached("removed"))
+	assert.Equal(s.T(), watch.Added, s.getEvent("guestbook"))
+	assert.Equal(s.T(), watch.Deleted, s.getEvent("removed"))
+}
+
+func (s *WatcherTestSuite) TestWatchRelistsAfterExpiredResourceVersion() {
+	watchers := []*watch.FakeWatcher{watch.NewFake(), watch.NewFake()}
+	calls := 0
+	s.dynamicClient.PrependWatchReactor("configmaps", func(action clienttesting.Action) (bool, watch.Interface, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		w := watchers[calls]
+		calls++
+		return true, w, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.reconciler.watch(ctx, "1", "configmaps", s.client, isManagedForTest)
+
+	watchers[0].Error(&v1.Status{Status: v1.StatusFailure, Code: 410, Reason: v1.StatusReasonExpired})
+	assert.Eventually(s.T(), func() bool { return s.isCached("guestbook") }, time.Second, 10*time.Millisecond)
+
+	watchers[1].Add(newConfigMap("added"))
+	assert.Eventually(s.T(), func() bool { return s.isCached("added") }, time.Second, 10*time.Millisecond)
+	assert.Equal(s.T(), map[watchKey]time.Duration{s.client.watchKey(): 0}, s.reconciler.cachedResources.staleness(time.Now()))
+
+	cancel()
+	assert.Eventually(s.T(), func() bool {
+		return len(s.reconciler.cachedResources.staleness(time.Now())) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func (s *WatcherTestSuite) TestSyncCacheResumesFromPersistedResourceVersion() {
+	persistentCache, err := cache.NewBoltCache(filepath.Join(s.T().TempDir(), "cache.db"))
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	defer persistentCache.Close()
+
+	watched := make(chan string, 1)
+	s.dynamicClient.PrependWatchReactor("configmaps", func(action clienttesting.Action) (bool, watch.Interface, error) {
+		watched <- action.(clienttesting.WatchActionImpl).GetWatchRestrictions().ResourceVersion
+		return true, watch.NewFake(), nil
+	})
+
+	s.reconciler.cache = persistentCache
+	s.reconciler.dynamicClient = s.dynamicClient
+	persistentCache.SetResourceVersion(s.client.watchKey().String(), "1024")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	apiResource := v1.APIResource{Name: "configmaps", Kind: "ConfigMap", Namespaced: true}
+	err = s.reconciler.syncCache(ctx, configMapGVK, apiResource, true, isManagedForTest)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "1024", <-watched)
+	for _, action := range s.dynamicClient.Actions() {
+		assert.NotEqual(s.T(), "list", action.GetVerb())
+	}
+}
+
+func (s *WatcherTestSuite) TestStaleness() {
+	key := s.client.watchKey()
+	s.reconciler.cachedResources.setStale(key)
+	time.Sleep(10 * time.Millisecond)
+	s.reconciler.cachedResources.setStale(key)
+
+	assert.GreaterOrEqual(s.T(), s.reconciler.cachedResources.staleness(time.Now())[key], 10*time.Millisecond)
+
+	s.reconciler.cachedResources.setSynced(key)
+	assert.Equal(s.T(), time.Duration(0), s.reconciler.cachedResources.staleness(time.Now())[key])
+}
+
+func (s *WatcherTestSuite) TestStopResource() {
+	canceled := false
+	s.reconciler.setCache(resource.NewResourceByUnstructured(*newConfigMap("guestbook"), "default", "configmaps", true))
+	s.reconciler.cachedResources.add(configMapGVR, cachedResource{gvk: configMapGVK, cancel: func() { canceled = true }})
+
+	s.reconciler.StopResource(configMapGVR)
+
+	assert.True(s.T(), canceled)
+	assert.False(s.T(), s.isCached("guestbook"))
+	assert.True(s.T(), s.reconciler.cachedResources.isStopped(configMapGVR))
+}
+
+func (s *WatcherTestSuite) TestStartResourceBeforePreload() {
+	err := s.reconciler.StartResource(context.Background(), configMapGVR)
+	assert.EqualError(s.T(), err, "resources were not preloaded")
+}
+
+func TestWatcherTestSuite(t *testing.T) {
+	suite.Run(t, new(WatcherTestSuite))
+}
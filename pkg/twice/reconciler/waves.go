@@ -0,0 +1,132 @@
+package reconciler
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// kindOrder is the order objects of a wave are applied in, objects a kind
+// depends on come first. Kinds not listed are applied last, deletions run in
+// the reverse order.
+var kindOrder = []string{
+	"Namespace",
+	"NetworkPolicy",
+	"ResourceQuota",
+	"LimitRange",
+	"PodSecurityPolicy",
+	"PodDisruptionBudget",
+	"ServiceAccount",
+	"Secret",
+	"ConfigMap",
+	"StorageClass",
+	"PersistentVolume",
+	"PersistentVolumeClaim",
+	"CustomResourceDefinition",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"Role",
+	"RoleBinding",
+	"Service",
+	"DaemonSet",
+	"Pod",
+	"ReplicationController",
+	"ReplicaSet",
+	"Deployment",
+	"HorizontalPodAutoscaler",
+	"StatefulSet",
+	"Job",
+	"CronJob",
+	"IngressClass",
+	"Ingress",
+	"APIService",
+}
+
+type wave struct {
+	number     int
+	isDeletion bool
+	results    []PlanResult
+}
+
+// getWaves groups the plan results by the sync wave annotation of their
+// objects. Creates and updates are applied in ascending waves, then deletions
+// in descending waves. Results with an invalid wave are returned as failed.
+func getWaves(planResults []PlanResult, syncWaveAnnotation string) ([]wave, []ApplyResult) {
+	applyWaves := map[int]*wave{}
+	deletionWaves := map[int]*wave{}
+	invalidResults := []ApplyResult{}
+
+	for _, res := range planResults {
+		number, err := getSyncWave(res, syncWaveAnnotation)
+		if err != nil {
+			invalidResults = append(invalidResults, ApplyResult{PlanResult: res, Err: err})
+			continue
+		}
+
+		waves := applyWaves
+		if res.Action == PlanDeleteAction {
+			waves = deletionWaves
+		}
+
+		if _, ok := waves[number]; !ok {
+			waves[number] = &wave{number: number, isDeletion: res.Action == PlanDeleteAction}
+		}
+
+		waves[number].results = append(waves[number].results, res)
+	}
+
+	return append(sortWaves(applyWaves, false), sortWaves(deletionWaves, true)...), invalidResults
+}
+
+func sortWaves(waves map[int]*wave, reverse bool) []wave {
+	sortedWaves := []wave{}
+	for _, w := range waves {
+		sort.SliceStable(w.results, func(i, j int) bool {
+			if reverse {
+				return getKindOrder(w.results[i].Kind) > getKindOrder(w.results[j].Kind)
+			}
+
+			return getKindOrder(w.results[i].Kind) < getKindOrder(w.results[j].Kind)
+		})
+
+		sortedWaves = append(sortedWaves, *w)
+	}
+
+	sort.Slice(sortedWaves, func(i, j int) bool {
+		if reverse {
+			return sortedWaves[i].number > sortedWaves[j].number
+		}
+
+		return sortedWaves[i].number < sortedWaves[j].number
+	})
+
+	return sortedWaves
+}
+
+func getKindOrder(kind string) int {
+	for i, k := range kindOrder {
+		if k == kind {
+			return i
+		}
+	}
+
+	return len(kindOrder)
+}
+
+func getSyncWave(res PlanResult, syncWaveAnnotation string) (int, error) {
+	if res.Object == nil {
+		return 0, nil
+	}
+
+	value, ok := res.Object.GetAnnotations()[syncWaveAnnotation]
+	if !ok {
+		return 0, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid sync wave %q", value)
+	}
+
+	return number, nil
+}
@@ -0,0 +1,316 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/octopipe/circlerr/pkg/twice/cache"
+	"github.com/octopipe/circlerr/pkg/twice/health"
+	"github.com/octopipe/circlerr/pkg/twice/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+type WavesTestSuite struct {
+	suite.Suite
+}
+
+func newWavePlanResult(kind string, name string, action string, syncWave string) PlanResult {
+	un := &unstructured.Unstructured{}
+	un.SetKind(kind)
+	un.SetName(name)
+	if syncWave != "" {
+		un.SetAnnotations(map[string]string{DefaultSyncWaveAnnotation: syncWave})
+	}
+
+	return PlanResult{
+		Resource: resource.Resource{Kind: kind, Name: name, Object: un},
+		Action:   action,
+	}
+}
+
+func getWaveNames(waves []wave) [][]string {
+	names := [][]string{}
+	for _, w := range waves {
+		waveNames := []string{}
+		for _, res := range w.results {
+			waveNames = append(waveNames, res.Name)
+		}
+		names = append(names, waveNames)
+	}
+
+	return names
+}
+
+func (s *WavesTestSuite) TestGetWavesKindOrder() {
+	waves, invalidResults := getWaves([]PlanResult{
+		newWavePlanResult("Deployment", "guestbook", PlanCreateAction, ""),
+		newWavePlanResult("VirtualService", "guestbook-routing", PlanCreateAction, ""),
+		newWavePlanResult("Service", "guestbook", PlanCreateAction, ""),
+		newWavePlanResult("ConfigMap", "guestbook-config", PlanUpdateAction, ""),
+		newWavePlanResult("Namespace", "guestbook", PlanImmutableAction, ""),
+	}, DefaultSyncWaveAnnotation)
+
+	assert.Empty(s.T(), invalidResults)
+	assert.Equal(s.T(), [][]string{{"guestbook", "guestbook-config", "guestbook", "guestbook", "guestbook-routing"}}, getWaveNames(waves))
+	assert.Equal(s.T(), "Namespace", waves[0].results[0].Kind)
+	assert.Equal(s.T(), "Deployment", waves[0].results[3].Kind)
+}
+
+func (s *WavesTestSuite) TestGetWavesAnnotation() {
+	waves, invalidResults := getWaves([]PlanResult{
+		newWavePlanResult("Job", "migration", PlanCreateAction, "-1"),
+		newWavePlanResult("Deployment", "guestbook", PlanCreateAction, ""),
+		newWavePlanResult("Job", "smoke-test", PlanCreateAction, "5"),
+		newWavePlanResult("ConfigMap", "guestbook-config", PlanCreateAction, "0"),
+	}, DefaultSyncWaveAnnotation)
+
+	assert.Empty(s.T(), invalidResults)
+	assert.Equal(s.T(), [][]string{{"migration"}, {"guestbook-config", "guestbook"}, {"smoke-test"}}, getWaveNames(waves))
+	assert.Equal(s.T(), []int{-1, 0, 5}, []int{waves[0].number, waves[1].number, waves[2].number})
+}
+
+func (s *WavesTestSuite) TestGetWavesDeletionInReverse() {
+	waves, invalidResults := getWaves([]PlanResult{
+		newWavePlanResult("Namespace", "guestbook", PlanDeleteAction, ""),
+		newWavePlanResult("Deployment", "guestbook", PlanDeleteAction, ""),
+		newWavePlanResult("Job", "smoke-test", PlanDeleteAction, "5"),
+		newWavePlanResult("Service", "guestbook", PlanDeleteAction, ""),
+		newWavePlanResult("Deployment", "guestbook-v2", PlanCreateAction, "5"),
+	}, DefaultSyncWaveAnnotation)
+
+	assert.Empty(s.T(), invalidResults)
+	assert.Equal(s.T(), [][]string{{"guestbook-v2"}, {"smoke-test"}, {"guestbook", "guestbook", "guestbook"}}, getWaveNames(waves))
+	assert.False(s.T(), waves[0].isDeletion)
+	assert.True(s.T(), waves[1].isDeletion)
+	assert.Equal(s.T(), []string{"Deployment", "Service", "Namespace"}, []string{waves[2].results[0].Kind, waves[2].results[1].Kind, waves[2].results[2].Kind})
+}
+
+func (s *WavesTestSuite) TestGetWavesInvalidAnnotation() {
+	waves, invalidResults := getWaves([]PlanResult{
+		newWavePlanResult("Deployment", "guestbook", PlanCreateAction, "first"),
+		newWavePlanResult("Service", "guestbook", PlanCreateAction, ""),
+	}, DefaultSyncWaveAnnotation)
+
+	assert.Equal(s.T(), [][]string{{"guestbook"}}, getWaveNames(waves))
+	assert.Equal(s.T(), 1, len(invalidResults))
+	assert.EqualError(s.T(), invalidResults[0].Err, `invalid sync wave "first"`)
+}
+
+func newJob(name string, condition string) *unstructured.Unstructured {
+	un := &unstructured.Unstructured{}
+	un.SetAPIVersion("batch/v1")
+	un.SetKind("Job")
+	un.SetName(name)
+	un.SetNamespace("default")
+	if condition != "" {
+		conditions := []interface{}{map[string]interface{}{"type": condition, "status": "True", "message": condition}}
+		_ = unstructured.SetNestedSlice(un.Object, conditions, "status", "conditions")
+	}
+
+	return un
+}
+
+func (s *WavesTestSuite) TestWaitHealthy() {
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{jobGVR: "JobList"},
+		newJob("migration", "Complete"),
+		newJob("seed", "Failed"),
+		newJob("backfill", ""),
+	)
+	r := reconciler{
+		dynamicClient:  dynamicClient,
+		healthChecker:  health.NewChecker(),
+		waveHealthGate: true,
+		waveTimeout:    10 * time.Millisecond,
+	}
+
+	results := []ApplyResult{}
+	for _, name := range []string{"migration", "seed", "backfill", "missing"} {
+		planResult := newWavePlanResult("Job", name, PlanCreateAction, "")
+		planResult.Group = "batch"
+		planResult.Version = "v1"
+		planResult.ResourceName = "jobs"
+		planResult.Namespace = "default"
+		results = append(results, ApplyResult{PlanResult: planResult})
+	}
+
+	r.waitHealthy(context.Background(), results)
+	assert.NoError(s.T(), results[0].Err)
+	assert.Equal(s.T(), health.HealthyStatus, results[0].Status)
+	assert.EqualError(s.T(), results[1].Err, "Job seed is degraded: Failed")
+	assert.EqualError(s.T(), results[2].Err, "Job backfill is not healthy: waiting for job to complete")
+	assert.Equal(s.T(), health.ProgressingStatus, results[2].Status)
+	assert.Error(s.T(), results[3].Err)
+	assert.Equal(s.T(), health.MissingStatus, results[3].Status)
+}
+
+const clusterScopedManifests = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: guestbook
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: guestbook
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: guestbook
+`
+
+func (s *WavesTestSuite) TestApplyClusterScopedObjects() {
+	verbs := v1.Verbs{"get", "list", "watch", "create", "update", "delete"}
+	discoveryClient := &fake.FakeDiscovery{Fake: &clienttesting.Fake{
+		Resources: []*v1.APIResourceList{
+			{
+				GroupVersion: "v1",
+				APIResources: []v1.APIResource{
+					{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: verbs},
+					{Name: "namespaces", Kind: "Namespace", Verbs: verbs},
+				},
+			},
+			{
+				GroupVersion: "rbac.authorization.k8s.io/v1",
+				APIResources: []v1.APIResource{{Name: "clusterroles", Kind: "ClusterRole", Verbs: verbs}},
+			},
+		},
+	}}
+	namespaceGVR := schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+	clusterRoleGVR := schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{configMapGVR: "ConfigMapList", namespaceGVR: "NamespaceList", clusterRoleGVR: "ClusterRoleList"},
+	)
+
+	localCache := cache.NewLocalCache()
+	r := reconciler{
+		Planner:            NewPlanner(localCache, discoveryClient),
+		logger:             logr.Discard(),
+		cache:              localCache,
+		healthChecker:      health.NewChecker(),
+		syncWaveAnnotation: DefaultSyncWaveAnnotation,
+		hookAnnotation:     DefaultHookAnnotation,
+		dynamicClient:      dynamicClient,
+	}
+
+	planResults, err := r.Plan(context.Background(), []string{clusterScopedManifests}, "default", isManagedForTest)
+	assert.NoError(s.T(), err)
+	results, err := r.Apply(context.Background(), planResults, "default")
+	assert.NoError(s.T(), err)
+
+	assert.Equal(s.T(), []string{"Namespace", "ConfigMap", "ClusterRole"}, []string{results[0].Kind, results[1].Kind, results[2].Kind})
+	for _, res := range results {
+		assert.NoError(s.T(), res.Err)
+	}
+
+	for _, action := range dynamicClient.Actions() {
+		if action.GetResource().Resource == "configmaps" {
+			assert.Equal(s.T(), "default", action.GetNamespace())
+		} else {
+			assert.Empty(s.T(), action.GetNamespace())
+		}
+	}
+
+	_, err = dynamicClient.Resource(namespaceGVR).Get(context.Background(), "guestbook", v1.GetOptions{})
+	assert.NoError(s.T(), err)
+	_, err = dynamicClient.Resource(clusterRoleGVR).Get(context.Background(), "guestbook", v1.GetOptions{})
+	assert.NoError(s.T(), err)
+
+	planResults, err = r.Plan(context.Background(), []string{clusterScopedManifests}, "default", isManagedForTest)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), planResults, 3)
+	for _, planResult := range planResults {
+		assert.Equal(s.T(), PlanImmutableAction, planResult.Action)
+	}
+}
+
+const widgetManifests = `
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: guestbook
+---
+apiVersion: example.com/v1
+kind: Gadget
+metadata:
+  name: guestbook
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+`
+
+func (s *WavesTestSuite) TestApplyCustomResourceOfPlannedDefinition() {
+	verbs := v1.Verbs{"get", "list", "watch", "create", "update", "delete"}
+	fakeDiscovery := &fake.FakeDiscovery{Fake: &clienttesting.Fake{
+		Resources: []*v1.APIResourceList{{
+			GroupVersion: "apiextensions.k8s.io/v1",
+			APIResources: []v1.APIResource{{Name: "customresourcedefinitions", Kind: "CustomResourceDefinition", Verbs: verbs}},
+		}},
+	}}
+	discoveryClient := memory.NewMemCacheClient(fakeDiscovery)
+	crdGVR := schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+	widgetGVR := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{crdGVR: "CustomResourceDefinitionList", widgetGVR: "WidgetList"},
+	)
+	dynamicClient.PrependReactor("create", "customresourcedefinitions", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		fakeDiscovery.Resources = append(fakeDiscovery.Resources, &v1.APIResourceList{
+			GroupVersion: "example.com/v1",
+			APIResources: []v1.APIResource{{Name: "widgets", Kind: "Widget", Namespaced: true, Verbs: verbs}},
+		})
+		return false, nil, nil
+	})
+
+	localCache := cache.NewLocalCache()
+	r := reconciler{
+		Planner:            NewPlanner(localCache, discoveryClient),
+		logger:             logr.Discard(),
+		cache:              localCache,
+		healthChecker:      health.NewChecker(),
+		syncWaveAnnotation: DefaultSyncWaveAnnotation,
+		hookAnnotation:     DefaultHookAnnotation,
+		pendingKindTimeout: 10 * time.Millisecond,
+		dynamicClient:      dynamicClient,
+		discoveryClient:    discoveryClient,
+	}
+
+	planResults, err := r.Plan(context.Background(), []string{widgetManifests}, "default", isManagedForTest)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), planResults, 3)
+	for _, planResult := range planResults {
+		assert.Equal(s.T(), PlanCreateAction, planResult.Action)
+	}
+
+	results, err := r.Apply(context.Background(), planResults, "default")
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), []string{"CustomResourceDefinition", "Widget", "Gadget"}, []string{results[0].Kind, results[1].Kind, results[2].Kind})
+	assert.NoError(s.T(), results[0].Err)
+	assert.NoError(s.T(), results[1].Err)
+	assert.Equal(s.T(), "widgets", results[1].ResourceName)
+	assert.ErrorContains(s.T(), results[2].Err, "kind example.com/v1, Kind=Gadget of guestbook is not served")
+
+	_, err = dynamicClient.Resource(widgetGVR).Namespace("default").Get(context.Background(), "guestbook", v1.GetOptions{})
+	assert.NoError(s.T(), err)
+}
+
+func TestWavesTestSuite(t *testing.T) {
+	suite.Run(t, new(WavesTestSuite))
+}
@@ -3,6 +3,7 @@ package resource
 import (
 	"fmt"
 
+	"github.com/octopipe/circlerr/pkg/twice/health"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
@@ -22,6 +23,8 @@ type Resource struct {
 	Namespace    string
 	Owners       []ResourceOwner
 	Object       *unstructured.Unstructured
+	// Health is evaluated from Object when the resource is cached.
+	Health health.Status
 }
 
 func NewResourceByUnstructured(un unstructured.Unstructured, namespace, resource string, isManaged bool) Resource {
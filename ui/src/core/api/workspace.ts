@@ -2,7 +2,7 @@ import { PaginationRequest, PaginationResponse } from "./pagination"
 
 export enum WORKSPACE_TYPE {
   DEFAULT = 'DEFAULT',
-  CIRCLE = 'CIRCLE',
+  MATCH = 'MATCH',
   CANARY = 'CANARY'
 }
 
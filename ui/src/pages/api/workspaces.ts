@@ -1,17 +1,18 @@
 // Next.js API route support: https://nextjs.org/docs/api-routes/introduction
 import { PaginationResponse } from '@/core/api/pagination'
-import { WorkspaceModel, WORKSPACE_TYPE } from '@/core/api/workspace'
+import { WorkspaceModel } from '@/core/api/workspace'
 import type { NextApiRequest, NextApiResponse } from 'next'
 
-export default function handler(
+export default async function handler(
   req: NextApiRequest,
   res: NextApiResponse<PaginationResponse<WorkspaceModel[]>>
 ) {
-  res.status(200).json({
-    limit: 10,
-    continue: 'asasas',
-    items: [
-      { id: 'id-1', name: 'workspace1', description: 'Lorem ipsum', type: WORKSPACE_TYPE.DEFAULT, createdAt: 'yesterday' }
-    ]
-  })
+  const params = new URLSearchParams()
+  if (req.query.limit) params.set('limit', String(req.query.limit))
+  if (req.query.continue) params.set('continue', String(req.query.continue))
+
+  const response = await fetch(`${process.env.MOOVE_URL}/workspaces?${params}`)
+  const pagination = await response.json()
+
+  res.status(response.status).json(pagination)
 }